@@ -2,68 +2,229 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/render"
 	"github.com/jonfk/battleship/protocol"
-	"io"
+	"github.com/jonfk/battleship/protocol/client"
+	"github.com/jonfk/battleship/protocol/tlsutil"
 	"log"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 )
 
 const (
 	DEFAULT_CONN_HOST = "0.0.0.0"
 	DEFAULT_CONN_PORT = "8888"
-	CONN_TYPE         = "tcp"
+	DEFAULT_USERNAME  = "jonfk"
 )
 
+const help = `Commands:
+  list                     list the open games
+  create [rules]           create a game, e.g. "create 8x8 fleet=PatrolBoat,Destroyer"
+  join ID                  join an open game
+  place PIECE PLACEMENT    place a piece, e.g. "place PatrolBoat A1-A2" or "place Destroyer B2 down"
+  fire COORD               fire at the opponent, e.g. "fire B7" or just "B7"
+  chat TEXT                send a message to the opponent
+  state                    show the game
+  abandon                  resign the game
+  draw                     offer a draw
+  accept                   accept the draw offered
+  quit                     leave`
+
 func main() {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", DEFAULT_CONN_HOST+":"+DEFAULT_CONN_PORT)
+	host := flag.String("host", DEFAULT_CONN_HOST, "server host")
+	port := flag.String("port", DEFAULT_CONN_PORT, "server port")
+	username := flag.String("username", DEFAULT_USERNAME, "username")
+	useTLS := flag.Bool("tls", false, "connect with TLS")
+	caFile := flag.String("ca", "", "PEM CA certificates verifying the server, implies -tls")
+	insecure := flag.Bool("insecure", false, "connect with TLS without verifying the server, for development only")
+	flag.Parse()
+
+	var config *tls.Config
+	if *useTLS || *caFile != "" || *insecure {
+		var err error
+		config, err = tlsutil.ClientConfig(*caFile, *host, *insecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	c, err := client.Dial(net.JoinHostPort(*host, *port), config)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer c.Close()
+	c.OnEvent(func(msg protocol.BattleMsg) {
+		printEvent(c, msg)
+	})
 
-	// Connect to server through tcp.
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
+	welcome, err := c.Connect(*username)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer conn.Close()
-	go printOutput(conn)
-	writeInput(conn)
+	fmt.Printf("Connected with protocol version %d\n", welcome.Version)
+	fmt.Println(help)
+	readCommands(c)
 }
 
-func printOutput(conn *net.TCPConn) {
+// printEvent prints a message pushed by the server
+func printEvent(c *client.Client, msg protocol.BattleMsg) {
+	switch msg := msg.(type) {
+	case protocol.GameMoveMsg:
+		fmt.Printf("Player %d fired at %v\n", msg.Player+1, game.Coord{X: msg.X, Y: msg.Y}.Notation())
+	case protocol.GameStateMsg:
+		printGrids(msg.YourGrid, msg.OpponentGrid)
+	case protocol.ChatMessageMsg:
+		fmt.Printf("Opponent: %s\n", msg.Msg)
+	case protocol.GamePreGameStatusMsg:
+		fmt.Printf("%s joined the game\n", msg.Opponent)
+	case protocol.OfferDrawMsg:
+		fmt.Println("Your opponent offers a draw")
+	case protocol.GameOverMsg:
+		fmt.Printf("Game over: you %s (%s)\n", msg.Outcome, msg.Reason)
+	case protocol.ShipSunkMsg:
+		fmt.Printf("Player %d's %v was sunk\n", msg.Player+1, game.PieceType(msg.Piece))
+	case protocol.TurnChangedMsg:
+		if replica := c.Game(); replica != nil && msg.Player == replica.You {
+			fmt.Println("Your turn")
+		}
+	case protocol.GameSnapshotMsg, protocol.CellChangedMsg:
+		if replica := c.Game(); replica != nil {
+			printGrids(replica.YourGrid, replica.OpponentGrid)
+		}
+	case protocol.PlayerJoinedMsg:
+		// Already told by GamePreGameStatusMsg
+	default:
+		fmt.Println(msg)
+	}
+}
 
-	for {
+// printGrids draws both grids, the server already hides the opponent's ships
+func printGrids(yours, opponent [][]int) {
+	fmt.Print(render.Grids([]string{"You", "Opponent"},
+		[][][]game.GridState{toGrid(yours), toGrid(opponent)},
+		render.Options{Color: true}))
+}
 
-		msg, err := protocol.ReadMsg(conn)
-		// Receiving EOF means that the connection has been closed
-		if err == io.EOF {
-			// Close conn and exit
-			conn.Close()
-			fmt.Println("Connection Closed. Bye bye.")
-			os.Exit(0)
+func readCommands(c *client.Client) {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		command, args := splitCommand(scanner.Text())
+		if command == "" {
+			continue
 		}
-		if err != nil {
-			log.Fatal(err)
+		if command == "quit" {
+			return
+		}
+		if err := run(c, command, args); err != nil {
+			fmt.Println(err)
+		}
+		if err := c.Err(); err != nil {
+			fmt.Println("Connection Closed. Bye bye.")
+			return
 		}
-		fmt.Println(msg)
 	}
 }
 
-func writeInput(conn *net.TCPConn) {
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	return strings.ToLower(line[:i]), strings.TrimSpace(line[i+1:])
+}
 
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("Enter text: ")
-	for {
-		text, err := reader.ReadString('\n')
+// run runs a command read from the standard input
+func run(c *client.Client, command, args string) error {
+	switch command {
+	case "list":
+		games, err := c.ListOpenGames()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		fmt.Println(text)
-		err = protocol.WriteMsg(conn, protocol.ConnectMsg{Username: "jonfk"})
+		if len(games) == 0 {
+			fmt.Println("No open games")
+		}
+		for _, g := range games {
+			fmt.Printf("%d\t%s\t%s\n", g.Id, g.Username, g.Rules)
+		}
+	case "create":
+		id, err := c.CreateGame(args)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created game %d, waiting for an opponent\n", id)
+	case "join":
+		id, err := strconv.Atoi(args)
+		if err != nil {
+			return fmt.Errorf("join: invalid game id %q", args)
+		}
+		opponent, err := c.Join(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Joined the game of %s\n", opponent)
+	case "place":
+		name, placement := splitCommand(args)
+		piece, err := game.ParsePieceType(name)
+		if err != nil {
+			return err
+		}
+		start, end, err := game.ParsePlacement(placement, piece)
+		if err != nil {
+			return err
+		}
+		return c.PlacePiece(piece, start, end)
+	case "fire":
+		coord, err := game.ParseCoord(args)
+		if err != nil {
+			return err
+		}
+		result, err := c.Fire(coord)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%v: %v\n", coord.Notation(), result)
+	case "chat":
+		return c.Chat(args)
+	case "state":
+		if replica := c.Game(); replica != nil {
+			printGrids(replica.YourGrid, replica.OpponentGrid)
+			return nil
+		}
+		state, err := c.GameState()
 		if err != nil {
-			log.Println(err)
+			return err
+		}
+		printGrids(state.YourGrid, state.OpponentGrid)
+	case "abandon":
+		return c.Abandon()
+	case "draw":
+		return c.OfferDraw()
+	case "accept":
+		return c.AcceptDraw()
+	default:
+		// Coordinates in standard notation such as "B7" are fired at
+		if _, err := game.ParseCoord(command); err == nil {
+			return run(c, "fire", command)
+		}
+		fmt.Println(help)
+	}
+	return nil
+}
+
+func toGrid(cells [][]int) [][]game.GridState {
+	grid := make([][]game.GridState, len(cells))
+	for y := range cells {
+		grid[y] = make([]game.GridState, len(cells[y]))
+		for x, cell := range cells[y] {
+			grid[y][x] = game.GridState(cell)
 		}
 	}
+	return grid
 }
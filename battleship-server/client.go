@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"github.com/jonfk/battleship/protocol"
+)
+
+// serverFeatures are the features offered to clients in the handshake
+var serverFeatures = protocol.Features{
+	Variants:    []string{protocol.VariantStandard, protocol.VariantHandicap},
+	Codecs:      protocol.CodecNames(),
+	Compression: protocol.CompressionNames(),
+}
+
+// client is a connection and what was agreed on in its handshake
+type client struct {
+	server *Server
+	conn   net.Conn
+	frames *protocol.FrameReader
+	writer *protocol.MsgWriter
+	// offered are the features the client can pick from, they depend on
+	// the transport
+	offered protocol.Features
+	// version is zero until the client said hello or connected
+	version  int
+	features protocol.Features
+	// session is nil until the client logged in
+	session *session
+	// keepalive is nil for clients older than protocol.KeepaliveVersion,
+	// which do not know about PongMsg
+	keepalive *protocol.Keepalive
+}
+
+func newClient(server *Server, conn net.Conn, offered protocol.Features) *client {
+	return &client{
+		server:  server,
+		conn:    conn,
+		offered: offered,
+		frames:  protocol.NewFrameReader(conn),
+		writer:  protocol.NewMsgWriter(&timeoutWriter{conn: conn, timeout: server.WriteTimeout}),
+	}
+}
+
+// handle handles a message read from the connection. It returns false when
+// the connection should be closed.
+func (c *client) handle(requestID uint32, msg protocol.BattleMsg) bool {
+	if c.keepalive != nil && c.keepalive.Received(msg) {
+		return true
+	}
+	switch msg := msg.(type) {
+	case protocol.HelloMsg:
+		return c.hello(requestID, msg)
+	case protocol.ConnectMsg:
+		c.connect(requestID, msg)
+	default:
+		if c.session == nil {
+			c.reply(requestID, protocol.ErrorMsg{Code: protocol.NotConnected, Message: "say hello or connect first"})
+			return true
+		}
+		c.server.lobby.handle(c.session, requestID, msg)
+	}
+	return true
+}
+
+// hello negotiates the connection's version and features and logs the player
+// in. It returns false when the client was rejected and the connection should
+// be closed.
+func (c *client) hello(requestID uint32, msg protocol.HelloMsg) bool {
+	if c.version != 0 {
+		c.reply(requestID, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "Hello: the handshake is already done"})
+		return true
+	}
+	welcome, err := protocol.Negotiate(msg, c.offered)
+	if err != nil {
+		log.Printf("Rejecting %v: %v\n", c.conn.RemoteAddr(), err)
+		c.reply(requestID, protocol.ErrorMsg{Code: protocol.HandshakeFailed, Message: err.Error()})
+		return false
+	}
+	c.session, err = c.server.lobby.login(c, msg.Username, welcome.Version, welcome.Features.Variants)
+	if err != nil {
+		log.Printf("Rejecting %v: %v\n", c.conn.RemoteAddr(), err)
+		c.reply(requestID, protocol.NewErrorMsg(err))
+		return false
+	}
+	c.version, c.features = welcome.Version, welcome.Features
+	// The welcome is the last message sent in JSON without compression
+	c.reply(requestID, welcome)
+	codec := protocol.NegotiatedCodec(welcome.Features)
+	compression := protocol.NegotiatedCompression(welcome.Features)
+	c.frames.Codec, c.frames.Compression = codec, compression
+	c.writer.SetCodec(codec)
+	c.writer.SetCompression(compression)
+	if welcome.Version < protocol.KeepaliveVersion {
+		// Older clients are not sent pings, they may stay silent
+		c.conn.SetReadDeadline(time.Time{})
+		return true
+	}
+	c.keepalive = protocol.NewKeepalive(c.conn, c.writer, c.server.PingInterval, c.server.PingTimeout)
+	c.keepalive.Start()
+	return true
+}
+
+// connect handles the ConnectMsg of clients that predate the handshake
+func (c *client) connect(requestID uint32, msg protocol.ConnectMsg) {
+	if c.session != nil {
+		c.reply(requestID, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "Connect: already connected as " + c.session.username})
+		return
+	}
+	session, err := c.server.lobby.login(c, msg.Username, 1, protocol.LegacyFeatures().Variants)
+	if err != nil {
+		c.reply(requestID, protocol.NewErrorMsg(err))
+		return
+	}
+	c.session = session
+	if c.version == 0 {
+		c.version, c.features = 1, protocol.LegacyFeatures()
+		// Version 1 clients are not sent pings, they may stay silent
+		c.conn.SetReadDeadline(time.Time{})
+	}
+	c.reply(requestID, protocol.OkMsg{})
+}
+
+// close stops the keepalive and logs the player out
+func (c *client) close() {
+	if c.keepalive != nil {
+		c.keepalive.Stop()
+	}
+	if c.session != nil {
+		c.server.lobby.disconnect(c.session)
+	}
+	c.conn.Close()
+}
+
+func (c *client) send(requestID uint32, msg protocol.BattleMsg) error {
+	err := c.writer.WriteMsgID(requestID, msg)
+	if err != nil {
+		log.Printf("Error sending %T to %v: %v\n", msg, c.conn.RemoteAddr(), err)
+	}
+	return err
+}
+
+// reply sends msg in answer to the request with the given ID, which is zero
+// when the client did not set one
+func (c *client) reply(requestID uint32, msg protocol.BattleMsg) {
+	c.send(requestID, msg)
+}
+
+// timeoutWriter sets a write deadline before every write so that a peer that
+// stopped reading cannot block the server
+type timeoutWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.conn.Write(p)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/protocol"
+)
+
+// gameOverMsg describes the result of a finished game from the point of view
+// of player
+func gameOverMsg(result game.Result, player game.Player) protocol.GameOverMsg {
+	msg := protocol.GameOverMsg{Reason: endReason(result.Reason)}
+	switch {
+	case result.IsDraw():
+		msg.Outcome = protocol.OutcomeDraw
+	case result.Winner == player:
+		msg.Outcome = protocol.OutcomeWon
+	default:
+		msg.Outcome = protocol.OutcomeLost
+	}
+	return msg
+}
+
+func endReason(reason game.EndReason) string {
+	switch reason {
+	case game.Resignation:
+		return protocol.ReasonResignation
+	case game.DrawAgreement:
+		return protocol.ReasonDrawAgreement
+	case game.Timeout:
+		return protocol.ReasonTimeout
+	case game.Disconnect:
+		return protocol.ReasonDisconnect
+	default:
+		return protocol.ReasonFleetSunk
+	}
+}
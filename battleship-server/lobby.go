@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/protocol"
+)
+
+// outbox delivers messages to a logged in player whatever the transport
+type outbox interface {
+	// send sends msg in reply to the request with the given ID, zero for
+	// messages pushed by the server on its own
+	send(requestID uint32, msg protocol.BattleMsg) error
+}
+
+// session is a logged in player
+type session struct {
+	out      outbox
+	username string
+	// version is the protocol version spoken by the player
+	version int
+	// variants are the game variants agreed on in the handshake
+	variants []string
+	// game is the game the player created or joined, nil when none
+	game   *serverGame
+	player game.Player
+
+	// sendMu is held while the queued messages are sent so that they
+	// arrive in order
+	sendMu sync.Mutex
+	mu     sync.Mutex
+	queue  []queued
+}
+
+// plays reports whether the player agreed to the variant
+func (s *session) plays(variant string) bool {
+	for _, v := range s.variants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// queued is a message waiting to be sent to a session
+type queued struct {
+	requestID uint32
+	msg       protocol.BattleMsg
+}
+
+// flush sends the queued messages. It returns once every message queued
+// before the call was sent, by this goroutine or another one.
+func (s *session) flush() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	for {
+		s.mu.Lock()
+		msgs := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		if len(msgs) == 0 {
+			return
+		}
+		for _, m := range msgs {
+			s.out.send(m.requestID, m.msg)
+		}
+	}
+}
+
+type serverGame struct {
+	id      int
+	game    *game.Game
+	players [2]*session
+	// seq is the sequence number of the last update
+	seq int
+}
+
+// lobby holds the players and games of the server. Every request is handled
+// under the lobby's lock. The messages are queued while it is held, so that
+// they keep their order, and sent once it is released, so that a player slow
+// to read does not block the others.
+type lobby struct {
+	mu         sync.Mutex
+	sessions   map[string]*session
+	games      map[int]*serverGame
+	nextGameID int
+	// unsent are the sessions messages were queued for since the lock was
+	// taken
+	unsent []*session
+}
+
+func newLobby() *lobby {
+	return &lobby{sessions: make(map[string]*session), games: make(map[int]*serverGame), nextGameID: 1}
+}
+
+// unlock releases the lobby's lock then sends the messages queued while it
+// was held
+func (l *lobby) unlock() {
+	unsent := l.unsent
+	l.unsent = nil
+	l.mu.Unlock()
+	for _, s := range unsent {
+		s.flush()
+	}
+}
+
+// send queues msg for s, it is sent once the lock is released
+func (l *lobby) send(s *session, requestID uint32, msg protocol.BattleMsg) {
+	s.mu.Lock()
+	s.queue = append(s.queue, queued{requestID, msg})
+	s.mu.Unlock()
+	l.unsent = append(l.unsent, s)
+}
+
+// update sends the next update of the game to the players receiving updates
+func (l *lobby) update(sg *serverGame, build func(seq int) protocol.BattleMsg) {
+	sg.seq++
+	msg := build(sg.seq)
+	for _, s := range sg.players {
+		if s != nil && s.version >= protocol.UpdatesVersion {
+			l.send(s, 0, msg)
+		}
+	}
+}
+
+// login creates the session of a player speaking the given protocol version
+// and playing the given variants
+func (l *lobby) login(out outbox, username string, version int, variants []string) (*session, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if username == "" {
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "login: the username is empty"}
+	}
+	// Usernames are written in the lines of the text protocol
+	if strings.IndexFunc(username, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: fmt.Sprintf("login: %q contains spaces or control characters", username)}
+	}
+	if _, ok := l.sessions[username]; ok {
+		return nil, protocol.ErrorMsg{Code: protocol.UsernameTaken, Message: fmt.Sprintf("login: %s is already connected", username)}
+	}
+	s := &session{out: out, username: username, version: version, variants: variants}
+	l.sessions[username] = s
+	return s, nil
+}
+
+// disconnect removes the session of a player who left. A game in progress is
+// lost by the player who left.
+func (l *lobby) disconnect(s *session) {
+	l.mu.Lock()
+	defer l.unlock()
+	if l.sessions[s.username] == s {
+		delete(l.sessions, s.username)
+	}
+	if s.game != nil {
+		l.forfeit(s, game.Disconnect)
+	}
+}
+
+// handle answers a request of a logged in player. Every request gets exactly
+// one reply, an ErrorMsg when it failed.
+func (l *lobby) handle(s *session, requestID uint32, msg protocol.BattleMsg) {
+	l.mu.Lock()
+	defer l.unlock()
+	reply, err := l.request(s, msg)
+	if err != nil {
+		reply = protocol.NewErrorMsg(err)
+	}
+	l.send(s, requestID, reply)
+}
+
+func (l *lobby) request(s *session, msg protocol.BattleMsg) (protocol.BattleMsg, error) {
+	switch msg := msg.(type) {
+	case protocol.PingMsg:
+		// Clients without a keepalive get an Ok echo
+		return protocol.OkMsg{}, nil
+	case protocol.RequestOpenGamesListMsg:
+		return l.openGames(), nil
+	case protocol.CreateGameMsg:
+		return l.create(s, msg)
+	case protocol.JoinGameMsg:
+		return l.join(s, msg)
+	case protocol.AcceptGameMsg, protocol.RejectGameMsg:
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "players joining a game are accepted automatically"}
+	}
+
+	if s.game == nil {
+		return nil, protocol.ErrorMsg{Code: protocol.NotInGame, Message: fmt.Sprintf("%T: %s is not in a game", msg, s.username)}
+	}
+	sg := s.game
+	opponent := sg.players[s.player.Opponent()]
+	switch msg := msg.(type) {
+	case protocol.GameSetPieceMsg:
+		err := sg.game.SetPiece(s.player, toCoord(msg.Start), toCoord(msg.End), game.PieceType(msg.Piece))
+		if err != nil {
+			return nil, err
+		}
+		if sg.game.IsReadyToStart() {
+			for _, player := range sg.players {
+				if player.version >= protocol.UpdatesVersion {
+					l.send(player, 0, snapshot(sg, player.player))
+				} else {
+					l.send(player, 0, gameState(sg, player.player))
+				}
+			}
+		}
+		return protocol.OkMsg{}, nil
+	case protocol.GameMoveMsg:
+		if !sg.game.IsReadyToStart() {
+			return nil, protocol.ErrorMsg{Code: protocol.GameNotStarted, Message: "GameMove: the fleets are not placed yet"}
+		}
+		coord := game.Coord{X: msg.X, Y: msg.Y}
+		err := sg.game.Move(s.player, coord)
+		if err != nil {
+			return nil, err
+		}
+		shot := sg.game.History[len(sg.game.History)-1]
+		if opponent.version < protocol.UpdatesVersion {
+			l.send(opponent, 0, protocol.GameMoveMsg{Player: int(s.player), X: coord.X, Y: coord.Y})
+		}
+		l.moveUpdates(sg, shot)
+		l.finishIfOver(sg)
+		return protocol.OkMsg{Ok: shotResult(shot.Result)}, nil
+	case protocol.RequestGameStateMsg:
+		return gameState(sg, s.player), nil
+	case protocol.RequestSnapshotMsg:
+		return snapshot(sg, s.player), nil
+	case protocol.AbandonGameMsg:
+		l.forfeit(s, game.Resignation)
+		return protocol.OkMsg{}, nil
+	case protocol.OfferDrawMsg:
+		if opponent == nil {
+			return nil, protocol.ErrorMsg{Code: protocol.GameNotStarted, Message: "OfferDraw: nobody joined the game yet"}
+		}
+		err := sg.game.OfferDraw(s.player)
+		if err != nil {
+			return nil, err
+		}
+		l.send(opponent, 0, msg)
+		return protocol.OkMsg{}, nil
+	case protocol.AcceptDrawMsg:
+		err := sg.game.AcceptDraw(s.player)
+		if err != nil {
+			return nil, err
+		}
+		l.finishIfOver(sg)
+		return protocol.OkMsg{}, nil
+	case protocol.ChatMessageMsg:
+		if opponent == nil {
+			return nil, protocol.ErrorMsg{Code: protocol.GameNotStarted, Message: "ChatMessage: nobody joined the game yet"}
+		}
+		l.send(opponent, 0, msg)
+		return protocol.OkMsg{}, nil
+	}
+	return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: fmt.Sprintf("%T is not a request", msg)}
+}
+
+func (l *lobby) openGames() protocol.OpenGamesListMsg {
+	list := protocol.OpenGamesListMsg{Games: []protocol.Game{}}
+	for _, sg := range l.games {
+		if sg.players[game.Player2] != nil {
+			continue
+		}
+		open := protocol.Game{Id: sg.id, Username: sg.players[game.Player1].username}
+		if !sg.game.Rules.Equal(game.StandardRules()) {
+			open.Rules = sg.game.Rules.String()
+		}
+		list.Games = append(list.Games, open)
+	}
+	sort.Slice(list.Games, func(i, j int) bool { return list.Games[i].Id < list.Games[j].Id })
+	return list
+}
+
+func (l *lobby) create(s *session, msg protocol.CreateGameMsg) (protocol.BattleMsg, error) {
+	if s.game != nil {
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: fmt.Sprintf("CreateGame: %s is already in game %d", s.username, s.game.id)}
+	}
+	rules := game.StandardRules()
+	if msg.Rules != "" {
+		var err error
+		rules, err = game.ParseRules(msg.Rules)
+		if err != nil {
+			return nil, protocol.ErrorMsg{Code: protocol.InvalidRules, Message: err.Error()}
+		}
+	}
+	if rules.HasHandicaps() && !s.plays(protocol.VariantHandicap) {
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidRules, Message: fmt.Sprintf("CreateGame: %s did not agree to the %s variant", s.username, protocol.VariantHandicap)}
+	}
+	g, err := game.NewGameWithRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	g.SetPlayer(game.Player1, s.username)
+	sg := &serverGame{id: l.nextGameID, game: g}
+	l.nextGameID++
+	sg.players[game.Player1] = s
+	s.game, s.player = sg, game.Player1
+	l.games[sg.id] = sg
+	return protocol.GamePreGameStatusMsg{Id: sg.id}, nil
+}
+
+func (l *lobby) join(s *session, msg protocol.JoinGameMsg) (protocol.BattleMsg, error) {
+	if s.game != nil {
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: fmt.Sprintf("JoinGame: %s is already in game %d", s.username, s.game.id)}
+	}
+	sg, ok := l.games[msg.Id]
+	if !ok || sg.players[game.Player2] != nil {
+		return nil, protocol.ErrorMsg{Code: protocol.GameNotFound, Message: fmt.Sprintf("JoinGame: there is no open game %d", msg.Id)}
+	}
+	if sg.game.Rules.HasHandicaps() && !s.plays(protocol.VariantHandicap) {
+		return nil, protocol.ErrorMsg{Code: protocol.InvalidRules, Message: fmt.Sprintf("JoinGame: %s did not agree to the %s variant", s.username, protocol.VariantHandicap)}
+	}
+	creator := sg.players[game.Player1]
+	sg.game.SetPlayer(game.Player2, s.username)
+	sg.players[game.Player2] = s
+	s.game, s.player = sg, game.Player2
+	l.send(creator, 0, protocol.GamePreGameStatusMsg{Id: sg.id, Opponent: s.username})
+	l.update(sg, func(seq int) protocol.BattleMsg {
+		return protocol.PlayerJoinedMsg{Seq: seq, Player: int(game.Player2), Username: s.username}
+	})
+	return protocol.GamePreGameStatusMsg{Id: sg.id, Opponent: creator.username}, nil
+}
+
+// moveUpdates sends the updates following a shot: the cell shot, the ship
+// sunk if any and the turn when it changed
+func (l *lobby) moveUpdates(sg *serverGame, shot game.Shot) {
+	target := shot.Player.Opponent()
+	grids := [2][][]game.GridState{sg.game.Player1Grid, sg.game.Player2Grid}
+	l.update(sg, func(seq int) protocol.BattleMsg {
+		return protocol.CellChangedMsg{Seq: seq, Player: int(target), X: shot.Coord.X, Y: shot.Coord.Y,
+			State: int(grids[target][shot.Coord.Y][shot.Coord.X])}
+	})
+	if shot.Result == game.Sunk {
+		piece, _ := sg.game.PieceAt(target, shot.Coord)
+		l.update(sg, func(seq int) protocol.BattleMsg {
+			return protocol.ShipSunkMsg{Seq: seq, Player: int(target), Piece: int(piece.Type),
+				Start: protocol.Coord{X: piece.Start.X, Y: piece.Start.Y}, End: protocol.Coord{X: piece.End.X, Y: piece.End.Y}}
+		})
+	}
+	if sg.game.CurrentTurn != shot.Player {
+		l.update(sg, func(seq int) protocol.BattleMsg {
+			return protocol.TurnChangedMsg{Seq: seq, Player: int(sg.game.CurrentTurn)}
+		})
+	}
+}
+
+// forfeit makes the player lose the game for the reason given. A game nobody
+// joined yet is simply removed.
+func (l *lobby) forfeit(s *session, reason game.EndReason) {
+	sg := s.game
+	if sg.players[s.player.Opponent()] == nil {
+		s.game = nil
+		delete(l.games, sg.id)
+		return
+	}
+	sg.game.Forfeit(s.player, reason)
+	l.finishIfOver(sg)
+}
+
+// finishIfOver tells both players how the game ended and removes it once it
+// is over
+func (l *lobby) finishIfOver(sg *serverGame) {
+	result, over := sg.game.Result()
+	if !over {
+		return
+	}
+	for player, s := range sg.players {
+		if s == nil {
+			continue
+		}
+		l.send(s, 0, gameOverMsg(result, game.Player(player)))
+		s.game = nil
+	}
+	delete(l.games, sg.id)
+}
+
+// gameState is the game seen by player, the opponent's ships that were not
+// hit are hidden
+func gameState(sg *serverGame, player game.Player) protocol.GameStateMsg {
+	g := sg.game
+	grids := [2][][]game.GridState{g.Player1Grid, g.Player2Grid}
+	msg := protocol.GameStateMsg{
+		YourGrid:     toCells(grids[player], false),
+		OpponentGrid: toCells(grids[player.Opponent()], true),
+	}
+	if g.Player1 != nil {
+		msg.P1 = *g.Player1
+	}
+	if g.Player2 != nil {
+		msg.P2 = *g.Player2
+	}
+	return msg
+}
+
+// snapshot is the game seen by player along with the sequence number of the
+// last update
+func snapshot(sg *serverGame, player game.Player) protocol.GameSnapshotMsg {
+	state := gameState(sg, player)
+	return protocol.GameSnapshotMsg{
+		Seq:          sg.seq,
+		Id:           sg.id,
+		You:          int(player),
+		P1:           state.P1,
+		P2:           state.P2,
+		Turn:         int(sg.game.CurrentTurn),
+		YourGrid:     state.YourGrid,
+		OpponentGrid: state.OpponentGrid,
+	}
+}
+
+func toCells(grid [][]game.GridState, hideShips bool) [][]int {
+	cells := make([][]int, len(grid))
+	for y := range grid {
+		cells[y] = make([]int, len(grid[y]))
+		for x, state := range grid[y] {
+			if hideShips && state == game.ShipGrid {
+				state = game.EmptyGrid
+			}
+			cells[y][x] = int(state)
+		}
+	}
+	return cells
+}
+
+func toCoord(coord protocol.Coord) game.Coord {
+	return game.Coord{X: coord.X, Y: coord.Y}
+}
+
+func shotResult(result game.ShotResult) string {
+	switch result {
+	case game.Hit:
+		return "hit"
+	case game.Sunk:
+		return "sunk"
+	default:
+		return "miss"
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/protocol"
+)
+
+type sent struct {
+	requestID uint32
+	msg       protocol.BattleMsg
+}
+
+// recorder is an outbox keeping the messages sent to it
+type recorder struct {
+	msgs []sent
+}
+
+func (r *recorder) send(requestID uint32, msg protocol.BattleMsg) error {
+	r.msgs = append(r.msgs, sent{requestID, msg})
+	return nil
+}
+
+// take returns the messages sent since the last call
+func (r *recorder) take() []sent {
+	msgs := r.msgs
+	r.msgs = nil
+	return msgs
+}
+
+func login(t *testing.T, l *lobby, username string, version int) (*session, *recorder) {
+	out := &recorder{}
+	s, err := l.login(out, username, version, serverFeatures.Variants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, out
+}
+
+// request sends msg and returns its reply, checking that it is the only
+// message sent to the player
+func request(t *testing.T, l *lobby, s *session, out *recorder, msg protocol.BattleMsg) protocol.BattleMsg {
+	l.handle(s, 7, msg)
+	msgs := out.take()
+	if len(msgs) != 1 || msgs[0].requestID != 7 {
+		t.Fatalf("%T: expected a single reply with request ID 7 but got %#v", msg, msgs)
+	}
+	return msgs[0].msg
+}
+
+func expectCode(t *testing.T, reply protocol.BattleMsg, code protocol.ErrorCode) {
+	errMsg, ok := reply.(protocol.ErrorMsg)
+	if !ok || errMsg.Code != code {
+		t.Errorf("expected an error %v but got %#v", code, reply)
+	}
+}
+
+// startGame creates a game between players speaking the given protocol
+// version with a single patrol boat for each player in the top left corner
+func startGame(t *testing.T, l *lobby, version int) (p1, p2 *session, out1, out2 *recorder) {
+	p1, out1 = login(t, l, "jonfk", version)
+	p2, out2 = login(t, l, "gery", version)
+	reply := request(t, l, p1, out1, protocol.CreateGameMsg{Rules: "4x4 fleet=PatrolBoat"})
+	status, ok := reply.(protocol.GamePreGameStatusMsg)
+	if !ok {
+		t.Fatalf("CreateGame: unexpected reply %#v", reply)
+	}
+	reply = request(t, l, p2, out2, protocol.JoinGameMsg{Id: status.Id})
+	if reply != (protocol.GamePreGameStatusMsg{Id: status.Id, Opponent: "jonfk"}) {
+		t.Errorf("JoinGame: unexpected reply %#v", reply)
+	}
+	if msgs := out1.take(); len(msgs) == 0 || msgs[0].msg != (protocol.GamePreGameStatusMsg{Id: status.Id, Opponent: "gery"}) {
+		t.Errorf("creator was not told about the opponent: %#v", msgs)
+	}
+	out2.take()
+	for _, player := range []struct {
+		s   *session
+		out *recorder
+	}{{p1, out1}, {p2, out2}} {
+		l.handle(player.s, 0, protocol.GameSetPieceMsg{Piece: int(game.PatrolBoat), Start: protocol.Coord{X: 0, Y: 0}, End: protocol.Coord{X: 1, Y: 0}})
+	}
+	// The second placement starts the game
+	for _, out := range []*recorder{out1, out2} {
+		msgs := out.take()
+		started := false
+		for _, m := range msgs {
+			switch m.msg.(type) {
+			case protocol.GameStateMsg, protocol.GameSnapshotMsg:
+				started = true
+			}
+		}
+		if !started {
+			t.Fatalf("expected the game state once the fleets are placed but got %#v", msgs)
+		}
+	}
+	return p1, p2, out1, out2
+}
+
+func TestLobbyGame(t *testing.T) {
+	l := newLobby()
+	p1, p2, out1, out2 := startGame(t, l, 2)
+
+	expectCode(t, request(t, l, p2, out2, protocol.GameMoveMsg{X: 0, Y: 0}), protocol.NotYourTurn)
+	if reply := request(t, l, p1, out1, protocol.GameMoveMsg{X: 0, Y: 0}); reply != (protocol.OkMsg{Ok: "hit"}) {
+		t.Errorf("unexpected reply %#v", reply)
+	}
+	if msgs := out2.take(); len(msgs) != 1 || msgs[0].msg != (protocol.GameMoveMsg{Player: 0, X: 0, Y: 0}) {
+		t.Errorf("opponent was not told about the move: %#v", msgs)
+	}
+
+	state := request(t, l, p2, out2, protocol.RequestGameStateMsg{}).(protocol.GameStateMsg)
+	if state.YourGrid[0][0] != int(game.HitGrid) || state.YourGrid[0][1] != int(game.ShipGrid) {
+		t.Errorf("own ships should be visible: %v", state.YourGrid)
+	}
+	if state.OpponentGrid[0][0] != int(game.EmptyGrid) {
+		t.Errorf("opponent ships should be hidden: %v", state.OpponentGrid)
+	}
+
+	request(t, l, p2, out2, protocol.GameMoveMsg{X: 3, Y: 3})
+	out1.take()
+	l.handle(p1, 7, protocol.GameMoveMsg{X: 1, Y: 0})
+	msgs := out1.take()
+	if len(msgs) != 2 || msgs[0].msg != (protocol.GameOverMsg{Outcome: protocol.OutcomeWon, Reason: protocol.ReasonFleetSunk}) ||
+		msgs[1] != (sent{7, protocol.OkMsg{Ok: "sunk"}}) {
+		t.Errorf("unexpected messages for the winner %#v", msgs)
+	}
+	if msgs := out2.take(); msgs[len(msgs)-1].msg != (protocol.GameOverMsg{Outcome: protocol.OutcomeLost, Reason: protocol.ReasonFleetSunk}) {
+		t.Errorf("unexpected messages for the loser %#v", msgs)
+	}
+	if len(l.games) != 0 || p1.game != nil || p2.game != nil {
+		t.Error("finished game was not removed")
+	}
+	expectCode(t, request(t, l, p1, out1, protocol.RequestGameStateMsg{}), protocol.NotInGame)
+}
+
+func TestLobbyErrors(t *testing.T) {
+	l := newLobby()
+	s, out := login(t, l, "jonfk", 2)
+	if _, err := l.login(&recorder{}, "jonfk", 2, nil); protocol.NewErrorMsg(err).Code != protocol.UsernameTaken {
+		t.Errorf("expected UsernameTaken but got %v", err)
+	}
+	for _, username := range []string{"", "jon fk", "jonfk\r\nOK", "jon\x00"} {
+		if _, err := l.login(&recorder{}, username, 2, nil); protocol.NewErrorMsg(err).Code != protocol.InvalidMessage {
+			t.Errorf("expected InvalidMessage for %q but got %v", username, err)
+		}
+	}
+	expectCode(t, request(t, l, s, out, protocol.JoinGameMsg{Id: 42}), protocol.GameNotFound)
+	expectCode(t, request(t, l, s, out, protocol.CreateGameMsg{Rules: "0x0"}), protocol.InvalidRules)
+	// Boards larger than the cap are refused
+	oversized := fmt.Sprintf("%dx10", game.MaxBoardSize+1)
+	expectCode(t, request(t, l, s, out, protocol.CreateGameMsg{Rules: oversized}), protocol.InvalidRules)
+	expectCode(t, request(t, l, s, out, protocol.GameMoveMsg{}), protocol.NotInGame)
+	expectCode(t, request(t, l, s, out, protocol.AcceptGameMsg{Id: 1}), protocol.InvalidMessage)
+
+	request(t, l, s, out, protocol.CreateGameMsg{})
+	expectCode(t, request(t, l, s, out, protocol.GameMoveMsg{}), protocol.GameNotStarted)
+	list := request(t, l, s, out, protocol.RequestOpenGamesListMsg{})
+	if games := list.(protocol.OpenGamesListMsg).Games; len(games) != 1 || games[0] != (protocol.Game{Id: 1, Username: "jonfk"}) {
+		t.Errorf("unexpected open games %#v", games)
+	}
+	// Leaving an open game removes it
+	l.disconnect(s)
+	if len(l.games) != 0 || len(l.sessions) != 0 {
+		t.Error("disconnected player is still in the lobby")
+	}
+}
+
+func TestLobbyVariants(t *testing.T) {
+	l := newLobby()
+	p1, out1 := login(t, l, "jonfk", protocol.UpdatesVersion)
+	out2 := &recorder{}
+	p2, err := l.login(out2, "gery", protocol.UpdatesVersion, []string{protocol.VariantStandard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Handicaps are refused to players who only agreed to the standard
+	// variant
+	expectCode(t, request(t, l, p2, out2, protocol.CreateGameMsg{Rules: "10x10 p1.shots=1"}), protocol.InvalidRules)
+	request(t, l, p1, out1, protocol.CreateGameMsg{Rules: "10x10 p1.shots=1"})
+	expectCode(t, request(t, l, p2, out2, protocol.JoinGameMsg{Id: 1}), protocol.InvalidRules)
+	if reply := request(t, l, p2, out2, protocol.CreateGameMsg{Rules: "8x8"}); reply != (protocol.GamePreGameStatusMsg{Id: 2}) {
+		t.Errorf("unexpected reply %#v", reply)
+	}
+}
+
+func TestLobbyDisconnect(t *testing.T) {
+	l := newLobby()
+	p1, _, _, out2 := startGame(t, l, 2)
+	l.disconnect(p1)
+	msgs := out2.take()
+	if len(msgs) != 1 || msgs[0].msg != (protocol.GameOverMsg{Outcome: protocol.OutcomeWon, Reason: protocol.ReasonDisconnect}) {
+		t.Errorf("opponent was not told about the disconnection: %#v", msgs)
+	}
+	if _, err := l.login(&recorder{}, "jonfk", 2, nil); err != nil {
+		t.Errorf("username was not freed: %v", err)
+	}
+}
+
+// blocked is an outbox whose sends wait until it is released
+type blocked chan struct{}
+
+func (b blocked) send(requestID uint32, msg protocol.BattleMsg) error {
+	<-b
+	return nil
+}
+
+func TestSlowPlayerDoesNotBlockLobby(t *testing.T) {
+	l := newLobby()
+	p1, p2, out1, _ := startGame(t, l, 2)
+	stuck := make(blocked)
+	p2.out = stuck
+	done := make(chan struct{})
+	go func() {
+		l.handle(p1, 7, protocol.ChatMessageMsg{Msg: "are you there?"})
+		close(done)
+	}()
+
+	// Other players are served while the chat waits for the opponent
+	s, out := login(t, l, "dmitri", 2)
+	served := make(chan struct{})
+	go func() {
+		l.handle(s, 7, protocol.RequestOpenGamesListMsg{})
+		close(served)
+	}()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("lobby blocked by a player who does not read")
+	}
+	if msgs := out.take(); len(msgs) != 1 {
+		t.Errorf("expected the open games but got %#v", msgs)
+	}
+
+	close(stuck)
+	<-done
+	if msgs := out1.take(); len(msgs) != 1 || msgs[0] != (sent{7, protocol.OkMsg{}}) {
+		t.Errorf("unexpected reply to the chat %#v", msgs)
+	}
+}
+
+// dial connects a client speaking the given protocol version to the server
+func dial(t *testing.T, server *Server, username string, version int) (net.Conn, *protocol.FrameReader, *protocol.MsgWriter) {
+	conn, serverConn := net.Pipe()
+	go server.handleRequest(serverConn, serverFeatures)
+	frames, writer := protocol.NewFrameReader(conn), protocol.NewMsgWriter(conn)
+	writer.WriteMsg(protocol.HelloMsg{Version: version, Username: username, Features: protocol.LegacyFeatures()})
+	if msg, err := frames.ReadMsg(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := msg.(protocol.WelcomeMsg); !ok {
+		t.Fatalf("expected a welcome but got %#v", msg)
+	}
+	return conn, frames, writer
+}
+
+func TestSilentClientForfeits(t *testing.T) {
+	server := &Server{PingInterval: 10 * time.Millisecond, PingTimeout: 50 * time.Millisecond}
+	conn1, frames1, writer1 := dial(t, server, "jonfk", protocol.ProtocolVersion)
+	defer conn1.Close()
+	conn2, frames2, writer2 := dial(t, server, "gery", protocol.ProtocolVersion)
+	defer conn2.Close()
+
+	// The first client keeps answering pings while the second one goes
+	// silent once it joined the game
+	msgs := make(chan protocol.BattleMsg, 10)
+	go func() {
+		for {
+			msg, err := frames1.ReadMsg()
+			if err != nil {
+				close(msgs)
+				return
+			}
+			if _, ok := msg.(protocol.PingMsg); ok {
+				writer1.WriteMsg(protocol.PongMsg{})
+				continue
+			}
+			msgs <- msg
+		}
+	}()
+	writer1.WriteMsg(protocol.CreateGameMsg{})
+	if msg := <-msgs; msg != (protocol.GamePreGameStatusMsg{Id: 1}) {
+		t.Fatalf("unexpected reply %#v", msg)
+	}
+	writer2.WriteMsg(protocol.JoinGameMsg{Id: 1})
+	for {
+		msg, err := frames2.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg.(protocol.GamePreGameStatusMsg); ok {
+			break
+		}
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				t.Fatal("connection of the live client was closed")
+			}
+			if msg == (protocol.GameOverMsg{Outcome: protocol.OutcomeWon, Reason: protocol.ReasonDisconnect}) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("silent client was not disconnected")
+		}
+	}
+}
+
+func TestOldClientsNotPinged(t *testing.T) {
+	server := &Server{PingInterval: 10 * time.Millisecond, PingTimeout: 50 * time.Millisecond, HandshakeTimeout: 50 * time.Millisecond}
+	for _, version := range []int{1, protocol.KeepaliveVersion - 1} {
+		conn, frames, writer := dial(t, server, fmt.Sprintf("v%d", version), version)
+		defer conn.Close()
+		// Silent for longer than the timeouts
+		time.Sleep(150 * time.Millisecond)
+		writer.WriteMsg(protocol.RequestOpenGamesListMsg{})
+		msg, err := frames.ReadMsg()
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if _, ok := msg.(protocol.OpenGamesListMsg); !ok {
+			t.Errorf("version %d: expected the open games but got %#v", version, msg)
+		}
+	}
+}
+
+// replica follows the updates sent to a player speaking version 3
+func replica(t *testing.T, r *recorder, g *protocol.GameReplica) *protocol.GameReplica {
+	for _, m := range r.take() {
+		if snapshot, ok := m.msg.(protocol.GameSnapshotMsg); ok && g == nil {
+			g = protocol.NewGameReplica(snapshot)
+			continue
+		}
+		if g == nil || !protocol.IsUpdate(m.msg) {
+			continue
+		}
+		if err := g.Apply(m.msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g == nil {
+		t.Fatal("no snapshot received")
+	}
+	return g
+}
+
+func TestLobbyUpdates(t *testing.T) {
+	l := newLobby()
+	p1, out1 := login(t, l, "jonfk", protocol.UpdatesVersion)
+	p2, out2 := login(t, l, "gery", protocol.UpdatesVersion)
+	request(t, l, p1, out1, protocol.CreateGameMsg{Rules: "4x4 fleet=PatrolBoat"})
+	l.handle(p2, 7, protocol.JoinGameMsg{Id: 1})
+	for _, out := range []*recorder{out1, out2} {
+		joined := false
+		for _, m := range out.take() {
+			joined = joined || m.msg == (protocol.PlayerJoinedMsg{Seq: 1, Player: 1, Username: "gery"})
+		}
+		if !joined {
+			t.Error("expected a PlayerJoined update")
+		}
+	}
+	for _, s := range []*session{p1, p2} {
+		l.handle(s, 0, protocol.GameSetPieceMsg{Piece: int(game.PatrolBoat), Start: protocol.Coord{X: 0, Y: 0}, End: protocol.Coord{X: 1, Y: 0}})
+	}
+	g1, g2 := replica(t, out1, nil), replica(t, out2, nil)
+	if g1.Seq != 1 || g1.You != 0 || g2.You != 1 || g1.Players != [2]string{"jonfk", "gery"} {
+		t.Errorf("unexpected snapshot %#v", g1)
+	}
+
+	l.handle(p1, 7, protocol.GameMoveMsg{X: 0, Y: 0})
+	for _, m := range out2.msgs {
+		if _, ok := m.msg.(protocol.GameMoveMsg); ok {
+			t.Error("GameMove sent to a player receiving updates")
+		}
+	}
+	g1, g2 = replica(t, out1, g1), replica(t, out2, g2)
+	l.handle(p2, 7, protocol.GameMoveMsg{X: 3, Y: 3})
+	g1, g2 = replica(t, out1, g1), replica(t, out2, g2)
+	if g1.OpponentGrid[0][0] != int(game.HitGrid) || g2.YourGrid[0][0] != int(game.HitGrid) || g2.OpponentGrid[3][3] != int(game.EmptyHitGrid) {
+		t.Errorf("shots missing from the replicas %v %v", g1.OpponentGrid, g2.OpponentGrid)
+	}
+
+	// The replicas match the snapshots of the server
+	for _, p := range []struct {
+		s   *session
+		out *recorder
+		g   *protocol.GameReplica
+	}{{p1, out1, g1}, {p2, out2, g2}} {
+		snapshot := request(t, l, p.s, p.out, protocol.RequestSnapshotMsg{}).(protocol.GameSnapshotMsg)
+		if !reflect.DeepEqual(protocol.NewGameReplica(snapshot), p.g) {
+			t.Errorf("replica %#v differs from snapshot %#v", p.g, snapshot)
+		}
+	}
+
+	l.handle(p1, 7, protocol.GameMoveMsg{X: 1, Y: 0})
+	g2 = replica(t, out2, g2)
+	if len(g2.Sunk[1]) != 1 || g2.Sunk[1][0].Piece != int(game.PatrolBoat) {
+		t.Errorf("expected the patrol boat sunk but got %#v", g2.Sunk)
+	}
+}
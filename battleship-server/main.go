@@ -1,8 +1,43 @@
 package main
 
-import ()
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/jonfk/battleship/protocol"
+	"github.com/jonfk/battleship/protocol/tlsutil"
+)
 
 func main() {
-	server := Server{Host: DEFAULT_CONN_HOST, Port: DEFAULT_CONN_PORT}
+	server := &Server{Host: DEFAULT_CONN_HOST, Port: DEFAULT_CONN_PORT}
+	flag.DurationVar(&server.PingInterval, "ping-interval", protocol.DefaultPingInterval, "time between pings sent to clients")
+	flag.DurationVar(&server.PingTimeout, "ping-timeout", protocol.DefaultPingTimeout, "time after which a silent client is disconnected")
+	flag.StringVar(&server.WebSocketPort, "ws-port", "", "port of the WebSocket listener at /ws, disabled when empty")
+	flag.StringVar(&server.TextPort, "text-port", "", "port of the text protocol listener for nc and telnet, disabled when empty")
+	flag.StringVar(&server.HTTPPort, "http-port", "", "port of the REST API at /api, disabled when empty")
+	flag.DurationVar(&server.SessionTimeout, "session-timeout", DEFAULT_SESSION_TIMEOUT, "time after which an idle REST API session is logged out")
+	certFile := flag.String("tls-cert", "", "PEM certificate of the server, TLS is used when set along with -tls-key")
+	keyFile := flag.String("tls-key", "", "PEM private key of the server")
+	genCert := flag.String("gen-cert", "", "comma separated hosts to write a self-signed development certificate for to -tls-cert and -tls-key before starting")
+	flag.Parse()
+
+	if *genCert != "" {
+		if *certFile == "" || *keyFile == "" {
+			log.Fatal("-gen-cert needs -tls-cert and -tls-key")
+		}
+		err := tlsutil.WriteSelfSigned(*certFile, *keyFile, strings.Split(*genCert, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Wrote a self-signed certificate for %s to %s\n", *genCert, *certFile)
+	}
+	if *certFile != "" || *keyFile != "" {
+		config, err := tlsutil.ServerConfig(*certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.TLSConfig = config
+	}
 	server.Run()
 }
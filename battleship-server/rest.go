@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonfk/battleship/protocol"
+)
+
+const (
+	// HTTP sessions without any request for this long are logged out
+	DEFAULT_SESSION_TIMEOUT = 5 * time.Minute
+	// Long polls for events wait at most this long
+	MAX_POLL_TIMEOUT = time.Minute
+	// HTTP sessions keep at most this many events, the oldest are dropped
+	MAX_QUEUED_EVENTS = 256
+	// Request bodies larger than this are rejected
+	MAX_BODY_SIZE = 1 << 16
+)
+
+// The REST API maps HTTP requests to the messages handled by the lobby.
+// Request bodies and replies are the JSON payloads of the messages, errors
+// are ErrorMsg payloads. Players log in for a token sent in the
+// Authorization header as "Bearer <token>" and poll for the messages the
+// server pushes.
+
+// event is a message pushed by the server to an HTTP session
+type event struct {
+	Type string             `json:"type"`
+	Msg  protocol.BattleMsg `json:"msg"`
+}
+
+// httpSession is a player logged in through the REST API
+type httpSession struct {
+	token   string
+	session *session
+
+	// requests are handled one at a time so that reply holds the reply of
+	// the current one
+	requestMu sync.Mutex
+
+	mu       sync.Mutex
+	reply    protocol.BattleMsg
+	events   []event
+	ready    chan struct{}
+	lastSeen time.Time
+}
+
+// send implements outbox, replies are handed to the current request and
+// pushes queued as events
+func (h *httpSession) send(requestID uint32, msg protocol.BattleMsg) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if requestID != 0 {
+		h.reply = msg
+		return nil
+	}
+	if len(h.events) == MAX_QUEUED_EVENTS {
+		h.events = h.events[1:]
+	}
+	h.events = append(h.events, event{Type: msg.MsgType().String(), Msg: msg})
+	select {
+	case h.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// poll returns the queued events, waiting up to timeout for one. The session
+// is seen until the poll returns.
+func (h *httpSession) poll(timeout time.Duration) []event {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	defer func() {
+		h.mu.Lock()
+		h.lastSeen = time.Now()
+		h.mu.Unlock()
+	}()
+	for {
+		h.mu.Lock()
+		events := h.events
+		h.events = nil
+		h.mu.Unlock()
+		if len(events) > 0 {
+			return events
+		}
+		select {
+		case <-h.ready:
+		case <-timer.C:
+			return []event{}
+		}
+	}
+}
+
+// restAPI serves the REST API on top of the lobby
+type restAPI struct {
+	server *Server
+
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+func newRestAPI(server *Server) *restAPI {
+	return &restAPI{server: server, sessions: make(map[string]*httpSession)}
+}
+
+func (server *Server) runHTTP() {
+	api := newRestAPI(server)
+	go api.expire(server.SessionTimeout)
+	httpServer := &http.Server{
+		Addr:              server.Host + ":" + server.HTTPPort,
+		Handler:           api,
+		TLSConfig:         server.TLSConfig,
+		ReadHeaderTimeout: server.HandshakeTimeout,
+		IdleTimeout:       server.PingTimeout,
+	}
+	var err error
+	if server.TLSConfig != nil {
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	log.Println("Error listening for HTTP: ", err.Error())
+	os.Exit(1)
+}
+
+// expire logs out the sessions idle for longer than timeout
+func (api *restAPI) expire(timeout time.Duration) {
+	for range time.Tick(timeout / 4) {
+		api.expireIdle(time.Now().Add(-timeout))
+	}
+}
+
+func (api *restAPI) expireIdle(before time.Time) {
+	api.mu.Lock()
+	var idle []*httpSession
+	for token, h := range api.sessions {
+		h.mu.Lock()
+		if h.lastSeen.Before(before) {
+			idle = append(idle, h)
+			delete(api.sessions, token)
+		}
+		h.mu.Unlock()
+	}
+	api.mu.Unlock()
+	for _, h := range idle {
+		log.Printf("Logging out idle HTTP session of %s\n", h.session.username)
+		api.server.lobby.disconnect(h.session)
+	}
+}
+
+func (api *restAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.server.init()
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	if path == "login" && r.Method == http.MethodPost {
+		api.login(w, r)
+		return
+	}
+
+	h := api.authenticate(r)
+	if h == nil {
+		writeError(w, protocol.ErrorMsg{Code: protocol.NotConnected, Message: "missing or expired session token"})
+		return
+	}
+	var msg protocol.BattleMsg
+	route := r.Method + " " + path
+	switch {
+	case route == "POST logout":
+		api.logout(h)
+		writeJSON(w, http.StatusOK, protocol.OkMsg{})
+		return
+	case route == "GET events":
+		// Polls end well before the session would expire
+		maxTimeout := MAX_POLL_TIMEOUT
+		if maxTimeout > api.server.SessionTimeout/2 {
+			maxTimeout = api.server.SessionTimeout / 2
+		}
+		timeout, err := time.ParseDuration(r.URL.Query().Get("timeout"))
+		if err != nil || timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+		writeJSON(w, http.StatusOK, h.poll(timeout))
+		return
+	case route == "GET games":
+		msg = protocol.RequestOpenGamesListMsg{}
+	case route == "POST games":
+		var create protocol.CreateGameMsg
+		msg = &create
+	case strings.HasPrefix(route, "POST games/") && strings.HasSuffix(route, "/join"):
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "games/"), "/join"))
+		if err != nil {
+			writeError(w, protocol.ErrorMsg{Code: protocol.GameNotFound, Message: "invalid game id"})
+			return
+		}
+		msg = protocol.JoinGameMsg{Id: id}
+	case route == "GET game":
+		msg = protocol.RequestSnapshotMsg{}
+	case route == "POST game/pieces":
+		var piece protocol.GameSetPieceMsg
+		msg = &piece
+	case route == "POST game/fire":
+		var move protocol.GameMoveMsg
+		msg = &move
+	case route == "POST game/chat":
+		var chat protocol.ChatMessageMsg
+		msg = &chat
+	case route == "POST game/abandon":
+		msg = protocol.AbandonGameMsg{}
+	case route == "POST game/draw":
+		msg = protocol.OfferDrawMsg{}
+	case route == "POST game/draw/accept":
+		msg = protocol.AcceptDrawMsg{}
+	default:
+		writeJSON(w, http.StatusNotFound, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "unknown route " + route})
+		return
+	}
+	msg, err := readBody(w, r, msg)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	reply := api.request(h, msg)
+	if errMsg, ok := reply.(protocol.ErrorMsg); ok {
+		writeError(w, errMsg)
+		return
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// request hands msg to the lobby and returns its reply
+func (api *restAPI) request(h *httpSession, msg protocol.BattleMsg) protocol.BattleMsg {
+	h.requestMu.Lock()
+	defer h.requestMu.Unlock()
+	api.server.lobby.handle(h.session, 1, msg)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	reply := h.reply
+	h.reply = nil
+	return reply
+}
+
+func (api *restAPI) login(w http.ResponseWriter, r *http.Request) {
+	var connect protocol.ConnectMsg
+	if _, err := readBody(w, r, &connect); err != nil {
+		writeError(w, err)
+		return
+	}
+	h := &httpSession{token: newToken(), ready: make(chan struct{}, 1), lastSeen: time.Now()}
+	s, err := api.server.lobby.login(h, connect.Username, protocol.ProtocolVersion, serverFeatures.Variants)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	h.session = s
+	api.mu.Lock()
+	api.sessions[h.token] = h
+	api.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"token": h.token})
+}
+
+func (api *restAPI) logout(h *httpSession) {
+	api.mu.Lock()
+	delete(api.sessions, h.token)
+	api.mu.Unlock()
+	api.server.lobby.disconnect(h.session)
+}
+
+// authenticate returns the session of the request's token, nil when there is
+// none
+func (api *restAPI) authenticate(r *http.Request) *httpSession {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	h := api.sessions[token]
+	if h != nil {
+		h.mu.Lock()
+		h.lastSeen = time.Now()
+		h.mu.Unlock()
+	}
+	return h
+}
+
+// readBody decodes the JSON body of the request into msg when it is a
+// pointer and returns the message it points to. Bodies larger than
+// MAX_BODY_SIZE fail with an *http.MaxBytesError.
+func readBody(w http.ResponseWriter, r *http.Request, msg protocol.BattleMsg) (protocol.BattleMsg, error) {
+	switch msg.(type) {
+	case *protocol.CreateGameMsg, *protocol.GameSetPieceMsg, *protocol.GameMoveMsg, *protocol.ChatMessageMsg, *protocol.ConnectMsg:
+	default:
+		return msg, nil
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	// An empty body is the message's zero value
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, msg); err != nil {
+			return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "invalid JSON body: " + err.Error()}
+		}
+	}
+	switch msg := msg.(type) {
+	case *protocol.CreateGameMsg:
+		return *msg, nil
+	case *protocol.GameSetPieceMsg:
+		return *msg, nil
+	case *protocol.GameMoveMsg:
+		return *msg, nil
+	case *protocol.ChatMessageMsg:
+		return *msg, nil
+	case *protocol.ConnectMsg:
+		return *msg, nil
+	}
+	return msg, nil
+}
+
+// httpStatus is the status of the replies failing with code
+func httpStatus(code protocol.ErrorCode) int {
+	switch code {
+	case protocol.UnknownError:
+		return http.StatusInternalServerError
+	case protocol.NotConnected:
+		return http.StatusUnauthorized
+	case protocol.GameNotFound:
+		return http.StatusNotFound
+	case protocol.UsernameTaken, protocol.NotInGame, protocol.NotYourTurn, protocol.AlreadyFired,
+		protocol.GameFinished, protocol.NoDrawOffer, protocol.GameNotStarted:
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, protocol.ErrorMsg{Code: protocol.InvalidMessage,
+			Message: fmt.Sprintf("the body is larger than %d bytes", tooLarge.Limit)})
+		return
+	}
+	msg := protocol.NewErrorMsg(err)
+	writeJSON(w, httpStatus(msg.Code), msg)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+func newToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonfk/battleship/protocol"
+)
+
+// apiCall sends a request to the REST API and decodes its JSON reply into
+// reply, returning the status
+func apiCall(t *testing.T, server *httptest.Server, token, method, path, body string, reply interface{}) int {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if reply != nil {
+		if err := json.NewDecoder(resp.Body).Decode(reply); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func apiLogin(t *testing.T, server *httptest.Server, username string) string {
+	var reply map[string]string
+	if status := apiCall(t, server, "", "POST", "/api/login", `{"username":"`+username+`"}`, &reply); status != http.StatusOK {
+		t.Fatalf("login failed with status %d", status)
+	}
+	return reply["token"]
+}
+
+// rawEvent is an event with its message left undecoded
+type rawEvent struct {
+	Type string          `json:"type"`
+	Msg  json.RawMessage `json:"msg"`
+}
+
+func TestRestGame(t *testing.T) {
+	api := newRestAPI(&Server{})
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var errMsg protocol.ErrorMsg
+	if status := apiCall(t, server, "nope", "GET", "/api/games", "", &errMsg); status != http.StatusUnauthorized || errMsg.Code != protocol.NotConnected {
+		t.Errorf("expected an unauthorized error but got %d %#v", status, errMsg)
+	}
+	alice, bob := apiLogin(t, server, "alice"), apiLogin(t, server, "bob")
+	if status := apiCall(t, server, "", "POST", "/api/login", `{"username":"alice"}`, &errMsg); status != http.StatusConflict || errMsg.Code != protocol.UsernameTaken {
+		t.Errorf("expected UsernameTaken but got %d %#v", status, errMsg)
+	}
+
+	var status protocol.GamePreGameStatusMsg
+	apiCall(t, server, alice, "POST", "/api/games", `{"rules":"4x4 fleet=PatrolBoat"}`, &status)
+	var list protocol.OpenGamesListMsg
+	apiCall(t, server, bob, "GET", "/api/games", "", &list)
+	if len(list.Games) != 1 || list.Games[0].Id != status.Id {
+		t.Errorf("unexpected open games %#v", list)
+	}
+	if code := apiCall(t, server, bob, "POST", "/api/games/42/join", "", &errMsg); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown game but got %d", code)
+	}
+	apiCall(t, server, bob, "POST", "/api/games/1/join", "", &status)
+	if status.Opponent != "alice" {
+		t.Errorf("unexpected join reply %#v", status)
+	}
+
+	for _, token := range []string{alice, bob} {
+		var ok protocol.OkMsg
+		if code := apiCall(t, server, token, "POST", "/api/game/pieces", `{"piece":0,"start":{"x":0,"y":0},"end":{"x":1,"y":0}}`, &ok); code != http.StatusOK {
+			t.Errorf("placing failed with %d", code)
+		}
+	}
+	if code := apiCall(t, server, bob, "POST", "/api/game/fire", `{"x":0,"y":0}`, &errMsg); code != http.StatusConflict || errMsg.Code != protocol.NotYourTurn {
+		t.Errorf("expected NotYourTurn but got %d %#v", code, errMsg)
+	}
+	var ok protocol.OkMsg
+	apiCall(t, server, alice, "POST", "/api/game/fire", `{"x":0,"y":0}`, &ok)
+	if ok.Ok != "hit" {
+		t.Errorf("unexpected shot result %#v", ok)
+	}
+
+	// Bob polls the events pushed since he joined
+	var events []rawEvent
+	apiCall(t, server, bob, "GET", "/api/events?timeout=1s", "", &events)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	if got := strings.Join(types, " "); got != "PlayerJoined GameSnapshot CellChanged TurnChanged" {
+		t.Errorf("unexpected events %s", got)
+	}
+	var snapshot protocol.GameSnapshotMsg
+	apiCall(t, server, bob, "GET", "/api/game", "", &snapshot)
+	if snapshot.You != 1 || snapshot.YourGrid[0][0] != 2 || snapshot.Seq != 3 {
+		t.Errorf("unexpected snapshot %#v", snapshot)
+	}
+
+	// A long poll returns as soon as an event is pushed
+	apiCall(t, server, alice, "GET", "/api/events?timeout=1s", "", &events)
+	done := make(chan []rawEvent)
+	go func() {
+		var events []rawEvent
+		apiCall(t, server, alice, "GET", "/api/events?timeout=5s", "", &events)
+		done <- events
+	}()
+	time.Sleep(50 * time.Millisecond)
+	apiCall(t, server, bob, "POST", "/api/game/abandon", "", nil)
+	select {
+	case events := <-done:
+		var over protocol.GameOverMsg
+		if len(events) == 0 || json.Unmarshal(events[len(events)-1].Msg, &over) != nil || over.Outcome != protocol.OutcomeWon {
+			t.Errorf("unexpected events %v", events)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("the long poll did not return")
+	}
+
+	apiCall(t, server, alice, "POST", "/api/logout", "", nil)
+	if code := apiCall(t, server, alice, "GET", "/api/games", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected the token to be revoked but got %d", code)
+	}
+}
+
+func TestRestExpire(t *testing.T) {
+	api := newRestAPI(&Server{})
+	server := httptest.NewServer(api)
+	defer server.Close()
+	token := apiLogin(t, server, "alice")
+	api.expireIdle(time.Now().Add(time.Minute))
+	if code := apiCall(t, server, token, "GET", "/api/games", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected an expired session but got %d", code)
+	}
+	// The username is free again
+	apiLogin(t, server, "alice")
+	if code := apiCall(t, server, "", "POST", "/api/login", `{"username":`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected a bad request for invalid JSON but got %d", code)
+	}
+	var errMsg protocol.ErrorMsg
+	large := `{"username":"` + strings.Repeat("a", MAX_BODY_SIZE) + `"}`
+	if code := apiCall(t, server, "", "POST", "/api/login", large, &errMsg); code != http.StatusRequestEntityTooLarge || errMsg.Code != protocol.InvalidMessage {
+		t.Errorf("expected a too large body error but got %d %#v", code, errMsg)
+	}
+	if code := apiCall(t, server, "", "GET", "/other", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected paths outside of /api to be not found but got %d", code)
+	}
+}
+
+func TestRestPollKeepsSession(t *testing.T) {
+	api := newRestAPI(&Server{SessionTimeout: 200 * time.Millisecond})
+	server := httptest.NewServer(api)
+	defer server.Close()
+	token := apiLogin(t, server, "alice")
+	// The poll is cut short to fit in the session timeout
+	start := time.Now()
+	apiCall(t, server, token, "GET", "/api/events?timeout=1m", "", nil)
+	if time.Since(start) > time.Second {
+		t.Errorf("the poll lasted %v", time.Since(start))
+	}
+	api.expireIdle(time.Now().Add(-200 * time.Millisecond))
+	if code := apiCall(t, server, token, "GET", "/api/games", "", nil); code != http.StatusOK {
+		t.Errorf("expected the polling session to be kept but got %d", code)
+	}
+}
@@ -2,12 +2,16 @@ package main
 
 import (
 	//"fmt"
-	"github.com/jonfk/battleship/protocol"
+	"crypto/tls"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"sync"
+	"time"
+
+	"github.com/jonfk/battleship/protocol"
 
 	"github.com/boltdb/bolt"
 )
@@ -17,8 +21,14 @@ const (
 	DEFAULT_CONN_PORT = "8888"
 	CONN_TYPE         = "tcp"
 	DEFAULT_DB_FILE   = "~/.battleship/battleship.db"
+	// Clients have this long to say hello or connect
+	DEFAULT_HANDSHAKE_TIMEOUT = 10 * time.Second
+	DEFAULT_WRITE_TIMEOUT     = 10 * time.Second
 )
 
+// Server accepts the connections of every listener. It holds the open
+// connections and the lobby they share, so it is used by pointer and must not
+// be copied once running.
 type Server struct {
 	Host           string
 	Port           string
@@ -26,14 +36,37 @@ type Server struct {
 	connectionsMut sync.Mutex
 	BoltDBFile     string
 	boltdb         *bolt.DB
+	// TLSConfig makes every listener use TLS when set
+	TLSConfig *tls.Config
+	// WebSocketPort is the port of the WebSocket listener, which is only
+	// started when set
+	WebSocketPort string
+	// TextPort is the port of the text protocol listener, which is only
+	// started when set
+	TextPort string
+	// HTTPPort is the port of the REST API, which is only started when set
+	HTTPPort string
+	// SessionTimeout is how long REST API sessions last without requests
+	SessionTimeout time.Duration
+	// Clients that said hello are pinged every PingInterval and
+	// disconnected after PingTimeout without any message
+	PingInterval     time.Duration
+	PingTimeout      time.Duration
+	HandshakeTimeout time.Duration
+	WriteTimeout     time.Duration
+	lobby            *lobby
+	lobbyOnce        sync.Once
 }
 
-func (server Server) Run() {
+func (server *Server) Run() {
 	l, err := net.Listen(CONN_TYPE, server.Host+":"+server.Port)
 	if err != nil {
 		log.Println("Error listening: ", err.Error())
 		os.Exit(1)
 	}
+	if server.TLSConfig != nil {
+		l = tls.NewListener(l, server.TLSConfig)
+	}
 	// Close the listener when the application closes.
 	defer l.Close()
 
@@ -45,6 +78,17 @@ func (server Server) Run() {
 		log.Fatal(err)
 	}
 	defer server.boltdb.Close()
+	server.init()
+
+	if server.WebSocketPort != "" {
+		go server.runWebSocket()
+	}
+	if server.TextPort != "" {
+		go server.runText()
+	}
+	if server.HTTPPort != "" {
+		go server.runHTTP()
+	}
 
 	for {
 		// Listen for an incoming connection.
@@ -54,64 +98,88 @@ func (server Server) Run() {
 			log.Println("Error accepting: ", err.Error())
 			os.Exit(1)
 		}
-		// Save connection
-		server.connectionsMut.Lock()
-		server.connections = append(server.connections, conn)
-		server.connectionsMut.Unlock()
 		// Handle connections in a new goroutine.
-		go server.handleRequest(conn)
+		go server.handleRequest(conn, serverFeatures)
 	}
 
 }
 
-func (server Server) handleRequest(conn net.Conn) {
+// init fills in the defaults of the settings left unset
+func (server *Server) init() {
+	server.lobbyOnce.Do(func() {
+		if server.PingInterval == 0 {
+			server.PingInterval = protocol.DefaultPingInterval
+		}
+		if server.PingTimeout == 0 {
+			server.PingTimeout = protocol.DefaultPingTimeout
+		}
+		if server.HandshakeTimeout == 0 {
+			server.HandshakeTimeout = DEFAULT_HANDSHAKE_TIMEOUT
+		}
+		if server.WriteTimeout == 0 {
+			server.WriteTimeout = DEFAULT_WRITE_TIMEOUT
+		}
+		if server.SessionTimeout == 0 {
+			server.SessionTimeout = DEFAULT_SESSION_TIMEOUT
+		}
+		server.lobby = newLobby()
+	})
+}
+
+func (server *Server) runWebSocket() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", server.serveWebSocket)
+	httpServer := &http.Server{Addr: server.Host + ":" + server.WebSocketPort, Handler: mux, TLSConfig: server.TLSConfig}
+	var err error
+	if server.TLSConfig != nil {
+		// The certificate is already in the configuration
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	log.Println("Error listening for websockets: ", err.Error())
+	os.Exit(1)
+}
+
+// handleRequest serves a connection offering it the features given, conn
+// may be a TCP connection or a WebSocket adapter
+func (server *Server) handleRequest(conn net.Conn, features protocol.Features) {
+	server.init()
+	server.connectionsMut.Lock()
+	server.connections = append(server.connections, conn)
+	server.connectionsMut.Unlock()
+	c := newClient(server, conn, features)
+	// Close the connection when you're done with it. The framing cannot be
+	// trusted anymore after a read error.
+	defer server.removeConn(conn)
+	defer c.close()
+	conn.SetReadDeadline(time.Now().Add(server.HandshakeTimeout))
 	for {
-		msg, err := protocol.ReadMsg(conn)
+		msg, requestID, err := c.frames.ReadMsgID()
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			log.Printf("Closing silent connection from %v\n", conn.RemoteAddr())
+			return
+		}
 		if err != nil {
-			if err == io.EOF {
-				// Close the connection when you're done with it.
-				server.removeConn(conn)
-				conn.Close()
-				return
+			if err != io.EOF {
+				log.Println(err)
 			}
-			log.Println(err)
 			return
 		}
 		log.Printf("Message Received: %#v\n", msg)
-		switch msg.(type) {
-		case protocol.PingMsg:
-		case protocol.OkMsg:
-		case protocol.ErrorMsg:
-		case protocol.GameMoveMsg:
-		case protocol.ChatMessageMsg:
-		case protocol.ConnectMsg:
-		case protocol.RequestOpenGamesListMsg:
-		case protocol.CreateGameMsg:
-		case protocol.JoinGameMsg:
-		case protocol.AcceptGameMsg:
-		case protocol.RejectGameMsg:
-		case protocol.GameSetPieceMsg:
-		case protocol.RequestGameStateMsg:
-		case protocol.AbandonGameMsg:
-		case protocol.OpenGamesListMsg:
-		case protocol.GamePreGameStatusMsg:
-		case protocol.GameStateMsg:
-		case protocol.GameWonMsg:
-		case protocol.GameLostMsg:
-		default:
+		if !c.handle(requestID, msg) {
+			return
 		}
-		//broadcast(conn, msg)
 	}
 }
 
-func (server Server) removeConn(conn net.Conn) {
+func (server *Server) removeConn(conn net.Conn) {
 	server.connectionsMut.Lock()
-	var i int
-	for i = range server.connections {
+	for i := range server.connections {
 		if server.connections[i] == conn {
+			server.connections = append(server.connections[:i], server.connections[i+1:]...)
 			break
 		}
 	}
-	server.connections = append(server.connections[:i], server.connections[i+1:]...)
 	server.connectionsMut.Unlock()
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/render"
+	"github.com/jonfk/battleship/protocol"
+)
+
+// The text protocol is a line protocol meant for people typing in nc or
+// telnet and for simple scripts. Every command gets lines of data followed by
+// a line starting with OK or ERR. Lines pushed by the server on its own start
+// with "* " and may arrive at any time.
+const textHelp = `LOGIN name                 log in
+LIST                       list the open games
+CREATE [rules]             create a game, e.g. CREATE 8x8 fleet=PatrolBoat,Destroyer
+JOIN id                    join an open game
+PLACE piece start end      place a piece, e.g. PLACE carrier A1 A5 or PLACE destroyer B2 down
+FIRE coord                 fire at the opponent, e.g. FIRE B7
+BOARD                      show the game
+CHAT text                  send a message to the opponent
+ABANDON                    resign the game
+DRAW                       offer a draw
+ACCEPT                     accept the draw offered
+HELP                       show this help
+QUIT                       leave`
+
+// textVersion is the protocol version of text clients, who are sent moves and
+// game states rather than game updates
+const textVersion = 2
+
+// pieceAliases are the short piece names accepted by PLACE
+var pieceAliases = map[string]game.PieceType{
+	"patrol":  game.PatrolBoat,
+	"sub":     game.Submarine,
+	"carrier": game.AircraftCarrier,
+}
+
+// textClient is a connection speaking the text protocol
+type textClient struct {
+	server *Server
+	// session is nil until the client logged in
+	session *session
+	// lastID is the ID of the last command handed to the lobby, replies
+	// are told apart from pushes by their ID
+	lastID uint32
+
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// serveText serves a connection speaking the text protocol
+func (server *Server) serveText(conn net.Conn) {
+	server.init()
+	server.connectionsMut.Lock()
+	server.connections = append(server.connections, conn)
+	server.connectionsMut.Unlock()
+	defer server.removeConn(conn)
+	defer conn.Close()
+
+	c := &textClient{server: server, w: bufio.NewWriter(&timeoutWriter{conn: conn, timeout: server.WriteTimeout})}
+	defer func() {
+		if c.session != nil {
+			server.lobby.disconnect(c.session)
+		}
+	}()
+	c.writeLines("* battleship: type HELP for the commands")
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, 4096)
+	for {
+		// Text clients are not pinged, they have to send a line, even an
+		// empty one, before the timeout
+		timeout := server.PingTimeout
+		if c.session == nil {
+			timeout = server.HandshakeTimeout
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		if !scanner.Scan() {
+			break
+		}
+		if !c.handle(scanner.Text()) {
+			return
+		}
+	}
+	err := scanner.Err()
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		log.Printf("Closing silent text connection from %v\n", conn.RemoteAddr())
+		return
+	}
+	if err != nil && err != io.EOF {
+		log.Println(err)
+	}
+}
+
+func (server *Server) runText() {
+	l, err := net.Listen(CONN_TYPE, server.Host+":"+server.TextPort)
+	if err != nil {
+		log.Fatal("Error listening for text clients: ", err.Error())
+	}
+	if server.TLSConfig != nil {
+		l = tls.NewListener(l, server.TLSConfig)
+	}
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatal("Error accepting: ", err.Error())
+		}
+		log.Printf("Accepting new text connection from %v\n", conn.RemoteAddr())
+		go server.serveText(conn)
+	}
+}
+
+// handle runs a command line. It returns false when the connection should
+// be closed.
+func (c *textClient) handle(line string) bool {
+	command, args := splitTextCommand(line)
+	switch command {
+	case "":
+		return true
+	case "QUIT":
+		c.writeLines("OK bye")
+		return false
+	case "HELP":
+		c.writeLines(append(strings.Split(textHelp, "\n"), "OK")...)
+		return true
+	case "LOGIN":
+		c.login(args)
+		return true
+	}
+	msg, err := parseTextCommand(command, args)
+	if err != nil {
+		c.writeLines(errorLine(err))
+		return true
+	}
+	if c.session == nil {
+		c.writeLines(errorLine(protocol.ErrorMsg{Code: protocol.NotConnected, Message: "LOGIN first"}))
+		return true
+	}
+	c.lastID++
+	c.server.lobby.handle(c.session, c.lastID, msg)
+	return true
+}
+
+func (c *textClient) login(username string) {
+	if c.session != nil {
+		c.writeLines(errorLine(protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: "already logged in as " + c.session.username}))
+		return
+	}
+	session, err := c.server.lobby.login(c, username, textVersion, serverFeatures.Variants)
+	if err != nil {
+		c.writeLines(errorLine(err))
+		return
+	}
+	c.session = session
+	c.writeLines("OK logged in as " + username)
+}
+
+// send implements outbox, messages are written as lines
+func (c *textClient) send(requestID uint32, msg protocol.BattleMsg) error {
+	if requestID != 0 {
+		return c.writeLines(replyLines(msg)...)
+	}
+	return c.writeLines(pushLines(msg)...)
+}
+
+// writeLines writes lines without their control characters, so that text
+// sent by other players such as chat cannot forge lines
+func (c *textClient) writeLines(lines ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range lines {
+		c.w.WriteString(stripControl(line))
+		c.w.WriteString("\r\n")
+	}
+	return c.w.Flush()
+}
+
+func stripControl(line string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// splitTextCommand splits a line into its upper case command and arguments
+func splitTextCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return strings.ToUpper(line), ""
+	}
+	return strings.ToUpper(line[:i]), strings.TrimSpace(line[i+1:])
+}
+
+// parseTextCommand translates a command other than LOGIN, HELP and QUIT to
+// the message handled by the lobby
+func parseTextCommand(command, args string) (protocol.BattleMsg, error) {
+	switch command {
+	case "LIST":
+		return protocol.RequestOpenGamesListMsg{}, nil
+	case "CREATE":
+		return protocol.CreateGameMsg{Rules: args}, nil
+	case "JOIN":
+		id, err := strconv.Atoi(args)
+		if err != nil {
+			return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: fmt.Sprintf("JOIN: invalid game id %q", args)}
+		}
+		return protocol.JoinGameMsg{Id: id}, nil
+	case "PLACE":
+		name, placement := splitTextCommand(args)
+		piece, ok := pieceAliases[strings.ToLower(name)]
+		if !ok {
+			var err error
+			piece, err = game.ParsePieceType(name)
+			if err != nil {
+				return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: err.Error()}
+			}
+		}
+		start, end, err := game.ParsePlacement(placement, piece)
+		if err != nil {
+			return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: err.Error()}
+		}
+		return protocol.GameSetPieceMsg{
+			Piece: int(piece),
+			Start: protocol.Coord{X: start.X, Y: start.Y},
+			End:   protocol.Coord{X: end.X, Y: end.Y},
+		}, nil
+	case "FIRE":
+		coord, err := game.ParseCoord(args)
+		if err != nil {
+			return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: err.Error()}
+		}
+		return protocol.GameMoveMsg{X: coord.X, Y: coord.Y}, nil
+	case "BOARD":
+		return protocol.RequestGameStateMsg{}, nil
+	case "CHAT":
+		return protocol.ChatMessageMsg{Msg: args}, nil
+	case "ABANDON":
+		return protocol.AbandonGameMsg{}, nil
+	case "DRAW":
+		return protocol.OfferDrawMsg{}, nil
+	case "ACCEPT":
+		return protocol.AcceptDrawMsg{}, nil
+	}
+	return nil, protocol.ErrorMsg{Code: protocol.InvalidMessage, Message: fmt.Sprintf("unknown command %q, type HELP for the commands", command)}
+}
+
+// replyLines writes the reply to a command
+func replyLines(msg protocol.BattleMsg) []string {
+	switch msg := msg.(type) {
+	case protocol.ErrorMsg:
+		return []string{errorLine(msg)}
+	case protocol.OkMsg:
+		return []string{strings.TrimSpace("OK " + msg.Ok)}
+	case protocol.OpenGamesListMsg:
+		var lines []string
+		for _, g := range msg.Games {
+			lines = append(lines, strings.TrimSpace(fmt.Sprintf("GAME %d %s %s", g.Id, g.Username, g.Rules)))
+		}
+		return append(lines, fmt.Sprintf("OK %d open games", len(msg.Games)))
+	case protocol.GamePreGameStatusMsg:
+		if msg.Opponent == "" {
+			return []string{fmt.Sprintf("OK created game %d", msg.Id)}
+		}
+		return []string{fmt.Sprintf("OK joined game %d against %s", msg.Id, msg.Opponent)}
+	case protocol.GameStateMsg:
+		return append(boardLines(msg, ""), "OK")
+	}
+	return []string{fmt.Sprintf("OK %v", msg)}
+}
+
+// pushLines writes a message pushed by the server
+func pushLines(msg protocol.BattleMsg) []string {
+	switch msg := msg.(type) {
+	case protocol.GamePreGameStatusMsg:
+		return []string{"* JOINED " + msg.Opponent}
+	case protocol.GameStateMsg:
+		return append([]string{"* START"}, boardLines(msg, "* ")...)
+	case protocol.GameMoveMsg:
+		return []string{"* FIRED " + game.Coord{X: msg.X, Y: msg.Y}.Notation()}
+	case protocol.ChatMessageMsg:
+		return []string{"* CHAT " + msg.Msg}
+	case protocol.OfferDrawMsg:
+		return []string{"* DRAW OFFERED"}
+	case protocol.GameOverMsg:
+		return []string{fmt.Sprintf("* GAMEOVER %s %s", msg.Outcome, msg.Reason)}
+	}
+	return []string{fmt.Sprintf("* %v", msg)}
+}
+
+// boardLines draws both grids in ASCII, the opponent's ships are already
+// hidden by the lobby
+func boardLines(state protocol.GameStateMsg, prefix string) []string {
+	board := render.Grids([]string{"You", "Opponent"},
+		[][][]game.GridState{toGridStates(state.YourGrid), toGridStates(state.OpponentGrid)},
+		render.Options{ASCII: true})
+	lines := strings.Split(strings.TrimRight(board, "\n"), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+	return lines
+}
+
+func errorLine(err error) string {
+	msg := protocol.NewErrorMsg(err)
+	return fmt.Sprintf("ERR %v %s", msg.Code, msg.Message)
+}
+
+func toGridStates(cells [][]int) [][]game.GridState {
+	grid := make([][]game.GridState, len(cells))
+	for y := range cells {
+		grid[y] = make([]game.GridState, len(cells[y]))
+		for x, cell := range cells[y] {
+			grid[y][x] = game.GridState(cell)
+		}
+	}
+	return grid
+}
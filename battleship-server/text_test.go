@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonfk/battleship/protocol"
+)
+
+// textConn is a client of the text protocol. Lines are read as they come
+// since a command returns once the pushes to the opponent are written.
+type textConn struct {
+	t     *testing.T
+	conn  net.Conn
+	lines chan string
+}
+
+func dialText(t *testing.T, server *Server) *textConn {
+	conn, serverConn := net.Pipe()
+	go server.serveText(serverConn)
+	c := &textConn{t: t, conn: conn, lines: make(chan string, 100)}
+	go func() {
+		defer close(c.lines)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			c.lines <- scanner.Text()
+		}
+	}()
+	c.expect("* battleship")
+	return c
+}
+
+func (c *textConn) readLine() (string, bool) {
+	select {
+	case line, ok := <-c.lines:
+		return line, ok
+	case <-time.After(time.Second):
+		return "", false
+	}
+}
+
+// command sends a command and returns the lines read up to its OK or ERR line
+func (c *textConn) command(line string) []string {
+	c.conn.Write([]byte(line + "\r\n"))
+	var lines []string
+	for {
+		text, ok := c.readLine()
+		if !ok {
+			c.t.Fatalf("%s: no reply after %q", line, lines)
+		}
+		lines = append(lines, text)
+		if strings.HasPrefix(text, "OK") || strings.HasPrefix(text, "ERR") {
+			return lines
+		}
+	}
+}
+
+// expect reads lines until one starts with prefix
+func (c *textConn) expect(prefix string) {
+	for {
+		text, ok := c.readLine()
+		if !ok {
+			c.t.Fatalf("expected a line starting with %q", prefix)
+		}
+		if strings.HasPrefix(text, prefix) {
+			return
+		}
+	}
+}
+
+func last(lines []string) string {
+	return lines[len(lines)-1]
+}
+
+func TestTextGame(t *testing.T) {
+	server := &Server{}
+	alice, bob := dialText(t, server), dialText(t, server)
+	defer alice.conn.Close()
+	defer bob.conn.Close()
+
+	if line := last(alice.command("LIST")); line != "ERR NotConnected LOGIN first" {
+		t.Errorf("unexpected reply before login %q", line)
+	}
+	alice.command("LOGIN alice")
+	if line := last(bob.command("login alice")); !strings.HasPrefix(line, "ERR UsernameTaken") {
+		t.Errorf("expected UsernameTaken but got %q", line)
+	}
+	bob.command("LOGIN bob")
+
+	if line := last(alice.command("CREATE 4x4 fleet=PatrolBoat")); line != "OK created game 1" {
+		t.Errorf("unexpected reply %q", line)
+	}
+	if lines := bob.command("LIST"); len(lines) != 2 || lines[0] != "GAME 1 alice 4x4 fleet=PatrolBoat" {
+		t.Errorf("unexpected open games %q", lines)
+	}
+	if line := last(bob.command("JOIN 1")); line != "OK joined game 1 against alice" {
+		t.Errorf("unexpected reply %q", line)
+	}
+	alice.expect("* JOINED bob")
+
+	alice.command("PLACE patrol A1 right")
+	if line := last(bob.command("PLACE PatrolBoat A1-A2")); line != "OK" {
+		t.Errorf("unexpected reply %q", line)
+	}
+	alice.expect("* START")
+	if lines := alice.command("BOARD"); len(lines) < 5 || !strings.Contains(strings.Join(lines, "\n"), "Opponent") {
+		t.Errorf("unexpected board %q", lines)
+	}
+
+	if line := last(bob.command("FIRE A1")); !strings.HasPrefix(line, "ERR NotYourTurn") {
+		t.Errorf("expected NotYourTurn but got %q", line)
+	}
+	alice.command("FIRE A1")
+	bob.expect("* FIRED A1")
+	bob.command("FIRE D4")
+	if line := last(alice.command("FIRE A2")); line != "OK sunk" {
+		t.Errorf("unexpected reply %q", line)
+	}
+	bob.expect("* GAMEOVER lost fleet_sunk")
+
+	if line := last(alice.command("QUIT")); line != "OK bye" {
+		t.Errorf("unexpected reply %q", line)
+	}
+}
+
+func TestSilentTextClient(t *testing.T) {
+	server := &Server{PingTimeout: 50 * time.Millisecond}
+	alice := dialText(t, server)
+	defer alice.conn.Close()
+	alice.command("LOGIN alice")
+	timeout := time.After(time.Second)
+	for closed := false; !closed; {
+		select {
+		case _, ok := <-alice.lines:
+			closed = !ok
+		case <-timeout:
+			t.Fatal("silent text client was not disconnected")
+		}
+	}
+	if _, err := server.lobby.login(&recorder{}, "alice", textVersion, nil); err != nil {
+		t.Errorf("silent text client is still logged in: %v", err)
+	}
+}
+
+func TestTextForgedLines(t *testing.T) {
+	var buf bytes.Buffer
+	c := &textClient{w: bufio.NewWriter(&buf)}
+	// Players of the other protocols can send any text
+	c.send(0, protocol.ChatMessageMsg{Msg: "gg\r\nOK sunk\x1b[2J"})
+	if buf.String() != "* CHAT ggOK sunk[2J\r\n" {
+		t.Errorf("control characters were written: %q", buf.String())
+	}
+}
+
+func TestParseTextCommand(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		msg  protocol.BattleMsg
+	}{
+		{"join 12", protocol.JoinGameMsg{Id: 12}},
+		{"PLACE carrier A1 A5", protocol.GameSetPieceMsg{Piece: 4, Start: protocol.Coord{X: 0, Y: 0}, End: protocol.Coord{X: 0, Y: 4}}},
+		{"PLACE Destroyer b2 down", protocol.GameSetPieceMsg{Piece: 1, Start: protocol.Coord{X: 1, Y: 1}, End: protocol.Coord{X: 1, Y: 3}}},
+		{"fire  B7 ", protocol.GameMoveMsg{X: 1, Y: 6}},
+		{"CHAT good luck", protocol.ChatMessageMsg{Msg: "good luck"}},
+		{"JOIN twelve", nil},
+		{"PLACE canoe A1 A2", nil},
+		{"DANCE", nil},
+	} {
+		msg, err := parseTextCommand(splitTextCommand(test.line))
+		if test.msg == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error but got %#v", test.line, msg)
+			}
+			continue
+		}
+		if err != nil || msg != test.msg {
+			t.Errorf("%q: expected %#v but got %#v %v", test.line, test.msg, msg, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/jonfk/battleship/protocol"
+	"github.com/jonfk/battleship/protocol/websocket"
+)
+
+// WebSocket subprotocols. Binary clients send one frame per binary message,
+// JSON clients send every frame as a text message holding a jsonFrame.
+const (
+	SubprotocolBinary = "battleship"
+	SubprotocolJSON   = "battleship.json"
+)
+
+// jsonFeatures are offered to clients of the JSON text mode, which can only
+// carry JSON payloads
+var jsonFeatures = protocol.Features{
+	Variants:    serverFeatures.Variants,
+	Codecs:      []string{protocol.CodecJSON},
+	Compression: []string{protocol.CompressionNone},
+}
+
+// serveWebSocket upgrades HTTP requests to WebSocket connections served like
+// the TCP connections
+func (server *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Upgrade(w, r, []string{SubprotocolBinary, SubprotocolJSON})
+	if err != nil {
+		log.Printf("Error upgrading %v: %v\n", r.RemoteAddr, err)
+		return
+	}
+	log.Printf("Accepting new websocket connection from %v\n", ws.RemoteAddr())
+	ws.MaxMessageSize = protocol.DefaultMaxPayloadSize + 64
+	if ws.Subprotocol == SubprotocolJSON {
+		server.handleRequest(&wsJSONConn{Conn: ws}, jsonFeatures)
+	} else {
+		server.handleRequest(&wsConn{Conn: ws}, serverFeatures)
+	}
+}
+
+// wsConn is a stream of frames carried one per binary message
+type wsConn struct {
+	*websocket.Conn
+	// buf is what is left of the last message
+	buf []byte
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		opcode, data, err := c.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		if opcode != websocket.BinaryMessage {
+			return 0, fmt.Errorf("websocket: expected a binary message")
+		}
+		c.buf = data
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write sends p in a single message, MsgWriter writes a frame at a time
+func (c *wsConn) Write(p []byte) (int, error) {
+	err := c.WriteMessage(websocket.BinaryMessage, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// jsonFrame is a frame of the JSON text mode. The payload is the message in
+// JSON, omitted when empty.
+type jsonFrame struct {
+	Type      uint8           `json:"type"`
+	RequestID uint32          `json:"id,omitempty"`
+	Msg       json.RawMessage `json:"msg,omitempty"`
+}
+
+// wsJSONConn translates between frames and jsonFrame text messages
+type wsJSONConn struct {
+	*websocket.Conn
+	// buf holds the frames translated from the last message
+	buf bytes.Buffer
+}
+
+func (c *wsJSONConn) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		opcode, data, err := c.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		if opcode != websocket.TextMessage {
+			return 0, fmt.Errorf("websocket: expected a text message")
+		}
+		var frame jsonFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return 0, fmt.Errorf("websocket: invalid frame: %v", err)
+		}
+		err = protocol.NewFrameWriter(&c.buf).Write(protocol.Frame{Type: frame.Type, RequestID: frame.RequestID, Payload: frame.Msg})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.buf.Read(p)
+}
+
+// Write sends every frame of p as a text message
+func (c *wsJSONConn) Write(p []byte) (int, error) {
+	frames := protocol.NewFrameReader(bytes.NewReader(p))
+	for {
+		frame, err := frames.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		data, err := json.Marshal(jsonFrame{Type: frame.Type, RequestID: frame.RequestID, Msg: frame.Payload})
+		if err != nil {
+			return 0, err
+		}
+		if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+var (
+	_ net.Conn = (*wsConn)(nil)
+	_ net.Conn = (*wsJSONConn)(nil)
+)
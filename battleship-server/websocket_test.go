@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jonfk/battleship/protocol"
+	"github.com/jonfk/battleship/protocol/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	server := &Server{}
+	httpServer := httptest.NewServer(http.HandlerFunc(server.serveWebSocket))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/ws"
+
+	// A browser speaking the JSON text mode creates a game
+	browser, err := websocket.Dial(url, []string{SubprotocolJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Close()
+	readJSON := func() jsonFrame {
+		opcode, data, err := browser.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var frame jsonFrame
+		if err := json.Unmarshal(data, &frame); opcode != websocket.TextMessage || err != nil {
+			t.Fatalf("invalid text frame %q: %v", data, err)
+		}
+		return frame
+	}
+	browser.WriteMessage(websocket.TextMessage, []byte(`{"type": 22, "id": 1, "msg": {"version": 2, "username": "jonfk", "features": {"codecs": ["msgpack", "json"]}}}`))
+	frame := readJSON()
+	var welcome protocol.WelcomeMsg
+	if err := json.Unmarshal(frame.Msg, &welcome); frame.Type != uint8(protocol.Welcome) || frame.RequestID != 1 || err != nil {
+		t.Fatalf("expected a welcome but got %+v", frame)
+	}
+	if codec := welcome.Features.Codecs; len(codec) != 1 || codec[0] != protocol.CodecJSON {
+		t.Errorf("JSON text mode should only offer JSON payloads, got %v", codec)
+	}
+	browser.WriteMessage(websocket.TextMessage, []byte(`{"type": 7, "id": 2}`))
+	if frame := readJSON(); frame.Type != uint8(protocol.GamePreGameStatus) || frame.RequestID != 2 || string(frame.Msg) != `{"id":1,"opponent":""}` {
+		t.Errorf("unexpected reply to CreateGame %+v", frame)
+	}
+
+	// A binary client joins it with MessagePack payloads
+	conn, err := websocket.Dial(url, []string{SubprotocolBinary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := &wsConn{Conn: conn}
+	defer ws.Close()
+	frames, writer := protocol.NewFrameReader(ws), protocol.NewMsgWriter(ws)
+	writer.WriteMsg(protocol.HelloMsg{Version: 2, Username: "gery", Features: protocol.Features{Codecs: []string{protocol.CodecMsgPack}}})
+	msg, err := frames.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames.Codec = protocol.NegotiatedCodec(msg.(protocol.WelcomeMsg).Features)
+	writer.SetCodec(frames.Codec)
+	writer.WriteMsgID(3, protocol.JoinGameMsg{Id: 1})
+	if msg, id, err := frames.ReadMsgID(); err != nil || id != 3 || msg != (protocol.GamePreGameStatusMsg{Id: 1, Opponent: "jonfk"}) {
+		t.Errorf("unexpected reply to JoinGame %#v %v %v", msg, id, err)
+	}
+	if frame := readJSON(); frame.Type != uint8(protocol.GamePreGameStatus) || string(frame.Msg) != `{"id":1,"opponent":"gery"}` {
+		t.Errorf("the creator was not told about the opponent %+v", frame)
+	}
+}
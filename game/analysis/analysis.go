@@ -0,0 +1,257 @@
+// Package analysis estimates where the opponent's ships are from what a
+// player has seen so far. Every placement of the remaining fleet that agrees
+// with the hits, misses and sunk ships is considered equally likely. Small
+// problems are enumerated exactly while larger ones are estimated by weighted
+// Monte Carlo sampling of consistent placements.
+//
+// The posterior can be used by bots to pick the most likely cell, by clients
+// to offer hints and after a game to find the shots that were blunders.
+package analysis
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/jonfk/battleship/game"
+)
+
+// Defaults used when Options fields are zero
+const (
+	DefaultSamples    = 2000
+	DefaultExactLimit = 2000000
+)
+
+// View is what a player knows about the opponent's board
+type View struct {
+	Size game.Coord
+	// Area is where the opponent's ships can be, the whole board when zero
+	Area game.Coord
+	// Fleet is the opponent's whole fleet, including the sunk ships
+	Fleet  []game.PieceType
+	Hits   []game.Coord
+	Misses []game.Coord
+	Sunk   []game.Piece
+}
+
+// ViewOf returns what player knows about the opponent's board from the
+// game's history
+func ViewOf(g *game.Game, player game.Player) *View {
+	return ViewAt(g, player, len(g.History))
+}
+
+// ViewAt returns what player knew about the opponent's board after the first
+// n shots of the game's history
+func ViewAt(g *game.Game, player game.Player, n int) *View {
+	opponent := player.Opponent()
+	view := &View{
+		Size:  g.Size,
+		Area:  g.Rules.AreaOf(opponent),
+		Fleet: g.Rules.FleetOf(opponent),
+	}
+	var hits []game.Coord
+	for _, shot := range g.History[:n] {
+		if shot.Player != player {
+			continue
+		}
+		switch shot.Result {
+		case game.Miss:
+			view.Misses = append(view.Misses, shot.Coord)
+		case game.Hit:
+			hits = append(hits, shot.Coord)
+		case game.Sunk:
+			hits = append(hits, shot.Coord)
+			if piece, ok := g.PieceAt(opponent, shot.Coord); ok {
+				view.Sunk = append(view.Sunk, piece)
+			}
+		}
+	}
+	for _, coord := range hits {
+		if !covered(view.Sunk, coord) {
+			view.Hits = append(view.Hits, coord)
+		}
+	}
+	return view
+}
+
+// Options tune how the posterior is computed
+type Options struct {
+	// Rand is used for sampling, a generator with a fixed seed when nil
+	Rand *rand.Rand
+	// Samples is the number of consistent placements sampled
+	Samples int
+	// ExactLimit is the largest search space enumerated exactly, counted as
+	// the product of the number of positions of every remaining ship
+	ExactLimit float64
+}
+
+// Posterior holds the probability that a ship occupies each cell
+type Posterior struct {
+	Size game.Coord
+	// Cells is indexed by row then column
+	Cells [][]float64
+	// Exact is true when every placement was enumerated
+	Exact bool
+	// shot marks the cells the player already fired at
+	shot [][]bool
+}
+
+// At returns the probability that a ship occupies coord
+func (posterior *Posterior) At(coord game.Coord) float64 {
+	return posterior.Cells[coord.Y][coord.X]
+}
+
+// Best returns the cell not fired at yet that is most likely to hold a ship.
+// It returns false when every cell has been fired at.
+func (posterior *Posterior) Best() (game.Coord, bool) {
+	var (
+		best  game.Coord
+		found bool
+	)
+	for y, row := range posterior.Cells {
+		for x, p := range row {
+			if posterior.shot[y][x] {
+				continue
+			}
+			if !found || p > posterior.Cells[best.Y][best.X] {
+				best, found = game.Coord{X: x, Y: y}, true
+			}
+		}
+	}
+	return best, found
+}
+
+// Posterior computes the probability that a ship occupies each cell. It
+// returns an error when no placement of the remaining fleet agrees with the
+// view.
+func (view *View) Posterior(opts Options) (*Posterior, error) {
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewSource(1))
+	}
+	if opts.Samples <= 0 {
+		opts.Samples = DefaultSamples
+	}
+	if opts.ExactLimit <= 0 {
+		opts.ExactLimit = DefaultExactLimit
+	}
+
+	p, err := newProblem(view)
+	if err != nil {
+		return nil, err
+	}
+	posterior := &Posterior{
+		Size:  view.Size,
+		Cells: newGrid(view.Size),
+		shot:  make([][]bool, view.Size.Y),
+	}
+	for y := range posterior.shot {
+		posterior.shot[y] = make([]bool, view.Size.X)
+	}
+	for _, coord := range view.Misses {
+		posterior.shot[coord.Y][coord.X] = true
+	}
+	for _, coord := range view.Hits {
+		posterior.shot[coord.Y][coord.X] = true
+	}
+	for _, piece := range view.Sunk {
+		for _, coord := range piece.Coords() {
+			posterior.shot[coord.Y][coord.X] = true
+		}
+	}
+
+	var total float64
+	if p.searchSpace() <= opts.ExactLimit {
+		posterior.Exact = true
+		total = p.enumerate(posterior.Cells)
+	} else {
+		total = p.sample(opts.Rand, opts.Samples, posterior.Cells)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("Posterior: no placement of the fleet agrees with the view")
+	}
+
+	for _, row := range posterior.Cells {
+		for x := range row {
+			row[x] /= total
+		}
+	}
+	// Known ship cells are certain
+	for _, coord := range view.Hits {
+		posterior.Cells[coord.Y][coord.X] = 1
+	}
+	for _, piece := range view.Sunk {
+		for _, coord := range piece.Coords() {
+			posterior.Cells[coord.Y][coord.X] = 1
+		}
+	}
+	return posterior, nil
+}
+
+// Hint returns the cell the player should fire at next
+func Hint(g *game.Game, player game.Player, opts Options) (game.Coord, error) {
+	posterior, err := ViewOf(g, player).Posterior(opts)
+	if err != nil {
+		return game.Coord{}, err
+	}
+	best, ok := posterior.Best()
+	if !ok {
+		return game.Coord{}, fmt.Errorf("Hint: every cell has been fired at")
+	}
+	return best, nil
+}
+
+// Blunder is a shot fired at a cell much less likely to hold a ship than the
+// best cell at the time
+type Blunder struct {
+	// Shot is the index of the shot in the game's history
+	Shot            int
+	Coord           game.Coord
+	Probability     float64
+	Best            game.Coord
+	BestProbability float64
+}
+
+// Blunders replays the player's shots and returns those that were at least
+// threshold less likely to hit than the best cell
+func Blunders(g *game.Game, player game.Player, threshold float64, opts Options) ([]Blunder, error) {
+	var blunders []Blunder
+	for i, shot := range g.History {
+		if shot.Player != player {
+			continue
+		}
+		posterior, err := ViewAt(g, player, i).Posterior(opts)
+		if err != nil {
+			return blunders, fmt.Errorf("Blunders: shot %d: %v", i+1, err)
+		}
+		best, ok := posterior.Best()
+		if !ok {
+			continue
+		}
+		if posterior.At(best)-posterior.At(shot.Coord) >= threshold {
+			blunders = append(blunders, Blunder{
+				Shot:            i,
+				Coord:           shot.Coord,
+				Probability:     posterior.At(shot.Coord),
+				Best:            best,
+				BestProbability: posterior.At(best),
+			})
+		}
+	}
+	return blunders, nil
+}
+
+func newGrid(size game.Coord) [][]float64 {
+	grid := make([][]float64, size.Y)
+	for i := range grid {
+		grid[i] = make([]float64, size.X)
+	}
+	return grid
+}
+
+func covered(pieces []game.Piece, coord game.Coord) bool {
+	for _, piece := range pieces {
+		if piece.Covers(coord) {
+			return true
+		}
+	}
+	return false
+}
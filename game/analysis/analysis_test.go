@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func TestPosteriorExact(t *testing.T) {
+	testCases := []struct {
+		view     View
+		expected []float64
+	}{
+		{
+			view:     View{Size: game.Coord{X: 3, Y: 1}, Fleet: []game.PieceType{game.PatrolBoat}},
+			expected: []float64{0.5, 1, 0.5},
+		},
+		{
+			view: View{Size: game.Coord{X: 3, Y: 1}, Fleet: []game.PieceType{game.PatrolBoat},
+				Misses: []game.Coord{{X: 0, Y: 0}}},
+			expected: []float64{0, 1, 1},
+		},
+		{
+			view: View{Size: game.Coord{X: 4, Y: 1}, Fleet: []game.PieceType{game.PatrolBoat},
+				Hits: []game.Coord{{X: 0, Y: 0}}},
+			expected: []float64{1, 1, 0, 0},
+		},
+		{
+			// Only the destroyer is left
+			view: View{Size: game.Coord{X: 6, Y: 1}, Fleet: []game.PieceType{game.PatrolBoat, game.Destroyer},
+				Sunk: []game.Piece{{Type: game.PatrolBoat, Start: game.Coord{X: 0, Y: 0}, End: game.Coord{X: 1, Y: 0}}}},
+			expected: []float64{1, 1, 0.5, 1, 1, 0.5},
+		},
+		{
+			// Ships restricted to the left of the board by a handicap
+			view:     View{Size: game.Coord{X: 4, Y: 1}, Area: game.Coord{X: 2, Y: 1}, Fleet: []game.PieceType{game.PatrolBoat}},
+			expected: []float64{1, 1, 0, 0},
+		},
+	}
+	for i, testCase := range testCases {
+		posterior, err := testCase.view.Posterior(Options{})
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if !posterior.Exact {
+			t.Errorf("case %d: expected an exact posterior", i)
+		}
+		for x, expected := range testCase.expected {
+			if p := posterior.Cells[0][x]; math.Abs(p-expected) > 1e-9 {
+				t.Errorf("case %d: expected %v at %v but got %v", i, expected, game.Coord{X: x}.Notation(), p)
+			}
+		}
+	}
+}
+
+func TestPosteriorSampled(t *testing.T) {
+	view := View{
+		Size:   game.Coord{X: 6, Y: 6},
+		Fleet:  []game.PieceType{game.PatrolBoat, game.Destroyer, game.Submarine},
+		Hits:   []game.Coord{{X: 2, Y: 2}},
+		Misses: []game.Coord{{X: 3, Y: 2}, {X: 0, Y: 0}, {X: 5, Y: 5}},
+	}
+	exact, err := view.Posterior(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampled, err := view.Posterior(Options{Rand: rand.New(rand.NewSource(7)), Samples: 20000, ExactLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exact.Exact || sampled.Exact {
+		t.Fatalf("expected one exact and one sampled posterior")
+	}
+	for y := range exact.Cells {
+		for x := range exact.Cells[y] {
+			if diff := math.Abs(exact.Cells[y][x] - sampled.Cells[y][x]); diff > 0.03 {
+				t.Errorf("sampled %v is %v but exact is %v", game.Coord{X: x, Y: y}.Notation(), sampled.Cells[y][x], exact.Cells[y][x])
+			}
+		}
+	}
+}
+
+func TestPosteriorInconsistent(t *testing.T) {
+	view := View{
+		Size:   game.Coord{X: 3, Y: 1},
+		Fleet:  []game.PieceType{game.PatrolBoat},
+		Misses: []game.Coord{{X: 1, Y: 0}},
+	}
+	if _, err := view.Posterior(Options{}); err == nil {
+		t.Errorf("expected an error when no placement agrees with the view")
+	}
+}
+
+func TestHint(t *testing.T) {
+	g := gametest.New(t, 10, 10, gametest.FleetInColumns(2))
+	// Sink the patrol boat and hit the top of the destroyer
+	gametest.Play(t, g, "A1", "J10", "A2", "J9", "C1", "J8")
+
+	view := ViewOf(g, game.Player1)
+	if len(view.Sunk) != 1 || view.Sunk[0].Type != game.PatrolBoat {
+		t.Errorf("expected the patrol boat to be sunk but got %v", view.Sunk)
+	}
+	if len(view.Hits) != 1 || view.Hits[0] != (game.Coord{X: 2, Y: 0}) {
+		t.Errorf("expected a single hit on C1 but got %v", view.Hits)
+	}
+
+	hint, err := Hint(g, game.Player1, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abs(hint.X-2)+abs(hint.Y) != 1 {
+		t.Errorf("expected a hint next to C1 but got %v", hint.Notation())
+	}
+
+	blunders, err := Blunders(g, game.Player2, 0.05, Options{Samples: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Player 2 started in the corner, the least likely cell of the board
+	if len(blunders) == 0 || blunders[0].Shot != 1 {
+		t.Errorf("expected J10 to be a blunder but got %+v", blunders)
+	}
+	for _, blunder := range blunders {
+		if blunder.BestProbability-blunder.Probability < 0.05 {
+			t.Errorf("shot %d is not a blunder: %+v", blunder.Shot, blunder)
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
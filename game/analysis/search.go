@@ -0,0 +1,289 @@
+package analysis
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/jonfk/battleship/game"
+)
+
+const (
+	unknownCell = iota
+	blockedCell
+	hitCell
+)
+
+// coveringBias is how often the sampler places a ship over a hit that is not
+// covered yet instead of anywhere
+const coveringBias = 0.8
+
+// maxSampleAttempts bounds the number of attempts per sample requested
+const maxSampleAttempts = 20
+
+type candidate struct {
+	piece game.Piece
+	// cells are indexes of the covered cells in problem.cells
+	cells []int
+}
+
+// problem is the placement of the remaining fleet over the unknown and hit
+// cells so that every hit is covered
+type problem struct {
+	size  game.Coord
+	cells []int
+	hits  int
+	// fleet is sorted so that ships of the same type are next to each other
+	fleet      []game.PieceType
+	candidates [][]candidate
+	// capacity[i] is the number of cells covered by fleet[i:]
+	capacity []int
+	occupied []bool
+	covered  int
+}
+
+func newProblem(view *View) (*problem, error) {
+	area := view.Area
+	if area == (game.Coord{}) {
+		area = view.Size
+	}
+	p := &problem{
+		size:     view.Size,
+		cells:    make([]int, view.Size.X*view.Size.Y),
+		occupied: make([]bool, view.Size.X*view.Size.Y),
+	}
+	isValid := func(coord game.Coord) bool {
+		return coord.X >= 0 && coord.X < view.Size.X && coord.Y >= 0 && coord.Y < view.Size.Y
+	}
+
+	for _, coord := range view.Misses {
+		if !isValid(coord) {
+			return nil, fmt.Errorf("Posterior: miss %v is outside of the board", coord.Notation())
+		}
+		p.cells[p.index(coord)] = blockedCell
+	}
+	p.fleet = append(p.fleet, view.Fleet...)
+	for _, piece := range view.Sunk {
+		i := indexOf(p.fleet, piece.Type)
+		if i < 0 {
+			return nil, fmt.Errorf("Posterior: sunk %v is not in the fleet", piece.Type)
+		}
+		p.fleet = append(p.fleet[:i], p.fleet[i+1:]...)
+		for _, coord := range piece.Coords() {
+			if !isValid(coord) {
+				return nil, fmt.Errorf("Posterior: sunk %v %v is outside of the board", piece.Type, piece.Notation())
+			}
+			p.cells[p.index(coord)] = blockedCell
+		}
+	}
+	for _, coord := range view.Hits {
+		if !isValid(coord) {
+			return nil, fmt.Errorf("Posterior: hit %v is outside of the board", coord.Notation())
+		}
+		if p.cells[p.index(coord)] == blockedCell {
+			return nil, fmt.Errorf("Posterior: hit %v is also a miss or a sunk ship", coord.Notation())
+		}
+		if p.cells[p.index(coord)] != hitCell {
+			p.cells[p.index(coord)] = hitCell
+			p.hits++
+		}
+	}
+	sort.Slice(p.fleet, func(i, j int) bool { return p.fleet[i] < p.fleet[j] })
+
+	p.capacity = make([]int, len(p.fleet)+1)
+	for i := len(p.fleet) - 1; i >= 0; i-- {
+		p.capacity[i] = p.capacity[i+1] + p.fleet[i].Length()
+	}
+	for _, pieceType := range p.fleet {
+		var candidates []candidate
+		for _, piece := range game.Placements(area, pieceType) {
+			c := candidate{piece: piece}
+			hits := 0
+			for _, coord := range piece.Coords() {
+				i := p.index(coord)
+				if p.cells[i] == hitCell {
+					hits++
+				}
+				c.cells = append(c.cells, i)
+			}
+			// A ship on water or on a sunk ship is impossible and a
+			// ship hit everywhere would have been sunk
+			if p.fits(c) && hits < len(c.cells) {
+				candidates = append(candidates, c)
+			}
+		}
+		p.candidates = append(p.candidates, candidates)
+	}
+	return p, nil
+}
+
+func (p *problem) index(coord game.Coord) int {
+	return coord.Y*p.size.X + coord.X
+}
+
+// searchSpace returns the number of ways to place the fleet ignoring overlaps
+func (p *problem) searchSpace() float64 {
+	space := 1.0
+	for _, candidates := range p.candidates {
+		space *= float64(len(candidates))
+	}
+	return space
+}
+
+func (p *problem) fits(c candidate) bool {
+	for _, i := range c.cells {
+		if p.occupied[i] || p.cells[i] == blockedCell {
+			return false
+		}
+	}
+	return true
+}
+
+// place adds the candidate when set is true and removes it otherwise
+func (p *problem) place(c candidate, set bool) {
+	for _, i := range c.cells {
+		p.occupied[i] = set
+		if p.cells[i] == hitCell {
+			if set {
+				p.covered++
+			} else {
+				p.covered--
+			}
+		}
+	}
+}
+
+// enumerate adds the number of placements covering each cell to counts and
+// returns the number of placements
+func (p *problem) enumerate(counts [][]float64) float64 {
+	placed := make([]candidate, 0, len(p.fleet))
+	var (
+		total  float64
+		search func(i, minIndex int)
+	)
+	search = func(i, minIndex int) {
+		if p.hits-p.covered > p.capacity[i] {
+			return
+		}
+		if i == len(p.fleet) {
+			if p.covered == p.hits {
+				total++
+				p.add(counts, placed, 1)
+			}
+			return
+		}
+		// Ships of the same type are placed in increasing order so that
+		// swapping them is not counted as another placement
+		start := 0
+		if i > 0 && p.fleet[i] == p.fleet[i-1] {
+			start = minIndex
+		}
+		for j := start; j < len(p.candidates[i]); j++ {
+			c := p.candidates[i][j]
+			if !p.fits(c) {
+				continue
+			}
+			p.place(c, true)
+			placed = append(placed, c)
+			search(i+1, j+1)
+			placed = placed[:len(placed)-1]
+			p.place(c, false)
+		}
+	}
+	search(0, 0)
+	return total
+}
+
+// sample draws placements one ship at a time, favouring positions covering
+// hits, and weights each placement by the inverse of its probability of
+// being drawn. It adds the weights of the placements covering each cell to
+// weights and returns the total weight.
+func (p *problem) sample(rng *rand.Rand, samples int, weights [][]float64) float64 {
+	var (
+		total    float64
+		accepted int
+		placed   = make([]candidate, 0, len(p.fleet))
+		valid    []candidate
+		covering []candidate
+	)
+	for attempt := 0; attempt < samples*maxSampleAttempts && accepted < samples; attempt++ {
+		for _, c := range placed {
+			p.place(c, false)
+		}
+		placed = placed[:0]
+		weight := 1.0
+		for i := range p.fleet {
+			if p.hits-p.covered > p.capacity[i] {
+				weight = 0
+				break
+			}
+			valid, covering = valid[:0], covering[:0]
+			for _, c := range p.candidates[i] {
+				if !p.fits(c) {
+					continue
+				}
+				valid = append(valid, c)
+				if p.coversHit(c) {
+					covering = append(covering, c)
+				}
+			}
+			if len(valid) == 0 {
+				weight = 0
+				break
+			}
+
+			var c candidate
+			if len(covering) > 0 && rng.Float64() < coveringBias {
+				c = covering[rng.Intn(len(covering))]
+			} else {
+				c = valid[rng.Intn(len(valid))]
+			}
+			q := 1 / float64(len(valid))
+			if len(covering) > 0 {
+				q *= 1 - coveringBias
+				if p.coversHit(c) {
+					q += coveringBias / float64(len(covering))
+				}
+			}
+			weight /= q
+			p.place(c, true)
+			placed = append(placed, c)
+		}
+		if weight == 0 || p.covered != p.hits {
+			continue
+		}
+		accepted++
+		total += weight
+		p.add(weights, placed, weight)
+	}
+	for _, c := range placed {
+		p.place(c, false)
+	}
+	return total
+}
+
+func (p *problem) coversHit(c candidate) bool {
+	for _, i := range c.cells {
+		if p.cells[i] == hitCell {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *problem) add(grid [][]float64, placed []candidate, weight float64) {
+	for _, c := range placed {
+		for _, i := range c.cells {
+			grid[i/p.size.X][i%p.size.X] += weight
+		}
+	}
+}
+
+func indexOf(pieces []game.PieceType, piece game.PieceType) int {
+	for i, other := range pieces {
+		if other == piece {
+			return i
+		}
+	}
+	return -1
+}
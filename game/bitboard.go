@@ -0,0 +1,268 @@
+package game
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BitBoard is a compact alternative to the [][]GridState representation of a
+// Game meant for fast simulation. Each grid is stored as a bitset of
+// Size.X*Size.Y bits packed into 64 bit words, so a standard 10x10 grid fits
+// in two words (128 bits) and larger boards simply use more words.
+//
+// Every player's grid is made of two bitsets: the cells occupied by ships and
+// the cells that have been shot at. A counter of remaining ship cells makes
+// HasPlayerWon O(1) and Move does not allocate.
+type BitBoard struct {
+	Size        Coord
+	CurrentTurn Player
+	// TurnShots is the number of shots fired so far in the current turn
+	TurnShots int
+	// perTurn is the number of shots each player fires per turn
+	perTurn   [2]int
+	words     int
+	ships     [2][]uint64
+	shots     [2][]uint64
+	remaining [2]int
+	// fleet is the number of ship cells of each player
+	fleet [2]int
+}
+
+func NewBitBoard(x, y int) *BitBoard {
+	board := &BitBoard{Size: Coord{X: x, Y: y}, perTurn: [2]int{1, 1}}
+	board.words = (x*y + 63) / 64
+	// Allocate all four bitsets at once to keep them close in memory
+	backing := make([]uint64, 4*board.words)
+	for i := 0; i < 2; i++ {
+		board.ships[i] = backing[(2*i)*board.words : (2*i+1)*board.words]
+		board.shots[i] = backing[(2*i+1)*board.words : (2*i+2)*board.words]
+	}
+	return board
+}
+
+// NewBitBoardFromGame converts a Game into a BitBoard preserving ships, shots,
+// the current turn and the number of shots each player fires per turn.
+func NewBitBoardFromGame(game *Game) *BitBoard {
+	board := NewBitBoard(game.Size.X, game.Size.Y)
+	board.CurrentTurn = game.CurrentTurn
+	board.TurnShots = game.TurnShots
+	board.perTurn = [2]int{game.Rules.ShotsPerTurn(Player1), game.Rules.ShotsPerTurn(Player2)}
+	for i, grid := range [][][]GridState{game.Player1Grid, game.Player2Grid} {
+		for y := range grid {
+			for x, cell := range grid[y] {
+				word, mask := board.bit(Coord{X: x, Y: y})
+				switch cell {
+				case ShipGrid:
+					board.ships[i][word] |= mask
+					board.remaining[i]++
+					board.fleet[i]++
+				case HitGrid:
+					board.ships[i][word] |= mask
+					board.shots[i][word] |= mask
+					board.fleet[i]++
+				case EmptyHitGrid:
+					board.shots[i][word] |= mask
+				}
+			}
+		}
+	}
+	return board
+}
+
+// SetPiece places a piece on the player's grid following the same rules as
+// Game.SetPiece.
+func (board *BitBoard) SetPiece(player Player, start, end Coord, piece PieceType) error {
+	if piece.Length() < 0 {
+		return newError(ErrInvalidPiece, "SetPiece: piece %v is invalid", piece.String())
+	}
+	if !board.IsValidCoord(start) {
+		return newError(ErrInvalidCoord, "SetPiece: start coordinate %v is invalid", start.Notation())
+	}
+	if !board.IsValidCoord(end) {
+		return newError(ErrInvalidCoord, "SetPiece: end coordinate %v is invalid", end.Notation())
+	}
+	if !player.IsValid() {
+		return newError(ErrInvalidPlayer, "SetPiece: player %v invalid", player)
+	}
+	pieceLength := piece.Length()
+	var step Coord
+	if start.X == end.X && abs(start.Y-end.Y) == (pieceLength-1) {
+		if end.Y < start.Y {
+			start, end = end, start
+		}
+		step = Coord{X: 0, Y: 1}
+	} else if start.Y == end.Y && abs(start.X-end.X) == (pieceLength-1) {
+		if end.X < start.X {
+			start, end = end, start
+		}
+		step = Coord{X: 1, Y: 0}
+	} else {
+		return newError(ErrInvalidPlacement, "SetPiece: invalid start (%v) and end(%v) locations for piece length %d",
+			start.Notation(), end.Notation(), pieceLength)
+	}
+
+	ships := board.ships[player]
+	for i := 0; i < pieceLength; i++ {
+		c := Coord{X: start.X + i*step.X, Y: start.Y + i*step.Y}
+		word, mask := board.bit(c)
+		if ships[word]&mask != 0 {
+			return newError(ErrInvalidPlacement, "SetPiece: piece already at %v obstructs start %v and end %v locations for piece %v",
+				c.Notation(), start.Notation(), end.Notation(), piece)
+		}
+	}
+	for i := 0; i < pieceLength; i++ {
+		word, mask := board.bit(Coord{X: start.X + i*step.X, Y: start.Y + i*step.Y})
+		ships[word] |= mask
+	}
+	board.remaining[player] += pieceLength
+	board.fleet[player] += pieceLength
+	return nil
+}
+
+// Move fires at coord on the opponent's grid and reports whether a ship was
+// hit. It follows the same rules as Game.Move and does not allocate unless it
+// returns an error.
+func (board *BitBoard) Move(player Player, coord Coord) (bool, error) {
+	if !player.IsValid() {
+		return false, newError(ErrInvalidPlayer, "Move: player %v invalid", player)
+	}
+	if board.isOver() {
+		return false, newError(ErrGameOver, "Move: Cannot execute move %v for %v. The game is over", coord.Notation(), player)
+	}
+	if board.CurrentTurn != player {
+		return false, newError(ErrNotYourTurn, "Move: Cannot execute move %v for %v. Currently %v's turn", coord.Notation(), player, board.CurrentTurn)
+	}
+	if !board.IsValidCoord(coord) {
+		return false, newError(ErrInvalidCoord, "Move: Invalid move coordinate %v", coord.Notation())
+	}
+	opponent := player ^ 1
+	word, mask := board.bit(coord)
+	if board.shots[opponent][word]&mask != 0 {
+		return false, newError(ErrAlreadyFired, "Move: Invalid move %v has already been executed before", coord.Notation())
+	}
+	board.shots[opponent][word] |= mask
+	hit := board.ships[opponent][word]&mask != 0
+	if hit {
+		board.remaining[opponent]--
+	}
+	board.TurnShots++
+	if board.TurnShots >= board.perTurn[player] {
+		board.TurnShots = 0
+		board.CurrentTurn = opponent
+	}
+	return hit, nil
+}
+
+// HasPlayerWon reports whether every ship cell of the player's opponent has
+// been hit.
+func (board *BitBoard) HasPlayerWon(player Player) bool {
+	if !player.IsValid() {
+		return false
+	}
+	return board.remaining[player^1] == 0
+}
+
+// Remaining returns the number of ship cells on the player's grid that have
+// not been hit yet.
+func (board *BitBoard) Remaining(player Player) int {
+	if !player.IsValid() {
+		return 0
+	}
+	return board.remaining[player]
+}
+
+// Cell returns the state of a cell of the player's grid using the same
+// GridState values as Game. It is EmptyGrid for an invalid player or
+// coordinate.
+func (board *BitBoard) Cell(player Player, coord Coord) GridState {
+	if !player.IsValid() || !board.IsValidCoord(coord) {
+		return EmptyGrid
+	}
+	word, mask := board.bit(coord)
+	ship := board.ships[player][word]&mask != 0
+	shot := board.shots[player][word]&mask != 0
+	switch {
+	case ship && shot:
+		return HitGrid
+	case ship:
+		return ShipGrid
+	case shot:
+		return EmptyHitGrid
+	default:
+		return EmptyGrid
+	}
+}
+
+// Shots returns the number of shots fired at the player's grid.
+func (board *BitBoard) Shots(player Player) int {
+	if !player.IsValid() {
+		return 0
+	}
+	count := 0
+	for _, word := range board.shots[player] {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// CopyFrom overwrites board with the state of other without allocating.
+// Both boards must have the same size.
+func (board *BitBoard) CopyFrom(other *BitBoard) {
+	if board.Size != other.Size {
+		panic(fmt.Sprintf("CopyFrom: board size %v does not match %v", board.Size, other.Size))
+	}
+	board.CurrentTurn = other.CurrentTurn
+	board.TurnShots = other.TurnShots
+	board.perTurn = other.perTurn
+	board.remaining = other.remaining
+	board.fleet = other.fleet
+	for i := 0; i < 2; i++ {
+		copy(board.ships[i], other.ships[i])
+		copy(board.shots[i], other.shots[i])
+	}
+}
+
+// Clone returns a deep copy of the board.
+func (board *BitBoard) Clone() *BitBoard {
+	clone := NewBitBoard(board.Size.X, board.Size.Y)
+	clone.CopyFrom(board)
+	return clone
+}
+
+// Reset clears all shots while keeping ships in place so the board can be
+// reused for another simulated game.
+func (board *BitBoard) Reset() {
+	for i := 0; i < 2; i++ {
+		count := 0
+		for j := range board.shots[i] {
+			board.shots[i][j] = 0
+			count += bits.OnesCount64(board.ships[i][j])
+		}
+		board.remaining[i] = count
+		board.fleet[i] = count
+	}
+	board.CurrentTurn = Player1
+	board.TurnShots = 0
+}
+
+// isOver reports whether a fleet was sunk. Like Game.Result a game is only
+// over once both fleets are on the board.
+func (board *BitBoard) isOver() bool {
+	return board.fleet[Player1] > 0 && board.fleet[Player2] > 0 &&
+		(board.remaining[Player1] == 0 || board.remaining[Player2] == 0)
+}
+
+func (board *BitBoard) IsValidCoord(coord Coord) bool {
+	if coord.X < 0 || coord.X >= board.Size.X {
+		return false
+	}
+	if coord.Y < 0 || coord.Y >= board.Size.Y {
+		return false
+	}
+	return true
+}
+
+func (board *BitBoard) bit(coord Coord) (int, uint64) {
+	i := coord.Y*board.Size.X + coord.X
+	return i / 64, 1 << uint(i%64)
+}
@@ -0,0 +1,285 @@
+package game_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func TestBitBoardFromGame(t *testing.T) {
+	g := gametest.NewStandard(t)
+	moves := []game.Coord{{0, 0}, {9, 9}, {5, 5}, {1, 2}}
+	for i, coord := range moves {
+		err := g.Move(game.Player(i%2), coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	board := game.NewBitBoardFromGame(g)
+	for i, grid := range [][][]game.GridState{g.Player1Grid, g.Player2Grid} {
+		for y := range grid {
+			for x := range grid[y] {
+				cell := board.Cell(game.Player(i), game.Coord{X: x, Y: y})
+				if cell != grid[y][x] {
+					t.Errorf("%v cell %v should be %v instead it is %v", game.Player(i), game.Coord{X: x, Y: y}, grid[y][x], cell)
+				}
+			}
+		}
+	}
+	if board.CurrentTurn != g.CurrentTurn {
+		t.Errorf("Current turn should be %v instead it is %v", g.CurrentTurn, board.CurrentTurn)
+	}
+	if board.Remaining(game.Player1) != 16 || board.Remaining(game.Player2) != 16 {
+		t.Errorf("Both players should have 16 ship cells remaining, got %d and %d", board.Remaining(game.Player1), board.Remaining(game.Player2))
+	}
+	if board.Shots(game.Player1) != 2 || board.Shots(game.Player2) != 2 {
+		t.Errorf("Both players should have been shot twice, got %d and %d", board.Shots(game.Player1), board.Shots(game.Player2))
+	}
+}
+
+func TestBitBoardShotsPerTurn(t *testing.T) {
+	g := gametest.NewStandard(t)
+	g.Rules.Handicaps[game.Player1].ExtraShots = 1
+	board := game.NewBitBoardFromGame(g)
+	moves := []struct {
+		player game.Player
+		coord  game.Coord
+	}{
+		{game.Player1, game.Coord{X: 9, Y: 9}},
+		{game.Player1, game.Coord{X: 0, Y: 0}},
+		{game.Player2, game.Coord{X: 9, Y: 9}},
+		{game.Player1, game.Coord{X: 8, Y: 8}},
+	}
+	for _, move := range moves {
+		if err := g.Move(move.player, move.coord); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := board.Move(move.player, move.coord); err != nil {
+			t.Fatal(err)
+		}
+		if board.CurrentTurn != g.CurrentTurn || board.TurnShots != g.TurnShots {
+			t.Errorf("After %v turn should be %v with %d shots instead it is %v with %d", move.coord.Notation(),
+				g.CurrentTurn, g.TurnShots, board.CurrentTurn, board.TurnShots)
+		}
+	}
+	if _, err := board.Clone().Move(game.Player2, game.Coord{X: 5, Y: 5}); err == nil {
+		t.Error("Player1 should fire twice before Player2's turn")
+	}
+}
+
+func TestBitBoardSetPiece(t *testing.T) {
+	board := game.NewBitBoard(10, 10)
+	err := board.SetPiece(game.Player1, game.Coord{X: 0, Y: 2}, game.Coord{X: 0, Y: 0}, game.Submarine)
+	if err != nil {
+		t.Error(err)
+	}
+	err = board.SetPiece(game.Player1, game.Coord{X: 0, Y: 1}, game.Coord{X: 1, Y: 1}, game.PatrolBoat)
+	if err == nil {
+		t.Error("Expected error on obstructed piece")
+	}
+	err = board.SetPiece(game.Player1, game.Coord{X: 9, Y: 7}, game.Coord{X: 9, Y: 9}, game.Battleship)
+	if err == nil {
+		t.Error("Expected error on invalid piece length")
+	}
+	err = board.SetPiece(game.Player2, game.Coord{X: 8, Y: 9}, game.Coord{X: 10, Y: 9}, game.Submarine)
+	if err == nil {
+		t.Error("Expected error on piece out of grid")
+	}
+	if board.Remaining(game.Player1) != 3 || board.Remaining(game.Player2) != 0 {
+		t.Errorf("Remaining should be 3 and 0, got %d and %d", board.Remaining(game.Player1), board.Remaining(game.Player2))
+	}
+	if board.Cell(game.Player(2), game.Coord{X: 0, Y: 0}) != game.EmptyGrid || board.Cell(game.Player1, game.Coord{X: 10, Y: 0}) != game.EmptyGrid ||
+		board.Shots(game.Player(-1)) != 0 {
+		t.Error("Invalid players and coordinates should be empty")
+	}
+}
+
+func TestBitBoardMove(t *testing.T) {
+	board := game.NewBitBoardFromGame(gametest.NewStandard(t))
+	hit, err := board.Move(game.Player1, game.Coord{X: 0, Y: 1})
+	if err != nil || !hit {
+		t.Errorf("Expected a hit, got %v and %v", hit, err)
+	}
+	_, err = board.Move(game.Player1, game.Coord{X: 5, Y: 5})
+	if err == nil {
+		t.Error("Expected error when playing out of turn")
+	}
+	hit, err = board.Move(game.Player2, game.Coord{X: 5, Y: 5})
+	if err != nil || hit {
+		t.Errorf("Expected a miss, got %v and %v", hit, err)
+	}
+	_, err = board.Move(game.Player1, game.Coord{X: 0, Y: 1})
+	if err == nil {
+		t.Error("Expected error on repeated move")
+	}
+	_, err = board.Move(game.Player1, game.Coord{X: 10, Y: 1})
+	if err == nil {
+		t.Error("Expected error on invalid move out of grid")
+	}
+	if board.Cell(game.Player2, game.Coord{X: 0, Y: 1}) != game.HitGrid {
+		t.Errorf("Cell should be %v", game.HitGrid)
+	}
+	if board.Cell(game.Player1, game.Coord{X: 5, Y: 5}) != game.EmptyHitGrid {
+		t.Errorf("Cell should be %v", game.EmptyHitGrid)
+	}
+	board.CurrentTurn = game.Player(2)
+	if _, err := board.Move(game.Player(2), game.Coord{X: 5, Y: 5}); !errors.Is(err, game.ErrInvalidPlayer) {
+		t.Errorf("expected %v to be %v", err, game.ErrInvalidPlayer)
+	}
+}
+
+func TestBitBoardGameWon(t *testing.T) {
+	g := gametest.NewStandard(t)
+	board := game.NewBitBoardFromGame(g)
+Game:
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			_, err := board.Move(game.Player1, game.Coord{X: x, Y: y})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = g.Move(game.Player1, game.Coord{X: x, Y: y})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if board.HasPlayerWon(game.Player1) != g.HasPlayerWon(game.Player1) {
+				t.Fatalf("BitBoard and Game disagree on winner after %v", game.Coord{X: x, Y: y})
+			}
+			if _, over := g.Result(); over {
+				break Game
+			}
+			board.CurrentTurn = game.Player1
+			g.CurrentTurn = game.Player1
+		}
+	}
+	if !board.HasPlayerWon(game.Player1) || board.HasPlayerWon(game.Player2) {
+		t.Error("Player1 should have won")
+	}
+	for _, player := range []game.Player{game.Player1, game.Player2} {
+		board.CurrentTurn = player
+		if _, err := board.Move(player, game.Coord{X: 9, Y: 9}); !errors.Is(err, game.ErrGameOver) {
+			t.Errorf("expected %v to be %v", err, game.ErrGameOver)
+		}
+	}
+
+	board.Reset()
+	if board.HasPlayerWon(game.Player1) || board.Shots(game.Player2) != 0 || board.Remaining(game.Player2) != 17 {
+		t.Error("Reset should clear all shots")
+	}
+}
+
+func TestBitBoardLarge(t *testing.T) {
+	board := game.NewBitBoard(30, 27)
+	err := board.SetPiece(game.Player2, game.Coord{X: 29, Y: 22}, game.Coord{X: 29, Y: 26}, game.AircraftCarrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 22; y < 27; y++ {
+		board.CurrentTurn = game.Player1
+		hit, err := board.Move(game.Player1, game.Coord{X: 29, Y: y})
+		if err != nil || !hit {
+			t.Fatalf("Expected a hit at %v, got %v and %v", game.Coord{X: 29, Y: y}, hit, err)
+		}
+	}
+	if !board.HasPlayerWon(game.Player1) {
+		t.Error("Player1 should have won")
+	}
+}
+
+func TestBitBoardCopyFrom(t *testing.T) {
+	board := game.NewBitBoardFromGame(gametest.NewStandard(t))
+	clone := board.Clone()
+	_, err := clone.Move(game.Player1, game.Coord{X: 0, Y: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.Cell(game.Player2, game.Coord{X: 0, Y: 0}) != game.ShipGrid || board.Remaining(game.Player2) != 17 {
+		t.Error("Move on clone changed the original board")
+	}
+	board.CopyFrom(clone)
+	if board.Cell(game.Player2, game.Coord{X: 0, Y: 0}) != game.HitGrid || board.Remaining(game.Player2) != 16 {
+		t.Error("CopyFrom should copy the state of the other board")
+	}
+}
+
+func TestBitBoardMoveDoesNotAllocate(t *testing.T) {
+	board := game.NewBitBoardFromGame(gametest.NewStandard(t))
+	start := board.Clone()
+	allocs := testing.AllocsPerRun(100, func() {
+		board.CopyFrom(start)
+	Game:
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 10; x++ {
+				for _, player := range []game.Player{game.Player1, game.Player2} {
+					board.Move(player, game.Coord{X: x, Y: y})
+					if board.HasPlayerWon(player) {
+						break Game
+					}
+				}
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Simulated game should not allocate, got %v allocations", allocs)
+	}
+}
+
+// Both benchmarks play a full game where each player fires at every cell in
+// order, checking for a winner after every move.
+
+func BenchmarkGameSimulation(b *testing.B) {
+	start := gametest.NewStandard(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		g := start.Clone()
+	Game:
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 10; x++ {
+				for _, player := range []game.Player{game.Player1, game.Player2} {
+					g.Move(player, game.Coord{X: x, Y: y})
+					if g.HasPlayerWon(player) {
+						break Game
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkBitBoardSimulation(b *testing.B) {
+	start := game.NewBitBoardFromGame(gametest.NewStandard(b))
+	board := start.Clone()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		board.CopyFrom(start)
+	Game:
+		for y := 0; y < 10; y++ {
+			for x := 0; x < 10; x++ {
+				for _, player := range []game.Player{game.Player1, game.Player2} {
+					board.Move(player, game.Coord{X: x, Y: y})
+					if board.HasPlayerWon(player) {
+						break Game
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkGameHasPlayerWon(b *testing.B) {
+	g := gametest.NewStandard(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		g.HasPlayerWon(game.Player1)
+	}
+}
+
+func BenchmarkBitBoardHasPlayerWon(b *testing.B) {
+	board := game.NewBitBoardFromGame(gametest.NewStandard(b))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		board.HasPlayerWon(game.Player1)
+	}
+}
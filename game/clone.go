@@ -0,0 +1,178 @@
+package game
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Clone returns a deep copy of the game. The copy shares no grid rows, ship
+// lists or player names with the original so it can be mutated freely.
+func (game *Game) Clone() *Game {
+	if game == nil {
+		return nil
+	}
+	clone := *game
+	clone.Player1Grid = cloneGrid(game.Player1Grid)
+	clone.Player2Grid = cloneGrid(game.Player2Grid)
+	clone.Player1 = cloneString(game.Player1)
+	clone.Player2 = cloneString(game.Player2)
+	clone.Player1Ships = clonePieces(game.Player1Ships)
+	clone.Player2Ships = clonePieces(game.Player2Ships)
+	if game.History != nil {
+		clone.History = make([]Shot, len(game.History))
+		copy(clone.History, game.History)
+	}
+	if game.Reveals != nil {
+		clone.Reveals = make([]FreeReveal, len(game.Reveals))
+		copy(clone.Reveals, game.Reveals)
+	}
+	clone.Rules = game.Rules.Clone()
+	if game.Outcome != nil {
+		outcome := *game.Outcome
+		clone.Outcome = &outcome
+	}
+	return &clone
+}
+
+// Equal reports whether both games have the same rules, size, players, ships,
+// grids, current turn, reveals, draw offers and outcome. The history is not
+// compared so games reaching the same position through different move orders
+// are equal.
+func (game *Game) Equal(other *Game) bool {
+	if game == nil || other == nil {
+		return game == other
+	}
+	return game.Size == other.Size &&
+		game.CurrentTurn == other.CurrentTurn &&
+		game.TurnShots == other.TurnShots &&
+		game.RevealsUsed == other.RevealsUsed &&
+		game.Rules.Equal(other.Rules) &&
+		game.DrawOffers == other.DrawOffers &&
+		equalResult(game.Outcome, other.Outcome) &&
+		equalString(game.Player1, other.Player1) &&
+		equalString(game.Player2, other.Player2) &&
+		equalPieces(game.Player1Ships, other.Player1Ships) &&
+		equalPieces(game.Player2Ships, other.Player2Ships) &&
+		equalGrid(game.Player1Grid, other.Player1Grid) &&
+		equalGrid(game.Player2Grid, other.Player2Grid)
+}
+
+// Hash returns a 64 bit FNV-1a hash of the position: the board size, both
+// grids, both ship lists, whose turn it is, how many shots were fired in the
+// turn and the outcome if the game ended without a fleet being sunk. Player
+// names are not part of the position. Equal games always have the same hash,
+// so it can be used as a key for transposition tables. A nil game hashes to 0.
+func (game *Game) Hash() uint64 {
+	if game == nil {
+		return 0
+	}
+	h := fnv.New64a()
+	var buf [binary.MaxVarintLen64]byte
+	writeInt := func(i int) {
+		n := binary.PutVarint(buf[:], int64(i))
+		h.Write(buf[:n])
+	}
+
+	writeInt(game.Size.X)
+	writeInt(game.Size.Y)
+	writeInt(int(game.CurrentTurn))
+	writeInt(game.TurnShots)
+	if game.Outcome != nil {
+		writeInt(int(game.Outcome.Winner))
+		writeInt(int(game.Outcome.Reason))
+	}
+	for _, grid := range [][][]GridState{game.Player1Grid, game.Player2Grid} {
+		writeInt(len(grid))
+		for _, row := range grid {
+			writeInt(len(row))
+			for _, cell := range row {
+				h.Write([]byte{byte(cell)})
+			}
+		}
+	}
+	for _, ships := range [][]Piece{game.Player1Ships, game.Player2Ships} {
+		writeInt(len(ships))
+		for _, ship := range ships {
+			writeInt(int(ship.Type))
+			writeInt(ship.Start.X)
+			writeInt(ship.Start.Y)
+			writeInt(ship.End.X)
+			writeInt(ship.End.Y)
+		}
+	}
+	return h.Sum64()
+}
+
+func cloneGrid(grid [][]GridState) [][]GridState {
+	if grid == nil {
+		return nil
+	}
+	clone := make([][]GridState, len(grid))
+	for i := range grid {
+		if grid[i] != nil {
+			clone[i] = make([]GridState, len(grid[i]))
+			copy(clone[i], grid[i])
+		}
+	}
+	return clone
+}
+
+func cloneString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	return &clone
+}
+
+func clonePieces(pieces []Piece) []Piece {
+	if pieces == nil {
+		return nil
+	}
+	clone := make([]Piece, len(pieces))
+	copy(clone, pieces)
+	return clone
+}
+
+func equalGrid(a, b [][]GridState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func equalResult(a, b *Result) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalPieces(a, b []Piece) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
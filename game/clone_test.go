@@ -0,0 +1,140 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func TestCloneIsDeep(t *testing.T) {
+	g := gametest.NewStandard(t)
+	clone := g.Clone()
+	if !clone.Equal(g) {
+		t.Fatalf("Clone should be equal to original\nclone: %v\noriginal: %v", clone, g)
+	}
+	if clone.Hash() != g.Hash() {
+		t.Errorf("Clone hash %x should be the same as original hash %x", clone.Hash(), g.Hash())
+	}
+
+	err := clone.Move(game.Player1, game.Coord{X: 0, Y: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	*clone.Player1 = "someone else"
+	clone.Player2Ships[0].Type = game.AircraftCarrier
+	clone.SetPlayer(game.Player2, "another")
+
+	if g.Player2Grid[0][0] != game.ShipGrid {
+		t.Errorf("Move on clone changed original grid to %v", g.Player2Grid[0][0])
+	}
+	if g.CurrentTurn != game.Player1 {
+		t.Errorf("Move on clone changed original turn to %v", g.CurrentTurn)
+	}
+	if *g.Player1 != "jonfk" || *g.Player2 != "gery" {
+		t.Errorf("Changing clone names changed original names to %v and %v", *g.Player1, *g.Player2)
+	}
+	if g.Player2Ships[0].Type != game.PatrolBoat {
+		t.Errorf("Changing clone ships changed original ship to %v", g.Player2Ships[0].Type)
+	}
+	if clone.Equal(g) {
+		t.Error("Modified clone should not be equal to original")
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	var g *game.Game
+	if g.Clone() != nil {
+		t.Error("Clone of nil game should be nil")
+	}
+	if !g.Equal(nil) {
+		t.Error("nil games should be equal")
+	}
+	if g.Equal(game.NewGame(10, 10)) || game.NewGame(10, 10).Equal(g) {
+		t.Error("nil game should not be equal to a non nil game")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(g *game.Game)
+	}{
+		{"size", func(g *game.Game) { g.Size.X = 9 }},
+		{"turn", func(g *game.Game) { g.CurrentTurn = game.Player2 }},
+		{"player1 name", func(g *game.Game) { g.SetPlayer(game.Player1, "other") }},
+		{"player2 nil", func(g *game.Game) { g.Player2 = nil }},
+		{"player1 grid", func(g *game.Game) { g.Player1Grid[9][9] = game.EmptyHitGrid }},
+		{"player2 grid", func(g *game.Game) { g.Player2Grid[0][0] = game.HitGrid }},
+		{"player1 ships", func(g *game.Game) { g.Player1Ships = g.Player1Ships[1:] }},
+		{"player2 ship end", func(g *game.Game) { g.Player2Ships[4].End.Y = 5 }},
+	}
+	original := gametest.NewStandard(t)
+	for _, test := range tests {
+		modified := original.Clone()
+		test.modify(modified)
+		if original.Equal(modified) || modified.Equal(original) {
+			t.Errorf("%s: games should not be equal", test.name)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	g := gametest.NewStandard(t)
+	hash := g.Hash()
+	if game.NewGame(10, 10).Hash() == hash {
+		t.Error("Empty game should not hash the same as a game with ships")
+	}
+	var none *game.Game
+	if none.Hash() != 0 {
+		t.Error("A nil game should hash to 0")
+	}
+
+	named := g.Clone()
+	named.SetPlayer(game.Player1, "other")
+	if named.Hash() != hash {
+		t.Error("Player names should not change the hash of the position")
+	}
+
+	moved := g.Clone()
+	err := moved.Move(game.Player1, game.Coord{X: 5, Y: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Hash() == hash {
+		t.Error("Hash should change after a move")
+	}
+
+	// The same cell hit by a different player is a different position
+	other := g.Clone()
+	other.CurrentTurn = game.Player2
+	err = other.Move(game.Player2, game.Coord{X: 5, Y: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Hash() == moved.Hash() {
+		t.Error("Moves by different players should hash differently")
+	}
+
+	// The same positions reached by different move orders hash the same
+	a := g.Clone()
+	b := g.Clone()
+	for _, move := range []struct {
+		game   *game.Game
+		player game.Player
+		coord  game.Coord
+	}{
+		{a, game.Player1, game.Coord{X: 1, Y: 1}}, {a, game.Player2, game.Coord{X: 2, Y: 2}},
+		{a, game.Player1, game.Coord{X: 3, Y: 3}}, {a, game.Player2, game.Coord{X: 4, Y: 4}},
+		{b, game.Player1, game.Coord{X: 3, Y: 3}}, {b, game.Player2, game.Coord{X: 4, Y: 4}},
+		{b, game.Player1, game.Coord{X: 1, Y: 1}}, {b, game.Player2, game.Coord{X: 2, Y: 2}},
+	} {
+		err := move.game.Move(move.player, move.coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !a.Equal(b) || a.Hash() != b.Hash() {
+		t.Error("Transposed move orders should give equal positions with equal hashes")
+	}
+}
@@ -0,0 +1,39 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the game can be matched against these with errors.Is
+var (
+	ErrInvalidPlayer    = errors.New("invalid player")
+	ErrInvalidPiece     = errors.New("invalid piece")
+	ErrInvalidCoord     = errors.New("invalid coordinate")
+	ErrInvalidPlacement = errors.New("invalid placement")
+	ErrInvalidRules     = errors.New("invalid rules")
+	ErrNotYourTurn      = errors.New("not your turn")
+	ErrAlreadyFired     = errors.New("already fired at coordinate")
+	ErrGameOver         = errors.New("game is over")
+	ErrNoRevealsLeft    = errors.New("no free reveals left")
+	ErrNoDrawOffer      = errors.New("no draw offer")
+)
+
+// gameError is an error with a detailed message that matches one of the
+// sentinel errors above
+type gameError struct {
+	kind error
+	msg  string
+}
+
+func newError(kind error, format string, args ...interface{}) error {
+	return &gameError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+func (err *gameError) Error() string {
+	return err.msg
+}
+
+func (err *gameError) Unwrap() error {
+	return err.kind
+}
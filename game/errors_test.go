@@ -0,0 +1,50 @@
+package game_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func TestErrors(t *testing.T) {
+	g := gametest.NewStandard(t)
+	if err := g.Move(game.Player1, game.Coord{X: 5, Y: 5}); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		err      error
+		expected error
+	}{
+		{g.Move(game.Player1, game.Coord{X: 1, Y: 1}), game.ErrNotYourTurn},
+		{g.Move(game.Player2, game.Coord{X: 10, Y: 1}), game.ErrInvalidCoord},
+		{g.SetPiece(game.Player1, game.Coord{X: 5, Y: 5}, game.Coord{X: 5, Y: 6}, game.PatrolBoat), game.ErrInvalidPlacement},
+		{g.SetPiece(game.Player(5), game.Coord{X: 5, Y: 5}, game.Coord{X: 5, Y: 6}, game.PatrolBoat), game.ErrInvalidPlayer},
+		{g.AcceptDraw(game.Player2), game.ErrNoDrawOffer},
+		{(game.Rules{}).Validate(), game.ErrInvalidRules},
+	}
+	for i, testCase := range testCases {
+		if !errors.Is(testCase.err, testCase.expected) {
+			t.Errorf("case %d: expected %v to be %v", i, testCase.err, testCase.expected)
+		}
+	}
+
+	if err := g.Move(game.Player2, game.Coord{X: 0, Y: 0}); err != nil {
+		t.Fatal(err)
+	}
+	err := g.Move(game.Player1, game.Coord{X: 5, Y: 5})
+	if !errors.Is(err, game.ErrAlreadyFired) {
+		t.Errorf("expected %v to be %v", err, game.ErrAlreadyFired)
+	}
+	// The detailed message is kept
+	if !strings.Contains(err.Error(), "F6") {
+		t.Errorf("expected the error to name the coordinate but got %q", err)
+	}
+
+	g.Resign(game.Player1)
+	if err := g.Move(game.Player2, game.Coord{X: 1, Y: 1}); !errors.Is(err, game.ErrGameOver) {
+		t.Errorf("expected %v to be %v", err, game.ErrGameOver)
+	}
+}
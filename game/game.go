@@ -1,5 +1,7 @@
 //go:generate stringer -type=PieceType
 //go:generate stringer -type=Player
+//go:generate stringer -type=ShotResult
+//go:generate stringer -type=EndReason
 package game
 
 import (
@@ -16,6 +18,17 @@ type Game struct {
 	Player1Ships []Piece
 	Player2Ships []Piece
 	CurrentTurn  Player
+	History      []Shot
+	// Outcome is set when the game ends for any reason other than a fleet
+	// being sunk, see Result
+	Outcome    *Result
+	DrawOffers [2]bool
+	Rules      Rules
+	// TurnShots is the number of shots fired so far in the current turn
+	TurnShots   int
+	RevealsUsed [2]int
+	// Reveals are the free reveals used so far, in order
+	Reveals []FreeReveal
 }
 
 type Coord struct {
@@ -60,6 +73,24 @@ func (piece Piece) Length() int {
 	return piece.Type.Length()
 }
 
+// Coords returns every cell covered by the piece from Start to End
+func (piece Piece) Coords() []Coord {
+	dx, dy := sign(piece.End.X-piece.Start.X), sign(piece.End.Y-piece.Start.Y)
+	n := max(abs(piece.End.X-piece.Start.X), abs(piece.End.Y-piece.Start.Y)) + 1
+	coords := make([]Coord, n)
+	for i := range coords {
+		coords[i] = Coord{X: piece.Start.X + i*dx, Y: piece.Start.Y + i*dy}
+	}
+	return coords
+}
+
+// Covers reports whether the piece covers coord
+func (piece Piece) Covers(coord Coord) bool {
+	minX, maxX := min(piece.Start.X, piece.End.X), max(piece.Start.X, piece.End.X)
+	minY, maxY := min(piece.Start.Y, piece.End.Y), max(piece.Start.Y, piece.End.Y)
+	return coord.X >= minX && coord.X <= maxX && coord.Y >= minY && coord.Y <= maxY
+}
+
 type Player int
 
 const (
@@ -67,6 +98,13 @@ const (
 	Player2
 )
 
+func (player Player) Opponent() Player {
+	if player == Player1 {
+		return Player2
+	}
+	return Player1
+}
+
 func (player Player) IsValid() bool {
 	if player < Player1 || player > Player2 {
 		return false
@@ -83,8 +121,54 @@ const (
 	EmptyHitGrid
 )
 
+type ShotResult int
+
+const (
+	Miss ShotResult = iota
+	Hit
+	Sunk
+)
+
+// Shot is a move played in the game along with its result
+type Shot struct {
+	Player Player
+	Coord  Coord
+	Result ShotResult
+}
+
+// FreeReveal is a free reveal used by a player along with its result. Shots
+// is the length of the history when it was used.
+type FreeReveal struct {
+	Player Player
+	Coord  Coord
+	Ship   bool
+	Shots  int
+}
+
+type EndReason int
+
+const (
+	FleetSunk EndReason = iota
+	Resignation
+	DrawAgreement
+	Timeout
+	Disconnect
+)
+
+// Result is the outcome of a finished game. Winner is meaningless when the
+// game ended in a draw.
+type Result struct {
+	Winner Player
+	Reason EndReason
+}
+
+func (result Result) IsDraw() bool {
+	return result.Reason == DrawAgreement
+}
+
 func NewGame(x, y int) *Game {
 	newGame := &Game{Size: Coord{X: x, Y: y}}
+	newGame.Rules = Rules{Size: newGame.Size, Fleet: StandardFleet()}
 	newGame.Player1Grid = make([][]GridState, y)
 	newGame.Player2Grid = make([][]GridState, y)
 
@@ -97,16 +181,23 @@ func NewGame(x, y int) *Game {
 
 func (game *Game) SetPiece(player Player, start, end Coord, piece PieceType) error {
 	if piece.Length() < 0 {
-		return fmt.Errorf("SetPiece: piece %v is invalid", piece.String())
+		return newError(ErrInvalidPiece, "SetPiece: piece %v is invalid", piece.String())
 	}
 	if !game.IsValidCoord(start) {
-		return fmt.Errorf("SetPiece: start coordinate %#v is invalid", start)
+		return newError(ErrInvalidCoord, "SetPiece: start coordinate %v is invalid", start.Notation())
 	}
 	if !game.IsValidCoord(end) {
-		return fmt.Errorf("SetPiece: end coordinate %#v is invalid", end)
+		return newError(ErrInvalidCoord, "SetPiece: end coordinate %v is invalid", end.Notation())
 	}
 	if !player.IsValid() {
-		return fmt.Errorf("SetPiece: player %v invalid", player)
+		return newError(ErrInvalidPlayer, "SetPiece: player %v invalid", player)
+	}
+	area := game.Rules.AreaOf(player)
+	if max(start.X, end.X) >= area.X || max(start.Y, end.Y) >= area.Y {
+		return newError(ErrInvalidPlacement, "SetPiece: %v must be placed within %v", piece, Coord{X: area.X - 1, Y: area.Y - 1}.Notation())
+	}
+	if game.placed(player, piece) >= count(game.Rules.FleetOf(player), piece) {
+		return newError(ErrInvalidPlacement, "SetPiece: %v has no %v left to place", player, piece)
 	}
 	pieceLength := piece.Length()
 	var grid [][]GridState
@@ -128,7 +219,8 @@ func (game *Game) SetPiece(player Player, start, end Coord, piece PieceType) err
 		// check grid for obstructing piece
 		for i := start.Y; i <= end.Y; i++ {
 			if grid[i][start.X] != EmptyGrid {
-				return fmt.Errorf("SetPiece: piece already at %v obstructs start %v and end %v locations for piece %v", Coord{X: start.X, Y: i}, start, end, piece)
+				return newError(ErrInvalidPlacement, "SetPiece: piece already at %v obstructs start %v and end %v locations for piece %v",
+					Coord{X: start.X, Y: i}.Notation(), start.Notation(), end.Notation(), piece)
 			}
 		}
 
@@ -143,7 +235,8 @@ func (game *Game) SetPiece(player Player, start, end Coord, piece PieceType) err
 		// check grid for obstructing piece
 		for i := start.X; i <= end.X; i++ {
 			if grid[start.Y][i] != EmptyGrid {
-				return fmt.Errorf("SetPiece: piece already at %v obstructs start %v and end %v locations for piece %v", Coord{X: i, Y: start.Y}, start, end, piece)
+				return newError(ErrInvalidPlacement, "SetPiece: piece already at %v obstructs start %v and end %v locations for piece %v",
+					Coord{X: i, Y: start.Y}.Notation(), start.Notation(), end.Notation(), piece)
 			}
 		}
 
@@ -152,7 +245,8 @@ func (game *Game) SetPiece(player Player, start, end Coord, piece PieceType) err
 		}
 
 	} else {
-		return fmt.Errorf("SetPiece: invalid start (%v) and end(%v) locations for piece length %d", start, end, pieceLength)
+		return newError(ErrInvalidPlacement, "SetPiece: invalid start (%v) and end(%v) locations for piece length %d",
+			start.Notation(), end.Notation(), pieceLength)
 	}
 	switch player {
 	case Player1:
@@ -164,41 +258,135 @@ func (game *Game) SetPiece(player Player, start, end Coord, piece PieceType) err
 }
 
 func (game *Game) Move(player Player, coord Coord) error {
+	if _, over := game.Result(); over {
+		return newError(ErrGameOver, "Move: Cannot execute move %v for %v. The game is over", coord.Notation(), player)
+	}
 	if game.CurrentTurn != player {
-		return fmt.Errorf("Move: Cannot execute move %v for %v. Currently %v's turn", coord, player, game.CurrentTurn)
+		return newError(ErrNotYourTurn, "Move: Cannot execute move %v for %v. Currently %v's turn", coord.Notation(), player, game.CurrentTurn)
 	}
 	if !game.IsValidCoord(coord) {
-		return fmt.Errorf("Move: Invalid move coordinate %v", coord)
+		return newError(ErrInvalidCoord, "Move: Invalid move coordinate %v", coord.Notation())
 	}
-	var grid [][]GridState
+	var (
+		grid     [][]GridState
+		opponent Player
+	)
 	switch player {
 	case Player1:
 		grid = game.Player2Grid
+		opponent = Player2
 	case Player2:
 		grid = game.Player1Grid
+		opponent = Player1
 	}
+	shot := Shot{Player: player, Coord: coord}
 	if grid[coord.Y][coord.X] == EmptyGrid {
 		grid[coord.Y][coord.X] = EmptyHitGrid
+		shot.Result = Miss
 	} else if grid[coord.Y][coord.X] == ShipGrid {
 		grid[coord.Y][coord.X] = HitGrid
+		shot.Result = Hit
+		if piece, ok := game.PieceAt(opponent, coord); ok && game.IsSunk(opponent, piece) {
+			shot.Result = Sunk
+		}
 	} else {
-		return fmt.Errorf("Move: Invalid move %v has already been executed before", coord)
+		return newError(ErrAlreadyFired, "Move: Invalid move %v has already been executed before", coord.Notation())
+	}
+	game.History = append(game.History, shot)
+	// Playing on declines the opponent's draw offer
+	game.DrawOffers[opponent] = false
+	game.TurnShots++
+	if game.TurnShots >= game.Rules.ShotsPerTurn(player) {
+		game.changeTurn()
 	}
-	game.changeTurn()
 	return nil
 
 }
 
+// PieceAt returns the piece of the player's fleet covering coord
+func (game *Game) PieceAt(player Player, coord Coord) (Piece, bool) {
+	var ships []Piece
+	switch player {
+	case Player1:
+		ships = game.Player1Ships
+	case Player2:
+		ships = game.Player2Ships
+	}
+	for _, piece := range ships {
+		if piece.Covers(coord) {
+			return piece, true
+		}
+	}
+	return Piece{}, false
+}
+
+// IsSunk reports whether every cell of the player's piece has been hit
+func (game *Game) IsSunk(player Player, piece Piece) bool {
+	var grid [][]GridState
+	switch player {
+	case Player1:
+		grid = game.Player1Grid
+	case Player2:
+		grid = game.Player2Grid
+	default:
+		return false
+	}
+	for _, coord := range piece.Coords() {
+		if !game.IsValidCoord(coord) || grid[coord.Y][coord.X] != HitGrid {
+			return false
+		}
+	}
+	return true
+}
+
+// Reveal uses one of the player's free reveals to find out whether a ship is
+// at coord on the opponent's grid. It does not fire a shot or use the turn.
+func (game *Game) Reveal(player Player, coord Coord) (bool, error) {
+	if _, over := game.Result(); over {
+		return false, newError(ErrGameOver, "Reveal: Cannot reveal %v for %v. The game is over", coord.Notation(), player)
+	}
+	if game.CurrentTurn != player {
+		return false, newError(ErrNotYourTurn, "Reveal: Cannot reveal %v for %v. Currently %v's turn", coord.Notation(), player, game.CurrentTurn)
+	}
+	if !game.IsValidCoord(coord) {
+		return false, newError(ErrInvalidCoord, "Reveal: Invalid reveal coordinate %v", coord.Notation())
+	}
+	if game.RevealsUsed[player] >= game.Rules.Handicaps[player].FreeReveals {
+		return false, newError(ErrNoRevealsLeft, "Reveal: %v has no free reveals left", player)
+	}
+	game.RevealsUsed[player]++
+	_, ok := game.PieceAt(player.Opponent(), coord)
+	game.Reveals = append(game.Reveals, FreeReveal{Player: player, Coord: coord, Ship: ok, Shots: len(game.History)})
+	return ok, nil
+}
+
 func (game *Game) IsReadyToStart() bool {
-	var p1Ships map[PieceType]bool = make(map[PieceType]bool)
-	var p2Ships map[PieceType]bool = make(map[PieceType]bool)
-	for _, val := range game.Player1Ships {
-		p1Ships[val.Type] = true
+	for _, player := range []Player{Player1, Player2} {
+		for _, piece := range game.Rules.FleetOf(player) {
+			if game.placed(player, piece) < count(game.Rules.FleetOf(player), piece) {
+				return false
+			}
+		}
 	}
-	for _, val := range game.Player2Ships {
-		p2Ships[val.Type] = true
+	return game.Player1 != nil && game.Player2 != nil
+}
+
+// placed returns how many pieces of a type the player has placed
+func (game *Game) placed(player Player, piece PieceType) int {
+	var ships []Piece
+	switch player {
+	case Player1:
+		ships = game.Player1Ships
+	case Player2:
+		ships = game.Player2Ships
 	}
-	return game.Player1 != nil && game.Player2 != nil && len(p1Ships) >= 5 && len(p2Ships) >= 5
+	n := 0
+	for _, ship := range ships {
+		if ship.Type == piece {
+			n++
+		}
+	}
+	return n
 }
 
 func (game *Game) SetPlayer(player Player, name string) {
@@ -231,7 +419,79 @@ func (game *Game) HasPlayerWon(player Player) bool {
 	return true
 }
 
+// Result returns the outcome of the game and whether it is over. A game is over
+// once either player sank the opponent's whole fleet, resigned, forfeited or
+// when both players agreed to a draw.
+func (game *Game) Result() (Result, bool) {
+	if game.Outcome != nil {
+		return *game.Outcome, true
+	}
+	// A player can only win once both fleets are on the board
+	if len(game.Player1Ships) == 0 || len(game.Player2Ships) == 0 {
+		return Result{}, false
+	}
+	for _, player := range []Player{Player1, Player2} {
+		if game.HasPlayerWon(player) {
+			return Result{Winner: player, Reason: FleetSunk}, true
+		}
+	}
+	return Result{}, false
+}
+
+// Resign ends the game with the player's opponent as the winner
+func (game *Game) Resign(player Player) error {
+	return game.Forfeit(player, Resignation)
+}
+
+// Forfeit ends the game with the player losing for the given reason, which
+// should be one of Resignation, Timeout or Disconnect.
+func (game *Game) Forfeit(player Player, reason EndReason) error {
+	if !player.IsValid() {
+		return newError(ErrInvalidPlayer, "Forfeit: player %v invalid", player)
+	}
+	switch reason {
+	case Resignation, Timeout, Disconnect:
+	default:
+		return fmt.Errorf("Forfeit: %v is not a reason to forfeit", reason)
+	}
+	if _, over := game.Result(); over {
+		return newError(ErrGameOver, "Forfeit: %v cannot forfeit. The game is over", player)
+	}
+	game.Outcome = &Result{Winner: player.Opponent(), Reason: reason}
+	return nil
+}
+
+// OfferDraw offers a draw to the player's opponent. The offer stands until the
+// opponent accepts it or plays a move.
+func (game *Game) OfferDraw(player Player) error {
+	if !player.IsValid() {
+		return newError(ErrInvalidPlayer, "OfferDraw: player %v invalid", player)
+	}
+	if _, over := game.Result(); over {
+		return newError(ErrGameOver, "OfferDraw: %v cannot offer a draw. The game is over", player)
+	}
+	game.DrawOffers[player] = true
+	return nil
+}
+
+// AcceptDraw ends the game in a draw if the player's opponent offered one
+func (game *Game) AcceptDraw(player Player) error {
+	if !player.IsValid() {
+		return newError(ErrInvalidPlayer, "AcceptDraw: player %v invalid", player)
+	}
+	if _, over := game.Result(); over {
+		return newError(ErrGameOver, "AcceptDraw: %v cannot accept a draw. The game is over", player)
+	}
+	if !game.DrawOffers[player.Opponent()] {
+		return newError(ErrNoDrawOffer, "AcceptDraw: %v did not offer a draw", player.Opponent())
+	}
+	game.Outcome = &Result{Reason: DrawAgreement}
+	game.DrawOffers = [2]bool{}
+	return nil
+}
+
 func (game *Game) changeTurn() {
+	game.TurnShots = 0
 	if game.CurrentTurn == Player1 {
 		game.CurrentTurn = Player2
 	} else {
@@ -273,11 +533,11 @@ func (game *Game) String() string {
 	buf.WriteString(fmt.Sprintf("Players: 1: %v, 2: %v\n", player1Name, player2Name))
 	buf.WriteString(fmt.Sprint("Players 1 Ships:\n"))
 	for _, v := range game.Player1Ships {
-		buf.WriteString(fmt.Sprintf("\t%#v\n", v))
+		buf.WriteString(fmt.Sprintf("\t%v %v\n", v.Type, v.Notation()))
 	}
 	buf.WriteString(fmt.Sprint("Players 2 Ships:\n"))
 	for _, v := range game.Player2Ships {
-		buf.WriteString(fmt.Sprintf("\t%#v\n", v))
+		buf.WriteString(fmt.Sprintf("\t%v %v\n", v.Type, v.Notation()))
 	}
 
 	buf.WriteString(fmt.Sprint("Players 1 Grid:\n"))
@@ -317,6 +577,16 @@ func AllPieceTypes() <-chan PieceType {
 	return ch
 }
 
+func count(pieces []PieceType, piece PieceType) int {
+	n := 0
+	for _, p := range pieces {
+		if p == piece {
+			n++
+		}
+	}
+	return n
+}
+
 func abs(x int) int {
 	if x < 0 {
 		return -x
@@ -332,3 +602,21 @@ func min(x, y int) int {
 		return x
 	}
 }
+
+func max(x, y int) int {
+	if x < y {
+		return y
+	} else {
+		return x
+	}
+}
+
+func sign(x int) int {
+	if x < 0 {
+		return -1
+	} else if x > 0 {
+		return 1
+	} else {
+		return 0
+	}
+}
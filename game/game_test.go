@@ -98,7 +98,7 @@ func TestMove(t *testing.T) {
 	err = game.Move(Player2, p2T1)
 	if err == nil {
 		//Expect error
-		t.Error("Expected Error on repeated move %v", p2T1)
+		t.Errorf("Expected Error on repeated move %v", p2T1)
 	}
 	p2T2 := Coord{X: 9, Y: 9}
 	err = game.Move(Player2, p2T2)
@@ -166,3 +166,43 @@ func TestGameWon(t *testing.T) {
 	}
 
 }
+
+func TestMoveHistory(t *testing.T) {
+	game := NewGame(10, 10)
+	piece := Piece{Type: PatrolBoat, Start: Coord{0, 1}, End: Coord{0, 0}}
+	for _, player := range []Player{Player1, Player2} {
+		err := game.SetPiece(player, piece.Start, piece.End, piece.Type)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	moves := []Shot{
+		{Player: Player1, Coord: Coord{X: 0, Y: 0}, Result: Hit},
+		{Player: Player2, Coord: Coord{X: 5, Y: 5}, Result: Miss},
+		{Player: Player1, Coord: Coord{X: 0, Y: 1}, Result: Sunk},
+	}
+	for _, move := range moves {
+		err := game.Move(move.Player, move.Coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := game.Move(Player2, Coord{X: 5, Y: 5})
+	if err == nil {
+		t.Error("Expected Error on repeated move")
+	}
+	if len(game.History) != len(moves) {
+		t.Fatalf("History should have %d shots instead it has %d", len(moves), len(game.History))
+	}
+	for i := range moves {
+		if game.History[i] != moves[i] {
+			t.Errorf("Shot %d should be %v instead it is %v", i, moves[i], game.History[i])
+		}
+	}
+	if sunk, ok := game.PieceAt(Player2, Coord{X: 0, Y: 1}); !ok || !game.IsSunk(Player2, sunk) {
+		t.Error("Player2's patrol boat should be sunk")
+	}
+	if _, ok := game.PieceAt(Player2, Coord{X: 1, Y: 1}); ok {
+		t.Error("There should be no piece at B2")
+	}
+}
@@ -0,0 +1,72 @@
+// Package gametest builds the games used by the tests of the game packages.
+// Every game is played between jonfk and gery, who place the same pieces.
+package gametest
+
+import (
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+)
+
+// Names of the players of the games built
+const (
+	Player1 = "jonfk"
+	Player2 = "gery"
+)
+
+// Fleet returns the standard fleet placed in the first three columns:
+// PatrolBoat A1-A2, Destroyer A3-A5, Submarine A6-A8, Battleship B1-B4 and
+// AircraftCarrier C1-C5.
+func Fleet() []game.Piece {
+	return []game.Piece{
+		{Type: game.PatrolBoat, Start: game.Coord{X: 0, Y: 0}, End: game.Coord{X: 0, Y: 1}},
+		{Type: game.Destroyer, Start: game.Coord{X: 0, Y: 2}, End: game.Coord{X: 0, Y: 4}},
+		{Type: game.Submarine, Start: game.Coord{X: 0, Y: 5}, End: game.Coord{X: 0, Y: 7}},
+		{Type: game.Battleship, Start: game.Coord{X: 1, Y: 0}, End: game.Coord{X: 1, Y: 3}},
+		{Type: game.AircraftCarrier, Start: game.Coord{X: 2, Y: 0}, End: game.Coord{X: 2, Y: 4}},
+	}
+}
+
+// FleetInColumns returns the standard fleet standing in every step-th column
+// from A, every piece starting on the first row
+func FleetInColumns(step int) []game.Piece {
+	var pieces []game.Piece
+	for i, piece := range game.StandardFleet() {
+		x := i * step
+		pieces = append(pieces, game.Piece{Type: piece, Start: game.Coord{X: x, Y: 0}, End: game.Coord{X: x, Y: piece.Length() - 1}})
+	}
+	return pieces
+}
+
+// New returns a game of the given size where both players placed pieces
+func New(t testing.TB, x, y int, pieces []game.Piece) *game.Game {
+	g := game.NewGame(x, y)
+	g.SetPlayer(game.Player1, Player1)
+	g.SetPlayer(game.Player2, Player2)
+	for _, player := range []game.Player{game.Player1, game.Player2} {
+		for _, piece := range pieces {
+			if err := g.SetPiece(player, piece.Start, piece.End, piece.Type); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return g
+}
+
+// NewStandard returns a 10x10 game where both players placed Fleet
+func NewStandard(t testing.TB) *game.Game {
+	return New(t, 10, 10, Fleet())
+}
+
+// Play fires at every cell, written in notation such as "B3", in turn
+func Play(t testing.TB, g *game.Game, cells ...string) {
+	for _, cell := range cells {
+		coord, err := g.ParseCoord(cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Move(g.CurrentTurn, coord); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
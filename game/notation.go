@@ -0,0 +1,144 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Standard coordinate notation: columns are letters (A, B, ..., Z, AA, AB, ...)
+ * and rows are numbers starting at 1. Coord{X: 1, Y: 6} is "B7".
+ */
+
+// Notation returns the coordinate in standard notation, e.g. "B7". Negative
+// coordinates cannot be written in standard notation and use String instead.
+func (coord Coord) Notation() string {
+	if coord.X < 0 || coord.Y < 0 {
+		return coord.String()
+	}
+	return ColumnName(coord.X) + strconv.Itoa(coord.Y+1)
+}
+
+// ColumnName returns the letters naming column x: A to Z then AA, AB and so on.
+func ColumnName(x int) string {
+	if x < 0 {
+		return ""
+	}
+	var name []byte
+	for x >= 0 {
+		name = append([]byte{byte('A' + x%26)}, name...)
+		x = x/26 - 1
+	}
+	return string(name)
+}
+
+// ParseCoord parses a coordinate in standard notation such as "B7" or "aa10".
+// It does not check that the coordinate is on any particular board, see
+// Game.ParseCoord for that.
+func ParseCoord(s string) (Coord, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	i := 0
+	x := 0
+	for i < len(s) && s[i] >= 'A' && s[i] <= 'Z' {
+		x = x*26 + int(s[i]-'A') + 1
+		i++
+		if x > 1<<20 {
+			return Coord{}, fmt.Errorf("ParseCoord: column in %q is too large", s)
+		}
+	}
+	if i == 0 {
+		return Coord{}, fmt.Errorf("ParseCoord: %q does not start with a column letter", s)
+	}
+	if i == len(s) {
+		return Coord{}, fmt.Errorf("ParseCoord: %q is missing a row number", s)
+	}
+	y, err := strconv.Atoi(s[i:])
+	if err != nil || s[i] == '+' || s[i] == '-' {
+		return Coord{}, fmt.Errorf("ParseCoord: invalid row number in %q", s)
+	}
+	if y < 1 {
+		return Coord{}, fmt.Errorf("ParseCoord: row number in %q should start at 1", s)
+	}
+	return Coord{X: x - 1, Y: y - 1}, nil
+}
+
+// ParseCoord parses a coordinate in standard notation and checks that it is on
+// the game's board.
+func (game *Game) ParseCoord(s string) (Coord, error) {
+	coord, err := ParseCoord(s)
+	if err != nil {
+		return coord, err
+	}
+	if !game.IsValidCoord(coord) {
+		return coord, newError(ErrInvalidCoord, "ParseCoord: %v is outside of the %dx%d board", coord.Notation(), game.Size.X, game.Size.Y)
+	}
+	return coord, nil
+}
+
+// ParsePlacement parses the start and end of a piece placement. Placements can
+// be written either as two coordinates, "A1-A5" or "A1 A5", or as a start
+// coordinate and a direction, "A1 down" or "A1 right" ("across" is accepted
+// as an alias of right). The piece is used to compute the end coordinate when
+// a direction is given.
+func ParsePlacement(s string, piece PieceType) (start, end Coord, err error) {
+	fields := strings.Fields(strings.Replace(s, "-", " ", 1))
+	if len(fields) != 2 {
+		return start, end, fmt.Errorf("ParsePlacement: %q should be a start and an end or a direction", s)
+	}
+	start, err = ParseCoord(fields[0])
+	if err != nil {
+		return start, end, err
+	}
+	switch strings.ToLower(fields[1]) {
+	case "down":
+		if piece.Length() < 0 {
+			return start, end, fmt.Errorf("ParsePlacement: piece %v is invalid", piece)
+		}
+		end = Coord{X: start.X, Y: start.Y + piece.Length() - 1}
+	case "right", "across":
+		if piece.Length() < 0 {
+			return start, end, fmt.Errorf("ParsePlacement: piece %v is invalid", piece)
+		}
+		end = Coord{X: start.X + piece.Length() - 1, Y: start.Y}
+	default:
+		end, err = ParseCoord(fields[1])
+		if err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+// ParsePlacement parses a piece placement in standard notation and checks that
+// both ends are on the game's board.
+func (game *Game) ParsePlacement(s string, piece PieceType) (start, end Coord, err error) {
+	start, end, err = ParsePlacement(s, piece)
+	if err != nil {
+		return start, end, err
+	}
+	for _, coord := range []Coord{start, end} {
+		if !game.IsValidCoord(coord) {
+			return start, end, newError(ErrInvalidCoord, "ParsePlacement: %v is outside of the %dx%d board", coord.Notation(), game.Size.X, game.Size.Y)
+		}
+	}
+	return start, end, nil
+}
+
+// Notation returns the placement of the piece in standard notation, e.g.
+// "A1-A5".
+func (piece Piece) Notation() string {
+	return piece.Start.Notation() + "-" + piece.End.Notation()
+}
+
+// ParsePieceType parses the name of a piece type such as "PatrolBoat". Names
+// are case insensitive.
+func ParsePieceType(s string) (PieceType, error) {
+	s = strings.TrimSpace(s)
+	for piece := PatrolBoat; piece <= AircraftCarrier; piece++ {
+		if strings.EqualFold(s, piece.String()) {
+			return piece, nil
+		}
+	}
+	return -1, fmt.Errorf("ParsePieceType: unknown piece %q", s)
+}
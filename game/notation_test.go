@@ -0,0 +1,110 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestCoordNotation(t *testing.T) {
+	tests := []struct {
+		coord    Coord
+		notation string
+	}{
+		{Coord{X: 0, Y: 0}, "A1"},
+		{Coord{X: 1, Y: 6}, "B7"},
+		{Coord{X: 9, Y: 9}, "J10"},
+		{Coord{X: 25, Y: 0}, "Z1"},
+		{Coord{X: 26, Y: 0}, "AA1"},
+		{Coord{X: 27, Y: 41}, "AB42"},
+		{Coord{X: 51, Y: 0}, "AZ1"},
+		{Coord{X: 52, Y: 0}, "BA1"},
+		{Coord{X: 701, Y: 0}, "ZZ1"},
+		{Coord{X: 702, Y: 0}, "AAA1"},
+	}
+	for _, test := range tests {
+		if n := test.coord.Notation(); n != test.notation {
+			t.Errorf("Notation of %v should be %q instead it is %q", test.coord, test.notation, n)
+		}
+		coord, err := ParseCoord(test.notation)
+		if err != nil {
+			t.Error(err)
+		}
+		if coord != test.coord {
+			t.Errorf("ParseCoord(%q) should be %v instead it is %v", test.notation, test.coord, coord)
+		}
+	}
+
+	coord, err := ParseCoord(" j10\n")
+	if err != nil || coord != (Coord{X: 9, Y: 9}) {
+		t.Errorf("ParseCoord should accept lower case and spaces, got %v and %v", coord, err)
+	}
+	if n := (Coord{X: -1, Y: 2}).Notation(); n != (Coord{X: -1, Y: 2}).String() {
+		t.Errorf("Negative coordinates should fall back to String, got %q", n)
+	}
+}
+
+func TestParseCoordInvalid(t *testing.T) {
+	for _, s := range []string{"", "7", "B", "B0", "B-1", "B+1", "1B", "B7C", "B 7", "?1", "AAAAAAAAAAAAAAAAAAAAAAAA1"} {
+		coord, err := ParseCoord(s)
+		if err == nil {
+			t.Errorf("ParseCoord(%q) should fail instead it is %v", s, coord)
+		}
+	}
+
+	game := NewGame(10, 10)
+	if _, err := game.ParseCoord("J10"); err != nil {
+		t.Error(err)
+	}
+	for _, s := range []string{"K1", "A11", "AA1"} {
+		if _, err := game.ParseCoord(s); err == nil {
+			t.Errorf("ParseCoord(%q) should be outside of a 10x10 board", s)
+		}
+	}
+}
+
+func TestParsePlacement(t *testing.T) {
+	tests := []struct {
+		s     string
+		piece PieceType
+		start Coord
+		end   Coord
+	}{
+		{"A1-A5", AircraftCarrier, Coord{0, 0}, Coord{0, 4}},
+		{"a1 - a5", AircraftCarrier, Coord{0, 0}, Coord{0, 4}},
+		{"A1 A5", AircraftCarrier, Coord{0, 0}, Coord{0, 4}},
+		{"A1 down", AircraftCarrier, Coord{0, 0}, Coord{0, 4}},
+		{"C3 right", PatrolBoat, Coord{2, 2}, Coord{3, 2}},
+		{"C3 ACROSS", Destroyer, Coord{2, 2}, Coord{4, 2}},
+	}
+	for _, test := range tests {
+		start, end, err := ParsePlacement(test.s, test.piece)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if start != test.start || end != test.end {
+			t.Errorf("ParsePlacement(%q) should be %v-%v instead it is %v-%v", test.s, test.start, test.end, start, end)
+		}
+	}
+
+	for _, s := range []string{"", "A1", "A1-", "A1 up", "A1-A2-A3", "A1 B2 C3"} {
+		if _, _, err := ParsePlacement(s, PatrolBoat); err == nil {
+			t.Errorf("ParsePlacement(%q) should fail", s)
+		}
+	}
+
+	game := NewGame(10, 10)
+	if _, _, err := game.ParsePlacement("J7 down", AircraftCarrier); err == nil {
+		t.Error("J7 down should run off a 10x10 board for an aircraft carrier")
+	}
+	start, end, err := game.ParsePlacement("J6 down", AircraftCarrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = game.SetPiece(Player1, start, end, AircraftCarrier)
+	if err != nil {
+		t.Error(err)
+	}
+	if n := game.Player1Ships[0].Notation(); n != "J6-J10" {
+		t.Errorf("Placement notation should be J6-J10 instead it is %q", n)
+	}
+}
@@ -0,0 +1,95 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// maxFleetAttempts bounds how many times RandomFleet starts over when a piece
+// cannot be placed anymore
+const maxFleetAttempts = 100
+
+// RandomFleet places every piece of the fleet at a random position on a board
+// of the given size. Every valid position of a piece is equally likely given
+// the pieces placed before it.
+func RandomFleet(rng *rand.Rand, size Coord, fleet []PieceType) ([]Piece, error) {
+	return randomFleet(rng, size, fleet, func([]Piece, Piece) bool { return true })
+}
+
+// PlaceRandomFleet places the player's whole fleet at random within the area
+// allowed by the rules
+func (game *Game) PlaceRandomFleet(player Player, rng *rand.Rand) error {
+	pieces, err := RandomFleet(rng, game.Rules.AreaOf(player), game.Rules.FleetOf(player))
+	if err != nil {
+		return err
+	}
+	for _, piece := range pieces {
+		err := game.SetPiece(player, piece.Start, piece.End, piece.Type)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RandomFleetFunc is like RandomFleet but only places a piece where accept
+// returns true given the pieces already placed. It can be used to forbid
+// pieces from touching each other.
+func RandomFleetFunc(rng *rand.Rand, size Coord, fleet []PieceType, accept func(placed []Piece, piece Piece) bool) ([]Piece, error) {
+	return randomFleet(rng, size, fleet, accept)
+}
+
+func randomFleet(rng *rand.Rand, size Coord, fleet []PieceType, accept func([]Piece, Piece) bool) ([]Piece, error) {
+	for attempt := 0; attempt < maxFleetAttempts; attempt++ {
+		var placed []Piece
+		for _, pieceType := range fleet {
+			candidates := Placements(size, pieceType)
+			valid := candidates[:0]
+			for _, candidate := range candidates {
+				if !overlaps(placed, candidate) && accept(placed, candidate) {
+					valid = append(valid, candidate)
+				}
+			}
+			if len(valid) == 0 {
+				break
+			}
+			placed = append(placed, valid[rng.Intn(len(valid))])
+		}
+		if len(placed) == len(fleet) {
+			return placed, nil
+		}
+	}
+	return nil, fmt.Errorf("RandomFleet: cannot place fleet %v on a %dx%d board", fleet, size.X, size.Y)
+}
+
+// Placements returns every position of a piece on a board of the given size,
+// horizontal positions first
+func Placements(size Coord, pieceType PieceType) []Piece {
+	length := pieceType.Length()
+	if length < 0 {
+		return nil
+	}
+	var pieces []Piece
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x+length-1 < size.X; x++ {
+			pieces = append(pieces, Piece{Type: pieceType, Start: Coord{X: x, Y: y}, End: Coord{X: x + length - 1, Y: y}})
+		}
+	}
+	for x := 0; x < size.X; x++ {
+		for y := 0; y+length-1 < size.Y; y++ {
+			pieces = append(pieces, Piece{Type: pieceType, Start: Coord{X: x, Y: y}, End: Coord{X: x, Y: y + length - 1}})
+		}
+	}
+	return pieces
+}
+
+func overlaps(placed []Piece, piece Piece) bool {
+	for _, other := range placed {
+		for _, coord := range piece.Coords() {
+			if other.Covers(coord) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRandomFleet(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		game := NewGame(10, 10)
+		game.SetPlayer(Player1, "jonfk")
+		game.SetPlayer(Player2, "gery")
+		for _, player := range []Player{Player1, Player2} {
+			if err := game.PlaceRandomFleet(player, rng); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !game.IsReadyToStart() {
+			t.Fatalf("Random fleets should be ready to start:\n%v", game)
+		}
+	}
+
+	_, err := RandomFleet(rng, Coord{X: 3, Y: 3}, StandardFleet())
+	if err == nil {
+		t.Error("The standard fleet should not fit on a 3x3 board")
+	}
+}
+
+func TestRandomFleetArea(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	rules := StandardRules()
+	rules.Handicaps[Player2].Area = Coord{X: 6, Y: 5}
+	game, err := NewGameWithRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := game.PlaceRandomFleet(Player2, rng); err != nil {
+		t.Fatal(err)
+	}
+	for _, piece := range game.Player2Ships {
+		for _, coord := range piece.Coords() {
+			if coord.X >= 6 || coord.Y >= 5 {
+				t.Errorf("%v %v is outside of the handicap area", piece.Type, piece.Notation())
+			}
+		}
+	}
+}
+
+func TestPlacements(t *testing.T) {
+	if n := len(Placements(Coord{X: 10, Y: 10}, AircraftCarrier)); n != 120 {
+		t.Errorf("An aircraft carrier should have 120 positions on a 10x10 board instead of %d", n)
+	}
+	if n := len(Placements(Coord{X: 3, Y: 1}, Destroyer)); n != 1 {
+		t.Errorf("A destroyer should have 1 position on a 3x1 board instead of %d", n)
+	}
+}
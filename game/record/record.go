@@ -0,0 +1,491 @@
+// Package record reads and writes battleship game records. The format is a
+// plain text format inspired by chess PGN made of three sections separated by
+// blank lines: the headers, the placement of every piece and the numbered list
+// of shots with their results. Free reveals are listed among the shots with
+// the letter R instead of a number.
+//
+//	[Player1 "jonfk"]
+//	[Player2 "gery"]
+//	[Date "2016.01.02"]
+//	[Rules "10x10"]
+//	[Result "0-1"]
+//	[Termination "FleetSunk"]
+//
+//	P1 PatrolBoat A1-A2
+//	P2 PatrolBoat J9-J10
+//
+//	1. P1 E5 miss
+//	2. P2 A1 hit
+//	R P1 J9 ship
+//	3. P1 J9 hit
+//	4. P2 A2 sunk
+//
+// The Rules header holds the board size, fleet and handicaps written by
+// game.Rules.String. The Termination header records why a finished game
+// ended, see game.EndReason. Lines starting with ';' are comments and are
+// ignored. Headers other than the standard ones are kept in Record.Tags.
+package record
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jonfk/battleship/game"
+)
+
+// Values of the Result header
+const (
+	Player1Won = "1-0"
+	Player2Won = "0-1"
+	Draw       = "1/2-1/2"
+	Unfinished = "*"
+)
+
+// UnknownDate is written when a record has no date, it is read back as an
+// empty Date
+const UnknownDate = "????.??.??"
+
+type Record struct {
+	Player1 string
+	Player2 string
+	Date    string
+	Rules   game.Rules
+	Result  string
+	// Termination is only meaningful when Result is not Unfinished
+	Termination game.EndReason
+	Tags        map[string]string
+	Placements  []Placement
+	Shots       []game.Shot
+	Reveals     []game.FreeReveal
+}
+
+// Placement is a piece placed by a player before the first shot
+type Placement struct {
+	Player game.Player
+	Piece  game.Piece
+}
+
+// FromGame creates a record of the game's placements and history. The date is
+// left unset.
+func FromGame(g *game.Game) *Record {
+	record := &Record{Rules: g.Rules.Clone(), Result: resultOf(g)}
+	if result, over := g.Result(); over {
+		record.Termination = result.Reason
+	}
+	if g.Player1 != nil {
+		record.Player1 = *g.Player1
+	}
+	if g.Player2 != nil {
+		record.Player2 = *g.Player2
+	}
+	for _, piece := range g.Player1Ships {
+		record.Placements = append(record.Placements, Placement{Player: game.Player1, Piece: piece})
+	}
+	for _, piece := range g.Player2Ships {
+		record.Placements = append(record.Placements, Placement{Player: game.Player2, Piece: piece})
+	}
+	record.Shots = append(record.Shots, g.History...)
+	record.Reveals = append(record.Reveals, g.Reveals...)
+	return record
+}
+
+// Replay plays the record into a new game, checking that every placement and
+// shot is legal, that the recorded shot results match and that the Result and
+// Termination headers agree with the final position.
+func (record *Record) Replay() (*game.Game, error) {
+	g, err := game.NewGameWithRules(record.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("Replay: %v", err)
+	}
+	g.SetPlayer(game.Player1, record.Player1)
+	g.SetPlayer(game.Player2, record.Player2)
+
+	for i, placement := range record.Placements {
+		piece := placement.Piece
+		err := g.SetPiece(placement.Player, piece.Start, piece.End, piece.Type)
+		if err != nil {
+			return nil, fmt.Errorf("Replay: placement %d: %v", i+1, err)
+		}
+	}
+	if len(record.Shots)+len(record.Reveals) > 0 && !g.IsReadyToStart() {
+		return nil, fmt.Errorf("Replay: shots fired before both fleets were placed")
+	}
+
+	reveals := record.Reveals
+	reveal := func(shots int) error {
+		for len(reveals) > 0 && reveals[0].Shots <= shots {
+			r := reveals[0]
+			reveals = reveals[1:]
+			if r.Shots < shots {
+				return fmt.Errorf("Replay: reveal at %v is out of order", r.Coord.Notation())
+			}
+			ship, err := g.Reveal(r.Player, r.Coord)
+			if err != nil {
+				return fmt.Errorf("Replay: reveal after shot %d: %v", shots, err)
+			}
+			if ship != r.Ship {
+				return fmt.Errorf("Replay: reveal at %v found %s but is recorded as %s",
+					r.Coord.Notation(), revealToken(ship), revealToken(r.Ship))
+			}
+		}
+		return nil
+	}
+	for i, shot := range record.Shots {
+		if err := reveal(i); err != nil {
+			return nil, err
+		}
+		if resultOf(g) != Unfinished {
+			return nil, fmt.Errorf("Replay: shot %d fired after the game was over", i+1)
+		}
+		err := g.Move(shot.Player, shot.Coord)
+		if err != nil {
+			return nil, fmt.Errorf("Replay: shot %d: %v", i+1, err)
+		}
+		if played := g.History[len(g.History)-1]; played.Result != shot.Result {
+			return nil, fmt.Errorf("Replay: shot %d at %v was a %v but is recorded as a %v",
+				i+1, shot.Coord.Notation(), played.Result, shot.Result)
+		}
+	}
+	if err := reveal(len(record.Shots)); err != nil {
+		return nil, err
+	}
+	if len(reveals) > 0 {
+		return nil, fmt.Errorf("Replay: reveal at %v after shot %d which was not fired", reveals[0].Coord.Notation(), reveals[0].Shots)
+	}
+
+	if record.Result != Unfinished && record.Termination != game.FleetSunk {
+		err := endGame(g, record.Result, record.Termination)
+		if err != nil {
+			return nil, fmt.Errorf("Replay: cannot end the game with %q by %v: %v", record.Result, record.Termination, err)
+		}
+	}
+
+	result := resultOf(g)
+	if record.Result != result {
+		return nil, fmt.Errorf("Replay: recorded result %q does not match final position %q", record.Result, result)
+	}
+	if over, _ := g.Result(); result != Unfinished && over.Reason != record.Termination {
+		return nil, fmt.Errorf("Replay: recorded termination %v does not match final position %v", record.Termination, over.Reason)
+	}
+	return g, nil
+}
+
+// endGame ends the game for a reason other than a sunk fleet
+func endGame(g *game.Game, result string, reason game.EndReason) error {
+	switch {
+	case reason == game.DrawAgreement:
+		err := g.OfferDraw(g.CurrentTurn)
+		if err != nil {
+			return err
+		}
+		return g.AcceptDraw(g.CurrentTurn.Opponent())
+	case result == Player1Won:
+		return g.Forfeit(game.Player2, reason)
+	case result == Player2Won:
+		return g.Forfeit(game.Player1, reason)
+	default:
+		return fmt.Errorf("%q is not a win", result)
+	}
+}
+
+// Validate checks that the record is legal by replaying it
+func (record *Record) Validate() error {
+	_, err := record.Replay()
+	return err
+}
+
+func resultOf(g *game.Game) string {
+	result, over := g.Result()
+	switch {
+	case !over:
+		return Unfinished
+	case result.IsDraw():
+		return Draw
+	case result.Winner == game.Player1:
+		return Player1Won
+	default:
+		return Player2Won
+	}
+}
+
+/*
+ * Writer
+ */
+
+// Encode writes the record in the text format
+func Encode(w io.Writer, record *Record) error {
+	bw := bufio.NewWriter(w)
+
+	date := record.Date
+	if date == "" {
+		date = UnknownDate
+	}
+	result := record.Result
+	if result == "" {
+		result = Unfinished
+	}
+	writeHeader(bw, "Player1", record.Player1)
+	writeHeader(bw, "Player2", record.Player2)
+	writeHeader(bw, "Date", date)
+	writeHeader(bw, "Rules", record.Rules.String())
+	writeHeader(bw, "Result", result)
+	if result != Unfinished {
+		writeHeader(bw, "Termination", record.Termination.String())
+	}
+	var names []string
+	for name := range record.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(bw, name, record.Tags[name])
+	}
+
+	if len(record.Placements) > 0 {
+		bw.WriteString("\n")
+	}
+	for _, placement := range record.Placements {
+		fmt.Fprintf(bw, "%s %v %s\n", playerToken(placement.Player), placement.Piece.Type, placement.Piece.Notation())
+	}
+
+	if len(record.Shots)+len(record.Reveals) > 0 {
+		bw.WriteString("\n")
+	}
+	// Reveals are written before the shot fired after them
+	reveals := record.Reveals
+	for i := 0; i <= len(record.Shots); i++ {
+		for len(reveals) > 0 && (reveals[0].Shots <= i || i == len(record.Shots)) {
+			r := reveals[0]
+			reveals = reveals[1:]
+			fmt.Fprintf(bw, "R %s %s %s\n", playerToken(r.Player), r.Coord.Notation(), revealToken(r.Ship))
+		}
+		if i < len(record.Shots) {
+			shot := record.Shots[i]
+			fmt.Fprintf(bw, "%d. %s %s %s\n", i+1, playerToken(shot.Player), shot.Coord.Notation(), strings.ToLower(shot.Result.String()))
+		}
+	}
+	return bw.Flush()
+}
+
+func writeHeader(w *bufio.Writer, name, value string) {
+	fmt.Fprintf(w, "[%s %s]\n", name, strconv.Quote(value))
+}
+
+func playerToken(player game.Player) string {
+	return fmt.Sprintf("P%d", int(player)+1)
+}
+
+// revealToken is the result of a reveal, whether a ship was found
+func revealToken(ship bool) string {
+	if ship {
+		return "ship"
+	}
+	return "empty"
+}
+
+/*
+ * Reader
+ */
+
+const (
+	headerSection = iota
+	placementSection
+	shotSection
+)
+
+// Decode reads a record in the text format. It only checks the syntax of the
+// record, use Validate to check that the game it describes is legal.
+func Decode(r io.Reader) (*Record, error) {
+	record := &Record{Result: Unfinished}
+	var (
+		section   = headerSection
+		hasRules  bool
+		lineNum   int
+		scanner   = bufio.NewScanner(r)
+		syntaxErr = func(format string, args ...interface{}) error {
+			return fmt.Errorf("Decode: line %d: %s", lineNum, fmt.Sprintf(format, args...))
+		}
+	)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "["):
+			if section != headerSection {
+				return nil, syntaxErr("header after the header section")
+			}
+			name, value, err := parseHeader(line)
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			switch name {
+			case "Player1":
+				record.Player1 = value
+			case "Player2":
+				record.Player2 = value
+			case "Date":
+				if value != UnknownDate {
+					record.Date = value
+				}
+			case "Result":
+				switch value {
+				case Player1Won, Player2Won, Draw, Unfinished:
+					record.Result = value
+				default:
+					return nil, syntaxErr("invalid result %q", value)
+				}
+			case "Termination":
+				reason, err := parseEndReason(value)
+				if err != nil {
+					return nil, syntaxErr("%v", err)
+				}
+				record.Termination = reason
+			case "Rules":
+				rules, err := game.ParseRules(value)
+				if err != nil {
+					return nil, syntaxErr("%v", err)
+				}
+				record.Rules = rules
+				hasRules = true
+			default:
+				if record.Tags == nil {
+					record.Tags = make(map[string]string)
+				}
+				record.Tags[name] = value
+			}
+
+		case strings.HasPrefix(line, "P"):
+			if section > placementSection {
+				return nil, syntaxErr("placement after the first shot")
+			}
+			section = placementSection
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				return nil, syntaxErr("placement should be a player, a piece and a position")
+			}
+			player, err := parsePlayer(fields[0])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			pieceType, err := game.ParsePieceType(fields[1])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			start, end, err := game.ParsePlacement(fields[2], pieceType)
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			record.Placements = append(record.Placements, Placement{
+				Player: player,
+				Piece:  game.Piece{Type: pieceType, Start: start, End: end},
+			})
+
+		case strings.HasPrefix(line, "R "):
+			section = shotSection
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				return nil, syntaxErr("reveal should be R, a player, a coordinate and a result")
+			}
+			player, err := parsePlayer(fields[1])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			coord, err := game.ParseCoord(fields[2])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			var ship bool
+			switch fields[3] {
+			case revealToken(true):
+				ship = true
+			case revealToken(false):
+			default:
+				return nil, syntaxErr("invalid reveal result %q", fields[3])
+			}
+			record.Reveals = append(record.Reveals, game.FreeReveal{Player: player, Coord: coord, Ship: ship, Shots: len(record.Shots)})
+
+		default:
+			section = shotSection
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				return nil, syntaxErr("shot should be a number, a player, a coordinate and a result")
+			}
+			if fields[0] != strconv.Itoa(len(record.Shots)+1)+"." {
+				return nil, syntaxErr("expected shot number %d. instead of %q", len(record.Shots)+1, fields[0])
+			}
+			player, err := parsePlayer(fields[1])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			coord, err := game.ParseCoord(fields[2])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			result, err := parseShotResult(fields[3])
+			if err != nil {
+				return nil, syntaxErr("%v", err)
+			}
+			record.Shots = append(record.Shots, game.Shot{Player: player, Coord: coord, Result: result})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasRules {
+		return nil, fmt.Errorf("Decode: missing Rules header")
+	}
+	return record, nil
+}
+
+func parseHeader(line string) (string, string, error) {
+	if !strings.HasSuffix(line, "]") {
+		return "", "", fmt.Errorf("header %q is not closed", line)
+	}
+	inner := strings.TrimSpace(line[1 : len(line)-1])
+	i := strings.IndexAny(inner, " \t")
+	if i <= 0 {
+		return "", "", fmt.Errorf("header %q should be a name and a quoted value", line)
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(inner[i:]))
+	if err != nil {
+		return "", "", fmt.Errorf("header %q has an invalid value", line)
+	}
+	return inner[:i], value, nil
+}
+
+func parsePlayer(s string) (game.Player, error) {
+	switch s {
+	case "P1":
+		return game.Player1, nil
+	case "P2":
+		return game.Player2, nil
+	default:
+		return 0, fmt.Errorf("invalid player %q", s)
+	}
+}
+
+func parseEndReason(s string) (game.EndReason, error) {
+	for reason := game.FleetSunk; reason <= game.Disconnect; reason++ {
+		if s == reason.String() {
+			return reason, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid termination %q", s)
+}
+
+func parseShotResult(s string) (game.ShotResult, error) {
+	for _, result := range []game.ShotResult{game.Miss, game.Hit, game.Sunk} {
+		if strings.EqualFold(s, result.String()) {
+			return result, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid shot result %q", s)
+}
@@ -0,0 +1,321 @@
+package record
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+	"github.com/jonfk/battleship/game/render"
+)
+
+const testRecord = `[Player1 "jonfk"]
+[Player2 "gery \"the great\""]
+[Date "2016.01.02"]
+[Rules "10x10"]
+[Result "1-0"]
+[Termination "FleetSunk"]
+[Event "Test"]
+
+P1 PatrolBoat A1-A2
+P1 Destroyer A3-A5
+P1 Submarine A6-A8
+P1 Battleship B1-B4
+P1 AircraftCarrier C1-C5
+P2 PatrolBoat J9-J10
+P2 Destroyer G10-I10
+P2 Submarine E5-G5
+P2 Battleship D1-D4
+P2 AircraftCarrier F1-J1
+
+`
+
+func newFinishedGame(t *testing.T) *game.Game {
+	g := gametest.NewStandard(t)
+	// Player1 sinks every ship while Player2 only fires at empty columns
+	p2Moves := 0
+	for _, piece := range g.Player2Ships {
+		for _, coord := range piece.Coords() {
+			if err := g.Move(game.Player1, coord); err != nil {
+				t.Fatal(err)
+			}
+			if g.HasPlayerWon(game.Player1) {
+				return g
+			}
+			if err := g.Move(game.Player2, game.Coord{X: 3 + p2Moves%7, Y: p2Moves / 7}); err != nil {
+				t.Fatal(err)
+			}
+			p2Moves++
+		}
+	}
+	t.Fatal("Player1 should have won")
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	g := newFinishedGame(t)
+	record := FromGame(g)
+	record.Date = "2016.01.02"
+	record.Tags = map[string]string{"Event": "Test"}
+
+	buf := new(bytes.Buffer)
+	err := Encode(buf, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := strings.Replace(testRecord[:strings.Index(testRecord, "P2 PatrolBoat")], `gery \"the great\"`, "gery", 1)
+	if !strings.HasPrefix(buf.String(), headers) {
+		t.Errorf("Encoded record should start with the test record headers and placements:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "\n1. P1 A1 hit\n2. P2 D1 miss\n3. P1 A2 sunk\n") {
+		t.Errorf("Encoded record should contain the first shots:\n%s", buf.String())
+	}
+
+	decoded, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Result != Player1Won || decoded.Date != "2016.01.02" || decoded.Tags["Event"] != "Test" {
+		t.Errorf("Decoded headers do not match: %#v", decoded)
+	}
+	if len(decoded.Shots) != len(g.History) {
+		t.Fatalf("Decoded record should have %d shots instead it has %d", len(g.History), len(decoded.Shots))
+	}
+	replayed, err := decoded.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayed.Equal(g) {
+		opts := render.Options{ASCII: true}
+		t.Errorf("Replayed game should be equal to the original\nreplayed:\n%s\noriginal:\n%s",
+			render.Boards(replayed, game.Player1, opts), render.Boards(g, game.Player1, opts))
+	}
+}
+
+func TestFromGameRoundTrip(t *testing.T) {
+	record := FromGame(newFinishedGame(t))
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, record); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `[Date "`+UnknownDate+`"]`) {
+		t.Errorf("Encoded record should have an unknown date:\n%s", buf.String())
+	}
+	decoded, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("Decoded record should be the same as the original\ndecoded: %#v\noriginal: %#v", decoded, record)
+	}
+}
+
+func TestDecodeComments(t *testing.T) {
+	record, err := Decode(strings.NewReader("; a famous game\n[Rules \"8x12\"]\n\n; nothing happened\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Rules.Size != (game.Coord{X: 8, Y: 12}) || record.Result != Unfinished || record.Date != "" {
+		t.Errorf("Unexpected record %#v", record)
+	}
+	if err := record.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	records := []string{
+		``,
+		`[Player1 "jonfk"]`,
+		`[Rules "ten by ten"]`,
+		"[Rules \"10x10\"]\n[Result \"2-0\"]",
+		"[Rules \"10x10\"]\n[Player1 jonfk]",
+		"[Rules \"10x10\"]\n[Player1 \"jonfk\"",
+		"[Rules \"10x10\"]\nP3 PatrolBoat A1-A2",
+		"[Rules \"10x10\"]\nP1 Rowboat A1-A2",
+		"[Rules \"10x10\"]\nP1 PatrolBoat A1",
+		"[Rules \"10x10\"]\n1. P1 A1 hit\nP1 PatrolBoat A1-A2",
+		"[Rules \"10x10\"]\nP1 PatrolBoat A1-A2\n[Result \"*\"]",
+		"[Rules \"10x10\"]\n2. P1 A1 hit",
+		"[Rules \"10x10\"]\n1. P1 A1 splash",
+		"[Rules \"10x10\"]\n1. P1 A0 hit",
+		"[Rules \"10x10\"]\n1 P1 A1 hit",
+		"[Rules \"10x10\"]\n[Termination \"Boredom\"]",
+		"[Rules \"10x10\"]\nR P1 A1",
+		"[Rules \"10x10\"]\nR P1 A1 maybe",
+		"[Rules \"10x10\"]\nR P1 A1 ship\nP1 PatrolBoat A1-A2",
+	}
+	for _, s := range records {
+		if record, err := Decode(strings.NewReader(s)); err == nil {
+			t.Errorf("Decode should fail for %q instead it is %#v", s, record)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := FromGame(newFinishedGame(t))
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(record *Record)
+	}{
+		{"no size", func(record *Record) { record.Rules.Size = game.Coord{} }},
+		{"wrong result", func(record *Record) { record.Result = Player2Won }},
+		{"unfinished", func(record *Record) { record.Result = Unfinished }},
+		{"draw", func(record *Record) { record.Result = Draw }},
+		{"resigned after sinking", func(record *Record) { record.Termination = game.Resignation }},
+		{"overlapping placement", func(record *Record) {
+			record.Placements[1].Piece = game.Piece{Type: game.Destroyer, Start: game.Coord{X: 0, Y: 1}, End: game.Coord{X: 0, Y: 3}}
+		}},
+		{"missing fleet", func(record *Record) { record.Placements = record.Placements[:9] }},
+		{"wrong shot result", func(record *Record) { record.Shots[1].Result = game.Hit }},
+		{"out of turn", func(record *Record) { record.Shots[1].Player = game.Player1 }},
+		{"repeated shot", func(record *Record) { record.Shots[2].Coord = record.Shots[0].Coord }},
+		{"shot after end", func(record *Record) {
+			record.Shots = append(record.Shots, game.Shot{Player: game.Player2, Coord: game.Coord{X: 5, Y: 5}})
+		}},
+	}
+	for _, test := range tests {
+		record := FromGame(newFinishedGame(t))
+		test.modify(record)
+		if err := record.Validate(); err == nil {
+			t.Errorf("%s: record should be invalid", test.name)
+		}
+	}
+}
+
+func TestTermination(t *testing.T) {
+	tests := []struct {
+		result string
+		reason game.EndReason
+	}{
+		{Player1Won, game.Resignation},
+		{Player2Won, game.Timeout},
+		{Player1Won, game.Disconnect},
+		{Draw, game.DrawAgreement},
+	}
+	for _, test := range tests {
+		record, err := Decode(strings.NewReader(testRecord))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.Result = test.result
+		record.Termination = test.reason
+		record.Shots = []game.Shot{
+			{Player: game.Player1, Coord: game.Coord{X: 9, Y: 9}, Result: game.Hit},
+			{Player: game.Player2, Coord: game.Coord{X: 9, Y: 9}, Result: game.Miss},
+		}
+		g, err := record.Replay()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, over := g.Result()
+		if !over || result.Reason != test.reason {
+			t.Errorf("Game should be over by %v instead it is %v", test.reason, result)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := Encode(buf, FromGame(g)); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "[Termination \""+test.reason.String()+"\"]") {
+			t.Errorf("Encoded record should have a %v termination:\n%s", test.reason, buf.String())
+		}
+		decoded, err := Decode(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := decoded.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	record, err := Decode(strings.NewReader(testRecord))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Result = Draw
+	record.Termination = game.Resignation
+	if err := record.Validate(); err == nil {
+		t.Error("A resignation cannot be a draw")
+	}
+}
+
+func TestHandicapRecord(t *testing.T) {
+	record, err := Decode(strings.NewReader(strings.Replace(testRecord, `[Rules "10x10"]`, `[Rules "10x10 p2.shots=1 p1.ships=PatrolBoat"]`, 1) +
+		"P1 PatrolBoat J1-J2\n\n1. P1 A1 miss\n2. P2 A1 hit\n3. P2 A2 sunk\n4. P1 J10 hit\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Result = Unfinished
+	g, err := record.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Rules.Handicaps[game.Player2].ExtraShots != 1 || len(g.Player1Ships) != 6 {
+		t.Errorf("Handicaps should be replayed, got %v", g.Rules)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, FromGame(g)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `[Rules "10x10 p1.ships=PatrolBoat p2.shots=1"]`) {
+		t.Errorf("Encoded record should contain the handicaps:\n%s", buf.String())
+	}
+
+	record.Rules.Handicaps[game.Player2].ExtraShots = 0
+	if err := record.Validate(); err == nil {
+		t.Error("Player2 should not be able to fire twice without a handicap")
+	}
+}
+
+func TestRevealRecord(t *testing.T) {
+	record, err := Decode(strings.NewReader(strings.Replace(testRecord, `[Rules "10x10"]`, `[Rules "10x10 p2.reveals=2"]`, 1) +
+		"1. P1 E6 miss\nR P2 A1 ship\nR P2 J10 empty\n2. P2 A1 hit\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Result = Unfinished
+	g, err := record.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.RevealsUsed[game.Player2] != 2 || len(g.History) != 2 {
+		t.Errorf("Reveals should be replayed, got %v", g.Reveals)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, FromGame(g)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\n1. P1 E6 miss\nR P2 A1 ship\nR P2 J10 empty\n2. P2 A1 hit\n") {
+		t.Errorf("Encoded record should contain the reveals between the shots:\n%s", buf.String())
+	}
+	decoded, err := Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := decoded.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayed.Equal(g) {
+		t.Errorf("Replayed game should be equal to the original, reveals %v instead of %v", replayed.Reveals, g.Reveals)
+	}
+
+	record.Reveals[1].Ship = true
+	if err := record.Validate(); err == nil {
+		t.Error("The recorded reveal result should be checked")
+	}
+	record.Reveals[1].Ship = false
+	record.Rules.Handicaps[game.Player2].FreeReveals = 1
+	if err := record.Validate(); err == nil {
+		t.Error("Player2 should not be able to reveal twice with a single free reveal")
+	}
+}
@@ -0,0 +1,221 @@
+// Package render draws game boards as text for terminals, logs and test
+// failures. Boards get column letters and row numbers matching the standard
+// coordinate notation and can be drawn side by side.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/jonfk/battleship/game"
+)
+
+type Options struct {
+	// Color uses ANSI escape codes to color the cells
+	Color bool
+	// ASCII uses plain ASCII glyphs instead of unicode ones
+	ASCII bool
+	// FogOfWar hides the ships of the opponent's board that were not hit
+	FogOfWar bool
+}
+
+type cell int
+
+const (
+	water cell = iota
+	ship
+	hit
+	miss
+	sunk
+)
+
+var (
+	unicodeGlyphs = [...]string{water: "·", ship: "■", hit: "✕", miss: "○", sunk: "▓"}
+	asciiGlyphs   = [...]string{water: ".", ship: "#", hit: "X", miss: "o", sunk: "*"}
+	colors        = [...]string{water: "\x1b[34m", ship: "\x1b[37;1m", hit: "\x1b[31;1m", miss: "\x1b[36m", sunk: "\x1b[35m"}
+)
+
+const colorReset = "\x1b[0m"
+
+// separator between boards drawn side by side
+const separator = "    "
+
+type board struct {
+	title string
+	cells [][]cell
+}
+
+// Board draws the owner's grid. With FogOfWar the ships that were not hit
+// are drawn as water.
+func Board(g *game.Game, owner game.Player, opts Options) string {
+	return draw([]board{boardOf(g, owner, opts.FogOfWar)}, opts)
+}
+
+// Boards draws the player's own grid next to the opponent's grid. FogOfWar
+// only applies to the opponent's grid.
+func Boards(g *game.Game, player game.Player, opts Options) string {
+	return draw([]board{
+		boardOf(g, player, false),
+		boardOf(g, player.Opponent(), opts.FogOfWar),
+	}, opts)
+}
+
+// Grids draws raw grids side by side, for callers that do not have a whole
+// game such as clients receiving a GameStateMsg. Sunk ships cannot be told
+// apart from hits in a raw grid.
+func Grids(titles []string, grids [][][]game.GridState, opts Options) string {
+	boards := make([]board, len(grids))
+	for i, grid := range grids {
+		if i < len(titles) {
+			boards[i].title = titles[i]
+		}
+		boards[i].cells = make([][]cell, len(grid))
+		for y := range grid {
+			boards[i].cells[y] = make([]cell, len(grid[y]))
+			for x, state := range grid[y] {
+				boards[i].cells[y][x] = cellOf(state, false, opts.FogOfWar)
+			}
+		}
+	}
+	return draw(boards, opts)
+}
+
+func boardOf(g *game.Game, owner game.Player, fog bool) board {
+	grid, name := g.Player1Grid, g.Player1
+	if owner == game.Player2 {
+		grid, name = g.Player2Grid, g.Player2
+	}
+	b := board{title: owner.String()}
+	if name != nil {
+		b.title = fmt.Sprintf("%s (%s)", *name, owner)
+	}
+	b.cells = make([][]cell, len(grid))
+	for y := range grid {
+		b.cells[y] = make([]cell, len(grid[y]))
+		for x, state := range grid[y] {
+			isSunk := false
+			if state == game.HitGrid {
+				piece, ok := g.PieceAt(owner, game.Coord{X: x, Y: y})
+				isSunk = ok && g.IsSunk(owner, piece)
+			}
+			b.cells[y][x] = cellOf(state, isSunk, fog)
+		}
+	}
+	return b
+}
+
+func cellOf(state game.GridState, isSunk, fog bool) cell {
+	switch state {
+	case game.ShipGrid:
+		if fog {
+			return water
+		}
+		return ship
+	case game.HitGrid:
+		if isSunk {
+			return sunk
+		}
+		return hit
+	case game.EmptyHitGrid:
+		return miss
+	default:
+		return water
+	}
+}
+
+// draw renders every board line by line, padding each board to the same
+// width so that they line up side by side
+func draw(boards []board, opts Options) string {
+	glyphs := unicodeGlyphs
+	if opts.ASCII {
+		glyphs = asciiGlyphs
+	}
+
+	var lines [][]string
+	var widths []int
+	height := 0
+	for _, b := range boards {
+		bLines, width := drawBoard(b, glyphs, opts.Color)
+		lines = append(lines, bLines)
+		widths = append(widths, width)
+		if len(bLines) > height {
+			height = len(bLines)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for i := 0; i < height; i++ {
+		var row []string
+		for j := range lines {
+			line := ""
+			if i < len(lines[j]) {
+				line = lines[j][i]
+			}
+			// Pad every board but the last
+			if j < len(lines)-1 {
+				line += strings.Repeat(" ", widths[j]-visibleWidth(line))
+			}
+			row = append(row, line)
+		}
+		buf.WriteString(strings.TrimRight(strings.Join(row, separator), " "))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// drawBoard returns the lines of a board and its width in columns
+func drawBoard(b board, glyphs [5]string, color bool) ([]string, int) {
+	columns := 0
+	for _, row := range b.cells {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	cellWidth := len(game.ColumnName(columns-1)) + 1
+	labelWidth := len(fmt.Sprint(len(b.cells)))
+	width := labelWidth + columns*cellWidth
+	if titleWidth := visibleWidth(b.title); titleWidth > width {
+		width = titleWidth
+	}
+
+	lines := []string{b.title}
+	header := strings.Repeat(" ", labelWidth)
+	for x := 0; x < columns; x++ {
+		header += fmt.Sprintf("%*s", cellWidth, game.ColumnName(x))
+	}
+	lines = append(lines, header)
+
+	for y, row := range b.cells {
+		line := fmt.Sprintf("%*d", labelWidth, y+1)
+		for _, c := range row {
+			line += strings.Repeat(" ", cellWidth-1)
+			if color {
+				line += colors[c] + glyphs[c] + colorReset
+			} else {
+				line += glyphs[c]
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, width
+}
+
+// visibleWidth counts the runes of s that are not part of an ANSI escape code
+func visibleWidth(s string) int {
+	width := 0
+	escape := false
+	for _, r := range s {
+		switch {
+		case escape:
+			if r == 'm' {
+				escape = false
+			}
+		case r == '\x1b':
+			escape = true
+		default:
+			width++
+		}
+	}
+	return width
+}
@@ -0,0 +1,91 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func newGame(t *testing.T) *game.Game {
+	g := gametest.New(t, 4, 3, []game.Piece{
+		{Type: game.PatrolBoat, Start: game.Coord{X: 0, Y: 0}, End: game.Coord{X: 1, Y: 0}},
+		{Type: game.Destroyer, Start: game.Coord{X: 3, Y: 0}, End: game.Coord{X: 3, Y: 2}},
+	})
+	gametest.Play(t, g, "A1", "A3", "B1", "D1", "C2")
+	return g
+}
+
+func TestBoards(t *testing.T) {
+	g := newGame(t)
+	expected := `
+gery (Player2)    jonfk (Player1)
+  A B C D           A B C D
+1 * * . #         1 . . . X
+2 . . o #         2 . . . .
+3 . . . #         3 o . . .
+`
+	out := Boards(g, game.Player2, Options{ASCII: true, FogOfWar: true})
+	if out != expected[1:] {
+		t.Errorf("Unexpected boards:\n%s\nexpected:\n%s", out, expected[1:])
+	}
+
+	expected = `
+jonfk (Player1)
+  A B C D
+1 ■ ■ · ✕
+2 · · · ■
+3 ○ · · ■
+`
+	out = Board(g, game.Player1, Options{})
+	if out != expected[1:] {
+		t.Errorf("Unexpected board:\n%s\nexpected:\n%s", out, expected[1:])
+	}
+}
+
+func TestColor(t *testing.T) {
+	g := newGame(t)
+	out := Boards(g, game.Player1, Options{Color: true})
+	if !strings.Contains(out, colors[sunk]+unicodeGlyphs[sunk]+colorReset) {
+		t.Errorf("Sunk ship should be colored:\n%s", out)
+	}
+	lines := strings.Split(out, "\n")
+	// Both boards should line up even with escape codes
+	if idx := strings.Index(lines[0], "gery"); idx != 19 {
+		t.Errorf("Second board should start at column 19 instead of %d:\n%s", idx, out)
+	}
+	if w := visibleWidth(lines[2]); w != 28 {
+		t.Errorf("Visible width of a row should be 28 instead of %d: %q", w, lines[2])
+	}
+}
+
+func TestGridsWideBoard(t *testing.T) {
+	grid := make([][]game.GridState, 10)
+	for y := range grid {
+		grid[y] = make([]game.GridState, 28)
+	}
+	grid[9][27] = game.HitGrid
+	grid[0][26] = game.ShipGrid
+	out := Grids([]string{"you"}, [][][]game.GridState{grid}, Options{ASCII: true, FogOfWar: true})
+	lines := strings.Split(out, "\n")
+	if !strings.HasSuffix(lines[1], " Y  Z AA AB") {
+		t.Errorf("Columns past Z should be labelled AA and AB: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], " 1  .") || !strings.HasSuffix(lines[2], " .  .  .") {
+		t.Errorf("Unexpected first row with fog of war: %q", lines[2])
+	}
+	if !strings.HasPrefix(lines[11], "10  .") || !strings.HasSuffix(lines[11], " .  X") {
+		t.Errorf("Unexpected last row: %q", lines[11])
+	}
+}
+
+func TestGridsUnicodeTitle(t *testing.T) {
+	grid := [][]game.GridState{{game.EmptyGrid, game.EmptyGrid}}
+	// The title is wider than the board and longer in bytes than in columns
+	out := Grids([]string{"Zoë Ødegård", "you"}, [][][]game.GridState{grid, grid}, Options{ASCII: true})
+	lines := strings.Split(out, "\n")
+	if idx := strings.Index(lines[0], "you"); visibleWidth(lines[0][:idx]) != 11+len(separator) {
+		t.Errorf("Second board should start after the title:\n%s", out)
+	}
+}
@@ -0,0 +1,95 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func TestResult(t *testing.T) {
+	g := gametest.NewStandard(t)
+	if _, over := g.Result(); over {
+		t.Fatal("Game should not be over")
+	}
+	for _, piece := range g.Player2Ships {
+		for _, coord := range piece.Coords() {
+			if err := g.Move(game.Player1, coord); err != nil {
+				t.Fatal(err)
+			}
+			g.CurrentTurn = game.Player1
+		}
+	}
+	result, over := g.Result()
+	if !over || result != (game.Result{Winner: game.Player1, Reason: game.FleetSunk}) {
+		t.Errorf("Player1 should have won by sinking the fleet, got %v and %v", result, over)
+	}
+	if err := g.Move(game.Player1, game.Coord{X: 9, Y: 9}); err == nil {
+		t.Error("Expected Error on move after the game is over")
+	}
+	if err := g.Resign(game.Player2); err == nil {
+		t.Error("Expected Error on resignation after the game is over")
+	}
+}
+
+func TestForfeit(t *testing.T) {
+	for _, reason := range []game.EndReason{game.Resignation, game.Timeout, game.Disconnect} {
+		g := gametest.NewStandard(t)
+		if err := g.Forfeit(game.Player1, reason); err != nil {
+			t.Fatal(err)
+		}
+		result, over := g.Result()
+		if !over || result != (game.Result{Winner: game.Player2, Reason: reason}) || result.IsDraw() {
+			t.Errorf("Player2 should have won by %v, got %v and %v", reason, result, over)
+		}
+		if err := g.Move(game.Player1, game.Coord{X: 5, Y: 5}); err == nil {
+			t.Errorf("Expected Error on move after %v", reason)
+		}
+		if err := g.Forfeit(game.Player2, reason); err == nil {
+			t.Errorf("Expected Error on forfeit after %v", reason)
+		}
+	}
+	g := gametest.NewStandard(t)
+	for _, reason := range []game.EndReason{game.FleetSunk, game.DrawAgreement} {
+		if err := g.Forfeit(game.Player1, reason); err == nil {
+			t.Errorf("Expected Error on forfeit by %v", reason)
+		}
+	}
+	if err := g.Resign(game.Player(3)); err == nil {
+		t.Error("Expected Error on resignation by invalid player")
+	}
+}
+
+func TestDraw(t *testing.T) {
+	g := gametest.NewStandard(t)
+	if err := g.AcceptDraw(game.Player2); err == nil {
+		t.Error("Expected Error on accepting a draw that was not offered")
+	}
+	if err := g.OfferDraw(game.Player1); err != nil {
+		t.Fatal(err)
+	}
+	// Playing on declines the offer
+	if err := g.Move(game.Player1, game.Coord{X: 5, Y: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Move(game.Player2, game.Coord{X: 5, Y: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AcceptDraw(game.Player2); err == nil {
+		t.Error("Expected Error on accepting a declined draw")
+	}
+
+	if err := g.OfferDraw(game.Player1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AcceptDraw(game.Player1); err == nil {
+		t.Error("Expected Error on accepting your own draw offer")
+	}
+	if err := g.AcceptDraw(game.Player2); err != nil {
+		t.Fatal(err)
+	}
+	result, over := g.Result()
+	if !over || !result.IsDraw() {
+		t.Errorf("Game should be a draw, got %v and %v", result, over)
+	}
+}
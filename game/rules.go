@@ -0,0 +1,291 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rules are the settings of a game: the board size, the fleet every player
+// places and the handicap of each player.
+type Rules struct {
+	Size      Coord
+	Fleet     []PieceType
+	Handicaps [2]Handicap
+}
+
+// Handicap evens out a game between players of different strength. The
+// weaker player can be given extra shots, a smaller area to defend or free
+// reveals while the stronger player can be given extra ships to defend.
+type Handicap struct {
+	// ExtraShots is the number of shots the player fires every turn on top
+	// of the usual one
+	ExtraShots int
+	// Area restricts the player's ships to the top left Area.X columns and
+	// Area.Y rows of the board. The whole board is used when it is zero.
+	Area Coord
+	// FreeReveals is the number of opponent cells the player can reveal
+	// without firing or using a turn
+	FreeReveals int
+	// ExtraShips are placed by the player on top of the fleet
+	ExtraShips []PieceType
+}
+
+// MaxBoardSize is the largest width and height of a board, it keeps the grids
+// of a game small
+const MaxBoardSize = 100
+
+// StandardFleet returns one piece of every type
+func StandardFleet() []PieceType {
+	return []PieceType{PatrolBoat, Destroyer, Submarine, Battleship, AircraftCarrier}
+}
+
+// StandardRules returns the rules of a classic 10x10 game without handicaps
+func StandardRules() Rules {
+	return Rules{Size: Coord{X: 10, Y: 10}, Fleet: StandardFleet()}
+}
+
+func NewGameWithRules(rules Rules) (*Game, error) {
+	err := rules.Validate()
+	if err != nil {
+		return nil, err
+	}
+	newGame := NewGame(rules.Size.X, rules.Size.Y)
+	newGame.Rules = rules.Clone()
+	return newGame, nil
+}
+
+// Validate checks that the board is not larger than MaxBoardSize and that the
+// fleet of both players fits in the area they defend
+func (rules Rules) Validate() error {
+	if rules.Size.X <= 0 || rules.Size.Y <= 0 {
+		return newError(ErrInvalidRules, "Rules: invalid board size %dx%d", rules.Size.X, rules.Size.Y)
+	}
+	if rules.Size.X > MaxBoardSize || rules.Size.Y > MaxBoardSize {
+		return newError(ErrInvalidRules, "Rules: board size %dx%d is larger than %dx%d",
+			rules.Size.X, rules.Size.Y, MaxBoardSize, MaxBoardSize)
+	}
+	for _, player := range []Player{Player1, Player2} {
+		handicap := rules.Handicaps[player]
+		if handicap.ExtraShots < 0 || handicap.FreeReveals < 0 {
+			return newError(ErrInvalidRules, "Rules: %v handicap cannot be negative", player)
+		}
+		area := rules.AreaOf(player)
+		if area.X <= 0 || area.Y <= 0 || area.X > rules.Size.X || area.Y > rules.Size.Y {
+			return newError(ErrInvalidRules, "Rules: %v area %dx%d does not fit on the %dx%d board", player, area.X, area.Y, rules.Size.X, rules.Size.Y)
+		}
+		cells := 0
+		for _, piece := range rules.FleetOf(player) {
+			if piece.Length() < 0 {
+				return newError(ErrInvalidRules, "Rules: piece %v is invalid", piece)
+			}
+			if piece.Length() > area.X && piece.Length() > area.Y {
+				return newError(ErrInvalidRules, "Rules: %v %v does not fit in a %dx%d area", player, piece, area.X, area.Y)
+			}
+			cells += piece.Length()
+		}
+		if cells > area.X*area.Y {
+			return newError(ErrInvalidRules, "Rules: %v fleet of %d cells does not fit in a %dx%d area", player, cells, area.X, area.Y)
+		}
+	}
+	return nil
+}
+
+// FleetOf returns the pieces the player has to place
+func (rules Rules) FleetOf(player Player) []PieceType {
+	fleet := make([]PieceType, 0, len(rules.Fleet)+len(rules.Handicaps[player].ExtraShips))
+	fleet = append(fleet, rules.Fleet...)
+	return append(fleet, rules.Handicaps[player].ExtraShips...)
+}
+
+// AreaOf returns the size of the area where the player's ships are placed
+func (rules Rules) AreaOf(player Player) Coord {
+	area := rules.Handicaps[player].Area
+	if area.X == 0 && area.Y == 0 {
+		return rules.Size
+	}
+	return area
+}
+
+// ShotsPerTurn returns how many shots the player fires before the turn changes
+func (rules Rules) ShotsPerTurn(player Player) int {
+	return 1 + rules.Handicaps[player].ExtraShots
+}
+
+// HasHandicaps reports whether either player has a handicap
+func (rules Rules) HasHandicaps() bool {
+	for _, handicap := range rules.Handicaps {
+		if handicap.ExtraShots != 0 || handicap.Area != (Coord{}) || handicap.FreeReveals != 0 || len(handicap.ExtraShips) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (rules Rules) Clone() Rules {
+	clone := rules
+	clone.Fleet = clonePieceTypes(rules.Fleet)
+	for i := range clone.Handicaps {
+		clone.Handicaps[i].ExtraShips = clonePieceTypes(rules.Handicaps[i].ExtraShips)
+	}
+	return clone
+}
+
+func (rules Rules) Equal(other Rules) bool {
+	if rules.Size != other.Size || !equalPieceTypes(rules.Fleet, other.Fleet) {
+		return false
+	}
+	for i := range rules.Handicaps {
+		a, b := rules.Handicaps[i], other.Handicaps[i]
+		if a.ExtraShots != b.ExtraShots || a.Area != b.Area || a.FreeReveals != b.FreeReveals ||
+			!equalPieceTypes(a.ExtraShips, b.ExtraShips) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the rules in the compact form used by game records and the
+// lobby, e.g. "10x10" for the standard rules or
+// "10x10 p1.shots=1 p2.area=6x6 p2.reveals=1 p2.ships=Destroyer,PatrolBoat".
+// The fleet is only written when it is not the standard fleet.
+func (rules Rules) String() string {
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("%dx%d", rules.Size.X, rules.Size.Y))
+	if !equalPieceTypes(rules.Fleet, StandardFleet()) {
+		buf.WriteString(" fleet=" + formatPieceTypes(rules.Fleet))
+	}
+	for i, handicap := range rules.Handicaps {
+		prefix := fmt.Sprintf(" p%d.", i+1)
+		if handicap.ExtraShots != 0 {
+			buf.WriteString(fmt.Sprintf("%sshots=%d", prefix, handicap.ExtraShots))
+		}
+		if handicap.Area != (Coord{}) {
+			buf.WriteString(fmt.Sprintf("%sarea=%dx%d", prefix, handicap.Area.X, handicap.Area.Y))
+		}
+		if handicap.FreeReveals != 0 {
+			buf.WriteString(fmt.Sprintf("%sreveals=%d", prefix, handicap.FreeReveals))
+		}
+		if len(handicap.ExtraShips) > 0 {
+			buf.WriteString(prefix + "ships=" + formatPieceTypes(handicap.ExtraShips))
+		}
+	}
+	return buf.String()
+}
+
+// ParseRules parses rules written by Rules.String. An empty fleet setting,
+// "fleet=", means no pieces besides the handicap ships.
+func ParseRules(s string) (Rules, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return Rules{}, fmt.Errorf("ParseRules: missing board size")
+	}
+	rules := Rules{Fleet: StandardFleet()}
+	size, err := parseSize(fields[0])
+	if err != nil {
+		return rules, fmt.Errorf("ParseRules: invalid board size %q", fields[0])
+	}
+	rules.Size = size
+
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return rules, fmt.Errorf("ParseRules: setting %q should be key=value", field)
+		}
+		key, value := kv[0], kv[1]
+		if key == "fleet" {
+			rules.Fleet, err = parsePieceTypes(value)
+			if err != nil {
+				return rules, err
+			}
+			continue
+		}
+
+		var handicap *Handicap
+		switch {
+		case strings.HasPrefix(key, "p1."):
+			handicap = &rules.Handicaps[Player1]
+		case strings.HasPrefix(key, "p2."):
+			handicap = &rules.Handicaps[Player2]
+		default:
+			return rules, fmt.Errorf("ParseRules: unknown setting %q", key)
+		}
+		switch key[3:] {
+		case "shots":
+			handicap.ExtraShots, err = strconv.Atoi(value)
+		case "area":
+			handicap.Area, err = parseSize(value)
+		case "reveals":
+			handicap.FreeReveals, err = strconv.Atoi(value)
+		case "ships":
+			handicap.ExtraShips, err = parsePieceTypes(value)
+		default:
+			return rules, fmt.Errorf("ParseRules: unknown setting %q", key)
+		}
+		if err != nil {
+			return rules, fmt.Errorf("ParseRules: invalid value for %v: %v", key, err)
+		}
+	}
+	return rules, rules.Validate()
+}
+
+func parseSize(s string) (Coord, error) {
+	var size Coord
+	parts := strings.Split(s, "x")
+	if len(parts) != 2 {
+		return size, fmt.Errorf("size %q should be written WIDTHxHEIGHT", s)
+	}
+	var err error
+	if size.X, err = strconv.Atoi(parts[0]); err != nil {
+		return size, err
+	}
+	if size.Y, err = strconv.Atoi(parts[1]); err != nil {
+		return size, err
+	}
+	return size, nil
+}
+
+func formatPieceTypes(pieces []PieceType) string {
+	names := make([]string, len(pieces))
+	for i, piece := range pieces {
+		names[i] = piece.String()
+	}
+	return strings.Join(names, ",")
+}
+
+func parsePieceTypes(s string) ([]PieceType, error) {
+	var pieces []PieceType
+	if s == "" {
+		return pieces, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		piece, err := ParsePieceType(name)
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces, piece)
+	}
+	return pieces, nil
+}
+
+func clonePieceTypes(pieces []PieceType) []PieceType {
+	if pieces == nil {
+		return nil
+	}
+	clone := make([]PieceType, len(pieces))
+	copy(clone, pieces)
+	return clone
+}
+
+func equalPieceTypes(a, b []PieceType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package game_test
+
+import (
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+func TestRulesString(t *testing.T) {
+	tests := []struct {
+		rules game.Rules
+		s     string
+	}{
+		{game.StandardRules(), "10x10"},
+		{game.Rules{Size: game.Coord{X: 12, Y: 8}, Fleet: []game.PieceType{game.Destroyer, game.Destroyer}}, "12x8 fleet=Destroyer,Destroyer"},
+		{game.Rules{Size: game.Coord{X: 10, Y: 10}, Fleet: game.StandardFleet(), Handicaps: [2]game.Handicap{
+			game.Handicap{ExtraShips: []game.PieceType{game.Submarine, game.PatrolBoat}},
+			game.Handicap{ExtraShots: 1, Area: game.Coord{X: 6, Y: 7}, FreeReveals: 2},
+		}}, "10x10 p1.ships=Submarine,PatrolBoat p2.shots=1 p2.area=6x7 p2.reveals=2"},
+	}
+	for _, test := range tests {
+		if s := test.rules.String(); s != test.s {
+			t.Errorf("Rules should be written %q instead it is %q", test.s, s)
+		}
+		rules, err := game.ParseRules(test.s)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !rules.Equal(test.rules) {
+			t.Errorf("ParseRules(%q) should be %#v instead it is %#v", test.s, test.rules, rules)
+		}
+	}
+	if tests[1].rules.HasHandicaps() || !tests[2].rules.HasHandicaps() {
+		t.Error("HasHandicaps should only be true for the rules with handicaps")
+	}
+
+	for _, s := range []string{"", "10", "10x", "axb", "0x10", "10x10 fleet", "10x10 p3.shots=1", "10x10 p1.speed=2",
+		"10x10 p1.shots=many", "10x10 p1.shots=-1", "10x10 p1.area=4x4", "10x10 p1.area=11x5", "10x10 fleet=Rowboat", "3x3",
+		"100000x100000", "101x10", "10x9223372036854775807"} {
+		if rules, err := game.ParseRules(s); err == nil {
+			t.Errorf("ParseRules(%q) should fail instead it is %v", s, rules)
+		}
+	}
+	if _, err := game.ParseRules("100x100"); err != nil {
+		t.Errorf("the largest board should be valid: %v", err)
+	}
+}
+
+func TestHandicapExtraShots(t *testing.T) {
+	rules := game.StandardRules()
+	rules.Handicaps[game.Player2].ExtraShots = 2
+	g, err := game.NewGameWithRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := []game.Shot{
+		{Player: game.Player1, Coord: game.Coord{X: 0, Y: 0}},
+		{Player: game.Player2, Coord: game.Coord{X: 0, Y: 0}},
+		{Player: game.Player2, Coord: game.Coord{X: 1, Y: 0}},
+		{Player: game.Player2, Coord: game.Coord{X: 2, Y: 0}},
+		{Player: game.Player1, Coord: game.Coord{X: 1, Y: 0}},
+	}
+	for _, move := range moves {
+		if g.CurrentTurn != move.Player {
+			t.Fatalf("Should be %v's turn before %v instead it is %v's", move.Player, move.Coord.Notation(), g.CurrentTurn)
+		}
+		if err := g.Move(move.Player, move.Coord); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Move(game.Player1, game.Coord{X: 2, Y: 0}); err == nil {
+		t.Error("Player1 should only have one shot per turn")
+	}
+}
+
+func TestHandicapArea(t *testing.T) {
+	rules := game.StandardRules()
+	rules.Handicaps[game.Player1].Area = game.Coord{X: 5, Y: 6}
+	g, err := game.NewGameWithRules(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetPiece(game.Player1, game.Coord{X: 4, Y: 1}, game.Coord{X: 4, Y: 5}, game.AircraftCarrier); err != nil {
+		t.Error(err)
+	}
+	if err := g.SetPiece(game.Player1, game.Coord{X: 0, Y: 5}, game.Coord{X: 0, Y: 6}, game.PatrolBoat); err == nil {
+		t.Error("Player1 should not be able to place a piece outside of the area")
+	}
+	if err := g.SetPiece(game.Player1, game.Coord{X: 4, Y: 0}, game.Coord{X: 5, Y: 0}, game.PatrolBoat); err == nil {
+		t.Error("Player1 should not be able to place a piece outside of the area")
+	}
+	if err := g.SetPiece(game.Player2, game.Coord{X: 9, Y: 5}, game.Coord{X: 9, Y: 9}, game.AircraftCarrier); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandicapExtraShips(t *testing.T) {
+	g := gametest.New(t, 10, 10, gametest.FleetInColumns(1))
+	g.Rules.Handicaps[game.Player1].ExtraShips = []game.PieceType{game.Destroyer}
+	if g.IsReadyToStart() {
+		t.Error("Player1 still has an extra destroyer to place")
+	}
+	if err := g.SetPiece(game.Player2, game.Coord{X: 9, Y: 0}, game.Coord{X: 9, Y: 2}, game.Destroyer); err == nil {
+		t.Error("Player2 should not be able to place a second destroyer")
+	}
+	if err := g.SetPiece(game.Player1, game.Coord{X: 9, Y: 0}, game.Coord{X: 9, Y: 2}, game.Destroyer); err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsReadyToStart() {
+		t.Error("Game should be ready to start")
+	}
+}
+
+func TestHandicapFreeReveals(t *testing.T) {
+	g := gametest.NewStandard(t)
+	if _, err := g.Reveal(game.Player1, game.Coord{X: 0, Y: 0}); err == nil {
+		t.Error("Player1 should not have any free reveals")
+	}
+	g.Rules.Handicaps[game.Player1].FreeReveals = 1
+	ship, err := g.Reveal(game.Player1, game.Coord{X: 0, Y: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ship {
+		t.Error("There should be a ship at A1")
+	}
+	if g.CurrentTurn != game.Player1 || g.Player2Grid[0][0] != game.ShipGrid || len(g.History) != 0 {
+		t.Error("A reveal should not fire a shot or use the turn")
+	}
+	if len(g.Reveals) != 1 || g.Reveals[0] != (game.FreeReveal{Player: game.Player1, Coord: game.Coord{X: 0, Y: 0}, Ship: true}) {
+		t.Errorf("The reveal should be kept, got %v", g.Reveals)
+	}
+	if _, err := g.Reveal(game.Player1, game.Coord{X: 9, Y: 9}); err == nil {
+		t.Error("Player1 should have used the only free reveal")
+	}
+}
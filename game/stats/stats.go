@@ -0,0 +1,161 @@
+// Package stats computes statistics from the history of finished games. The
+// statistics of a single game can be merged to build player profiles or to
+// evaluate bots over many games.
+package stats
+
+import (
+	"github.com/jonfk/battleship/game"
+)
+
+// PlayerStats holds counts from which the usual metrics are derived. Counts
+// are kept instead of averages so that stats of several games can be merged.
+type PlayerStats struct {
+	Games     int
+	Shots     int
+	Hits      int
+	ShipsSunk int
+	// FirstHitShots is the total number of shots needed to land the first
+	// hit, over the games where the player hit anything
+	FirstHitShots int
+	GamesWithHit  int
+	// SinkShots is the total number of shots fired from the first hit on a
+	// ship until it sank, over every ship sunk
+	SinkShots         int
+	LongestMissStreak int
+}
+
+// ForPlayer computes the stats of the shots fired by player in the game
+func ForPlayer(g *game.Game, player game.Player) PlayerStats {
+	stats := PlayerStats{Games: 1}
+	// Shot number of the first hit on each of the opponent's pieces
+	firstHits := make(map[game.Piece]int)
+	missStreak := 0
+	for _, shot := range g.History {
+		if shot.Player != player {
+			continue
+		}
+		stats.Shots++
+		if shot.Result == game.Miss {
+			missStreak++
+			if missStreak > stats.LongestMissStreak {
+				stats.LongestMissStreak = missStreak
+			}
+			continue
+		}
+
+		missStreak = 0
+		stats.Hits++
+		if stats.Hits == 1 {
+			stats.FirstHitShots = stats.Shots
+			stats.GamesWithHit = 1
+		}
+		piece, ok := g.PieceAt(player.Opponent(), shot.Coord)
+		if !ok {
+			continue
+		}
+		if _, ok := firstHits[piece]; !ok {
+			firstHits[piece] = stats.Shots
+		}
+		if shot.Result == game.Sunk {
+			stats.ShipsSunk++
+			stats.SinkShots += stats.Shots - firstHits[piece] + 1
+		}
+	}
+	return stats
+}
+
+// Merge adds the counts of other to stats
+func (stats *PlayerStats) Merge(other PlayerStats) {
+	stats.Games += other.Games
+	stats.Shots += other.Shots
+	stats.Hits += other.Hits
+	stats.ShipsSunk += other.ShipsSunk
+	stats.FirstHitShots += other.FirstHitShots
+	stats.GamesWithHit += other.GamesWithHit
+	stats.SinkShots += other.SinkShots
+	if other.LongestMissStreak > stats.LongestMissStreak {
+		stats.LongestMissStreak = other.LongestMissStreak
+	}
+}
+
+// Accuracy returns the fraction of shots that hit a ship
+func (stats PlayerStats) Accuracy() float64 {
+	return ratio(stats.Hits, stats.Shots)
+}
+
+// ShotsToFirstHit returns the average number of shots fired up to and
+// including the first hit of a game
+func (stats PlayerStats) ShotsToFirstHit() float64 {
+	return ratio(stats.FirstHitShots, stats.GamesWithHit)
+}
+
+// ShotsToSink returns the average number of shots fired from the first hit on
+// a ship up to and including the shot sinking it. Shots fired at other cells
+// in between are counted.
+func (stats PlayerStats) ShotsToSink() float64 {
+	return ratio(stats.SinkShots, stats.ShipsSunk)
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// Heatmap counts how often each cell of the board was used over many games
+type Heatmap struct {
+	Size  game.Coord
+	Cells [][]int
+	Games int
+}
+
+func NewHeatmap(x, y int) *Heatmap {
+	heatmap := &Heatmap{Size: game.Coord{X: x, Y: y}}
+	heatmap.Cells = make([][]int, y)
+	for i := range heatmap.Cells {
+		heatmap.Cells[i] = make([]int, x)
+	}
+	return heatmap
+}
+
+// AddPlacements counts the cells covered by the player's ships in the game
+func (heatmap *Heatmap) AddPlacements(g *game.Game, player game.Player) {
+	ships := g.Player1Ships
+	if player == game.Player2 {
+		ships = g.Player2Ships
+	}
+	heatmap.Games++
+	for _, piece := range ships {
+		for _, coord := range piece.Coords() {
+			heatmap.add(coord)
+		}
+	}
+}
+
+// AddShots counts the cells the player fired at in the game
+func (heatmap *Heatmap) AddShots(g *game.Game, player game.Player) {
+	heatmap.Games++
+	for _, shot := range g.History {
+		if shot.Player == player {
+			heatmap.add(shot.Coord)
+		}
+	}
+}
+
+// Frequency returns the average number of times the cell was used per game
+func (heatmap *Heatmap) Frequency(coord game.Coord) float64 {
+	if coord.X < 0 || coord.X >= heatmap.Size.X || coord.Y < 0 || coord.Y >= heatmap.Size.Y {
+		return 0
+	}
+	return ratio(heatmap.Cells[coord.Y][coord.X], heatmap.Games)
+}
+
+// Cells outside of the heatmap are ignored so games on larger boards can be
+// aggregated with smaller ones
+func (heatmap *Heatmap) add(coord game.Coord) {
+	if coord.X < 0 || coord.X >= heatmap.Size.X || coord.Y < 0 || coord.Y >= heatmap.Size.Y {
+		return
+	}
+	heatmap.Cells[coord.Y][coord.X]++
+}
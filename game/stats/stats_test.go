@@ -0,0 +1,77 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/game/gametest"
+)
+
+// newGame returns a game with the fleets in the first columns where Player1
+// sank the patrol boat while Player2 only missed
+func newGame(t *testing.T) *game.Game {
+	g := gametest.New(t, 10, 10, gametest.FleetInColumns(1))
+	gametest.Play(t, g, "J10", "H1", "J9", "H2", "A1", "H3", "J8", "H4", "A2")
+	return g
+}
+
+func TestForPlayer(t *testing.T) {
+	g := newGame(t)
+	p1 := ForPlayer(g, game.Player1)
+	expected := PlayerStats{Games: 1, Shots: 5, Hits: 2, ShipsSunk: 1, FirstHitShots: 3, GamesWithHit: 1, SinkShots: 3, LongestMissStreak: 2}
+	if p1 != expected {
+		t.Errorf("Player1 stats should be %+v instead they are %+v", expected, p1)
+	}
+	if p1.Accuracy() != 0.4 || p1.ShotsToFirstHit() != 3 || p1.ShotsToSink() != 3 {
+		t.Errorf("Unexpected Player1 metrics %v %v %v", p1.Accuracy(), p1.ShotsToFirstHit(), p1.ShotsToSink())
+	}
+
+	p2 := ForPlayer(g, game.Player2)
+	expected = PlayerStats{Games: 1, Shots: 4, LongestMissStreak: 4}
+	if p2 != expected {
+		t.Errorf("Player2 stats should be %+v instead they are %+v", expected, p2)
+	}
+	if p2.Accuracy() != 0 || p2.ShotsToFirstHit() != 0 || p2.ShotsToSink() != 0 {
+		t.Errorf("Unexpected Player2 metrics %v %v %v", p2.Accuracy(), p2.ShotsToFirstHit(), p2.ShotsToSink())
+	}
+
+	p1.Merge(p2)
+	expected = PlayerStats{Games: 2, Shots: 9, Hits: 2, ShipsSunk: 1, FirstHitShots: 3, GamesWithHit: 1, SinkShots: 3, LongestMissStreak: 4}
+	if p1 != expected {
+		t.Errorf("Merged stats should be %+v instead they are %+v", expected, p1)
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	g := newGame(t)
+	placements := NewHeatmap(10, 10)
+	shots := NewHeatmap(10, 10)
+	for i := 0; i < 2; i++ {
+		placements.AddPlacements(g, game.Player1)
+		shots.AddShots(g, game.Player1)
+	}
+	// Every piece starts on the first row
+	for x := 0; x < 5; x++ {
+		if f := placements.Frequency(game.Coord{X: x, Y: 0}); f != 1 {
+			t.Errorf("Placement frequency of %v should be 1 instead it is %v", game.Coord{X: x, Y: 0}.Notation(), f)
+		}
+	}
+	if f := placements.Frequency(game.Coord{X: 4, Y: 4}); f != 1 {
+		t.Errorf("Placement frequency of E5 should be 1 instead it is %v", f)
+	}
+	if f := placements.Frequency(game.Coord{X: 0, Y: 2}); f != 0 {
+		t.Errorf("Placement frequency of A3 should be 0 instead it is %v", f)
+	}
+	if shots.Cells[9][9] != 2 || shots.Cells[0][0] != 2 || shots.Frequency(game.Coord{X: 9, Y: 7}) != 1 {
+		t.Errorf("Unexpected shot heatmap %v", shots.Cells)
+	}
+	if shots.Frequency(game.Coord{X: 10, Y: 0}) != 0 {
+		t.Error("Cells outside of the heatmap should have a frequency of 0")
+	}
+
+	small := NewHeatmap(5, 5)
+	small.AddShots(g, game.Player1)
+	if small.Cells[0][0] != 1 {
+		t.Errorf("Shots inside of a smaller heatmap should be counted")
+	}
+}
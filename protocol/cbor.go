@@ -0,0 +1,227 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+)
+
+/*
+ * CBOR encoding of value trees, see RFC 8949. Only definite lengths are
+ * written and read. Tags are skipped when reading.
+ */
+
+const (
+	cborUint = iota << 5
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+func appendCBOR(buf []byte, tree interface{}) []byte {
+	switch tree := tree.(type) {
+	case nil:
+		return append(buf, cborSimple|22)
+	case bool:
+		if tree {
+			return append(buf, cborSimple|21)
+		}
+		return append(buf, cborSimple|20)
+	case int64:
+		if tree < 0 {
+			return appendCBORHead(buf, cborNegInt, uint64(-1-tree))
+		}
+		return appendCBORHead(buf, cborUint, uint64(tree))
+	case uint64:
+		return appendCBORHead(buf, cborUint, tree)
+	case float64:
+		return appendUint64(append(buf, cborSimple|27), math.Float64bits(tree))
+	case string:
+		return append(appendCBORHead(buf, cborText, uint64(len(tree))), tree...)
+	case []byte:
+		return append(appendCBORHead(buf, cborBytes, uint64(len(tree))), tree...)
+	case []interface{}:
+		buf = appendCBORHead(buf, cborArray, uint64(len(tree)))
+		for _, item := range tree {
+			buf = appendCBOR(buf, item)
+		}
+		return buf
+	case object:
+		buf = appendCBORHead(buf, cborMap, uint64(len(tree)))
+		for _, member := range tree {
+			buf = appendCBOR(buf, member.Key)
+			buf = appendCBOR(buf, member.Value)
+		}
+		return buf
+	default:
+		panic(fmt.Sprintf("protocol: unexpected %T in value tree", tree))
+	}
+}
+
+// appendCBORHead writes the major type and its argument in the shortest form
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return appendUint32(append(buf, major|26), uint32(n))
+	default:
+		return appendUint64(append(buf, major|27), n)
+	}
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head reads the major type and argument of the next item
+func (d *cborDecoder) head() (byte, uint64, byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info := b[0]&0xe0, b[0]&0x1f
+	if info < 24 {
+		return major, uint64(info), info, nil
+	}
+	if info > 27 {
+		return 0, 0, 0, fmt.Errorf("protocol: unsupported CBOR additional information %d", info)
+	}
+	b, err = d.next(1 << (info - 24))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return major, n, info, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxTreeDepth {
+		return nil, errTooDeep
+	}
+	major, n, info, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("protocol: CBOR integer -1-%d overflows int64", n)
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case cborText:
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case cborArray:
+		// Every item takes at least a byte, which bounds the allocation
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, errTruncated
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case cborMap:
+		if n > uint64(len(d.data)-d.pos)/2 {
+			return nil, errTruncated
+		}
+		obj := make(object, n)
+		for i := range obj {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("protocol: CBOR map key %v is not a string", key)
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			obj[i] = member{s, value}
+		}
+		return obj, nil
+	case cborTag:
+		return d.decode(depth + 1)
+	default:
+		switch {
+		case info == 20:
+			return false, nil
+		case info == 21:
+			return true, nil
+		case info == 22 || info == 23:
+			return nil, nil
+		case info == 25:
+			return halfToFloat(uint16(n)), nil
+		case info == 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case info == 27:
+			return math.Float64frombits(n), nil
+		default:
+			return nil, fmt.Errorf("protocol: unsupported CBOR simple value %d", n)
+		}
+	}
+}
+
+// halfToFloat converts an IEEE 754 half precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,456 @@
+// Package client is a Go client of the battleship server. A Client wraps a
+// connection, sends requests and waits for their replies while the messages
+// the server pushes on its own, such as the opponent's moves, chat messages
+// and the end of the game, are delivered on a channel or to a callback.
+//
+//	c, err := client.Dial("localhost:8888", nil)
+//	...
+//	welcome, err := c.Connect("jonfk")
+//	id, err := c.CreateGame("")
+//	for event := range c.Events() {
+//		...
+//	}
+//
+// Requests are safe to call from several goroutines, including from the
+// callback.
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/protocol"
+)
+
+// DefaultTimeout is how long requests wait for their reply
+const DefaultTimeout = 10 * time.Second
+
+// MaxQueuedEvents is how many events wait to be received at most, the oldest
+// are dropped past it
+const MaxQueuedEvents = 1024
+
+// Client is a connection to a battleship server
+type Client struct {
+	// Timeout is how long requests wait for their reply
+	Timeout time.Duration
+
+	conn      net.Conn
+	frames    *protocol.FrameReader
+	writer    *protocol.MsgWriter
+	requester *protocol.Requester
+	keepalive *protocol.Keepalive
+
+	mu sync.Mutex
+	// replica is the game followed through the updates, nil when none
+	replica *protocol.GameReplica
+	// snapshotPending is set from a gap in the updates until the snapshot
+	// requested arrives
+	snapshotPending bool
+	// queue holds the events not dispatched yet, ready is signaled when
+	// events are added
+	queue   []protocol.BattleMsg
+	ready   chan struct{}
+	handler func(protocol.BattleMsg)
+	events  chan protocol.BattleMsg
+	err     error
+	// done is closed once the connection failed and closed once Close is
+	// called
+	done      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// New wraps a connection to the server and starts reading it. Connect must
+// be called before any other request.
+func New(conn net.Conn) *Client {
+	writer := protocol.NewMsgWriter(conn)
+	c := &Client{
+		Timeout:   DefaultTimeout,
+		conn:      conn,
+		frames:    protocol.NewFrameReader(conn),
+		writer:    writer,
+		requester: protocol.NewRequester(writer),
+		keepalive: protocol.NewKeepalive(conn, writer, protocol.DefaultPingInterval, protocol.DefaultPingTimeout),
+		ready:     make(chan struct{}, 1),
+		events:    make(chan protocol.BattleMsg),
+		done:      make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	go c.read()
+	go c.dispatch()
+	return c
+}
+
+// Dial connects to the server at addr, with TLS when tlsConfig is not nil
+func Dial(addr string, tlsConfig *tls.Config) (*Client, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if tlsConfig != nil {
+		conn, err = tls.Dial("tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Dial: %v", err)
+	}
+	return New(conn), nil
+}
+
+// Events returns the channel on which the messages pushed by the server are
+// delivered: GameMoveMsg, ChatMessageMsg, GamePreGameStatusMsg when an
+// opponent joins, GameStateMsg, GameOverMsg, OfferDrawMsg and the game
+// updates. It is closed once the connection failed and the events read
+// before were received, or right away when Close is called. Events are
+// queued so that requests never wait on them, past MaxQueuedEvents the oldest
+// are dropped so the channel must be drained.
+func (c *Client) Events() <-chan protocol.BattleMsg {
+	return c.events
+}
+
+// OnEvent makes handler receive the events instead of the Events channel.
+// It is called from a single goroutine, in order.
+func (c *Client) OnEvent(handler func(protocol.BattleMsg)) {
+	c.mu.Lock()
+	c.handler = handler
+	c.mu.Unlock()
+	c.signal()
+}
+
+// Connect sends the handshake and returns the version and features picked by
+// the server. The connection then uses the negotiated codec and compression.
+func (c *Client) Connect(username string) (protocol.WelcomeMsg, error) {
+	reply, err := c.request(protocol.HelloMsg{
+		Version:  protocol.ProtocolVersion,
+		Username: username,
+		Features: protocol.Features{
+			Variants:    []string{protocol.VariantStandard, protocol.VariantHandicap},
+			Codecs:      protocol.CodecNames(),
+			Compression: protocol.CompressionNames(),
+		},
+	})
+	if err != nil {
+		return protocol.WelcomeMsg{}, err
+	}
+	welcome, ok := reply.(protocol.WelcomeMsg)
+	if !ok {
+		return welcome, unexpected("Connect", reply)
+	}
+	c.writer.SetCodec(protocol.NegotiatedCodec(welcome.Features))
+	c.writer.SetCompression(protocol.NegotiatedCompression(welcome.Features))
+	// Older servers do not answer pings
+	if welcome.Version >= protocol.KeepaliveVersion {
+		c.keepalive.Start()
+	}
+	return welcome, nil
+}
+
+// ListOpenGames returns the games waiting for an opponent
+func (c *Client) ListOpenGames() ([]protocol.Game, error) {
+	reply, err := c.request(protocol.RequestOpenGamesListMsg{})
+	if err != nil {
+		return nil, err
+	}
+	list, ok := reply.(protocol.OpenGamesListMsg)
+	if !ok {
+		return nil, unexpected("ListOpenGames", reply)
+	}
+	return list.Games, nil
+}
+
+// CreateGame creates a game with rules in the form written by
+// game.Rules.String, the standard rules when empty, and returns its ID
+func (c *Client) CreateGame(rules string) (int, error) {
+	reply, err := c.request(protocol.CreateGameMsg{Rules: rules})
+	if err != nil {
+		return 0, err
+	}
+	status, ok := reply.(protocol.GamePreGameStatusMsg)
+	if !ok {
+		return 0, unexpected("CreateGame", reply)
+	}
+	return status.Id, nil
+}
+
+// Join joins an open game and returns the username of its creator
+func (c *Client) Join(id int) (string, error) {
+	reply, err := c.request(protocol.JoinGameMsg{Id: id})
+	if err != nil {
+		return "", err
+	}
+	status, ok := reply.(protocol.GamePreGameStatusMsg)
+	if !ok {
+		return "", unexpected("Join", reply)
+	}
+	return status.Opponent, nil
+}
+
+// PlacePiece places a piece of the player's fleet
+func (c *Client) PlacePiece(piece game.PieceType, start, end game.Coord) error {
+	return c.ok("PlacePiece", protocol.GameSetPieceMsg{
+		Piece: int(piece),
+		Start: protocol.Coord{X: start.X, Y: start.Y},
+		End:   protocol.Coord{X: end.X, Y: end.Y},
+	})
+}
+
+// Fire shoots at the opponent's grid and returns the result of the shot
+func (c *Client) Fire(coord game.Coord) (game.ShotResult, error) {
+	reply, err := c.request(protocol.GameMoveMsg{X: coord.X, Y: coord.Y})
+	if err != nil {
+		return game.Miss, err
+	}
+	ok, isOk := reply.(protocol.OkMsg)
+	if !isOk {
+		return game.Miss, unexpected("Fire", reply)
+	}
+	switch ok.Ok {
+	case "hit":
+		return game.Hit, nil
+	case "sunk":
+		return game.Sunk, nil
+	case "miss":
+		return game.Miss, nil
+	}
+	return game.Miss, fmt.Errorf("Fire: unknown shot result %q", ok.Ok)
+}
+
+// Chat sends a message to the opponent
+func (c *Client) Chat(msg string) error {
+	return c.ok("Chat", protocol.ChatMessageMsg{Msg: msg})
+}
+
+// Abandon resigns the game in progress
+func (c *Client) Abandon() error {
+	return c.ok("Abandon", protocol.AbandonGameMsg{})
+}
+
+// OfferDraw offers a draw to the opponent
+func (c *Client) OfferDraw() error {
+	return c.ok("OfferDraw", protocol.OfferDrawMsg{})
+}
+
+// AcceptDraw accepts the draw offered by the opponent
+func (c *Client) AcceptDraw() error {
+	return c.ok("AcceptDraw", protocol.AcceptDrawMsg{})
+}
+
+// GameState asks the server for the game as seen by the player
+func (c *Client) GameState() (protocol.GameStateMsg, error) {
+	reply, err := c.request(protocol.RequestGameStateMsg{})
+	if err != nil {
+		return protocol.GameStateMsg{}, err
+	}
+	state, ok := reply.(protocol.GameStateMsg)
+	if !ok {
+		return state, unexpected("GameState", reply)
+	}
+	return state, nil
+}
+
+// Game returns a copy of the game followed through the updates of the
+// server, nil before the fleets are placed or when the server does not send
+// updates
+func (c *Client) Game() *protocol.GameReplica {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replica == nil {
+		return nil
+	}
+	replica := *c.replica
+	replica.YourGrid = cloneCells(replica.YourGrid)
+	replica.OpponentGrid = cloneCells(replica.OpponentGrid)
+	for i := range replica.Sunk {
+		replica.Sunk[i] = append([]protocol.ShipSunkMsg(nil), replica.Sunk[i]...)
+	}
+	return &replica
+}
+
+// Err returns the error that ended the connection, nil while it is open
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection, the events not received yet are dropped
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+// request sends a request and returns its reply, an ErrorMsg reply is
+// returned as the error
+func (c *Client) request(msg protocol.BattleMsg) (protocol.BattleMsg, error) {
+	reply, err := c.requester.Request(msg, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if errMsg, ok := reply.(protocol.ErrorMsg); ok {
+		return nil, errMsg
+	}
+	return reply, nil
+}
+
+// ok sends a request answered by an OkMsg
+func (c *Client) ok(name string, msg protocol.BattleMsg) error {
+	reply, err := c.request(msg)
+	if err != nil {
+		return err
+	}
+	if _, ok := reply.(protocol.OkMsg); !ok {
+		return unexpected(name, reply)
+	}
+	return nil
+}
+
+// read reads the connection until it fails, delivering replies to the
+// requests and queuing the other messages as events
+func (c *Client) read() {
+	var err error
+	defer func() {
+		c.keepalive.Stop()
+		c.requester.Close(err)
+		c.conn.Close()
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+	}()
+	for {
+		var (
+			msg       protocol.BattleMsg
+			requestID uint32
+		)
+		msg, requestID, err = c.frames.ReadMsgID()
+		if err != nil {
+			return
+		}
+		if c.keepalive.Received(msg) {
+			continue
+		}
+		// Messages following the welcome use the negotiated codec
+		if welcome, ok := msg.(protocol.WelcomeMsg); ok {
+			c.frames.Codec = protocol.NegotiatedCodec(welcome.Features)
+			c.frames.Compression = protocol.NegotiatedCompression(welcome.Features)
+		}
+		// The snapshots asked for are replies, they are applied here to keep
+		// them in order with the updates
+		if protocol.IsUpdate(msg) {
+			c.update(msg)
+		}
+		if c.requester.Deliver(requestID, msg) {
+			continue
+		}
+		c.push(msg)
+	}
+}
+
+// push queues an event, dropping the oldest one when the queue is full
+func (c *Client) push(msg protocol.BattleMsg) {
+	c.mu.Lock()
+	if len(c.queue) == MaxQueuedEvents {
+		c.queue = c.queue[1:]
+	}
+	c.queue = append(c.queue, msg)
+	c.mu.Unlock()
+	c.signal()
+}
+
+// update applies a game update to the replica, asking for a snapshot when
+// updates were missed. A single snapshot is asked for until it arrives.
+func (c *Client) update(msg protocol.BattleMsg) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if snapshot, ok := msg.(protocol.GameSnapshotMsg); ok {
+		c.snapshotPending = false
+		if c.replica == nil {
+			c.replica = protocol.NewGameReplica(snapshot)
+			return
+		}
+	}
+	if c.replica == nil {
+		return
+	}
+	if errors.Is(c.replica.Apply(msg), protocol.ErrSequenceGap) && !c.snapshotPending {
+		c.snapshotPending = true
+		go c.requestSnapshot()
+	}
+}
+
+// requestSnapshot asks for the snapshot resetting the replica and passes it
+// on as an event. When the request fails the next gap asks again.
+func (c *Client) requestSnapshot() {
+	reply, err := c.request(protocol.RequestSnapshotMsg{})
+	if _, ok := reply.(protocol.GameSnapshotMsg); err == nil && ok {
+		c.push(reply)
+		return
+	}
+	c.mu.Lock()
+	c.snapshotPending = false
+	c.mu.Unlock()
+}
+
+func (c *Client) signal() {
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands the queued events to the handler or the Events channel. It
+// runs apart from read so that a slow consumer never holds up replies.
+func (c *Client) dispatch() {
+	defer close(c.events)
+	for {
+		c.mu.Lock()
+		queue, handler := c.queue, c.handler
+		c.queue = nil
+		c.mu.Unlock()
+		for _, msg := range queue {
+			if handler != nil {
+				handler(msg)
+				continue
+			}
+			select {
+			case c.events <- msg:
+			case <-c.closed:
+				return
+			}
+		}
+		if len(queue) > 0 {
+			continue
+		}
+		select {
+		case <-c.ready:
+		case <-c.closed:
+			return
+		case <-c.done:
+			// Deliver what was read before the connection failed
+			c.mu.Lock()
+			empty := len(c.queue) == 0
+			c.mu.Unlock()
+			if empty {
+				return
+			}
+		}
+	}
+}
+
+func unexpected(name string, reply protocol.BattleMsg) error {
+	return fmt.Errorf("%s: unexpected reply %T", name, reply)
+}
+
+func cloneCells(cells [][]int) [][]int {
+	clone := make([][]int, len(cells))
+	for i := range cells {
+		clone[i] = append([]int(nil), cells[i]...)
+	}
+	return clone
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jonfk/battleship/game"
+	"github.com/jonfk/battleship/protocol"
+)
+
+// push is a message sent by the fake server without request ID
+type push struct {
+	msg protocol.BattleMsg
+}
+
+// fakeServer answers the handshake then passes every request to answer. The
+// messages returned are sent in order, pushes without request ID and the
+// others as the reply. Requests without request ID are answered as well.
+func fakeServer(t *testing.T, answer func(msg protocol.BattleMsg) []interface{}) *Client {
+	conn, serverConn := net.Pipe()
+	go func() {
+		defer serverConn.Close()
+		frames, writer := protocol.NewFrameReader(serverConn), protocol.NewMsgWriter(serverConn)
+		for {
+			msg, requestID, err := frames.ReadMsgID()
+			if err != nil {
+				return
+			}
+			if hello, ok := msg.(protocol.HelloMsg); ok {
+				welcome, err := protocol.Negotiate(hello, protocol.Features{
+					Variants:    []string{protocol.VariantStandard},
+					Codecs:      protocol.CodecNames(),
+					Compression: protocol.CompressionNames(),
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				writer.WriteMsgID(requestID, welcome)
+				frames.Codec, frames.Compression = protocol.NegotiatedCodec(welcome.Features), protocol.NegotiatedCompression(welcome.Features)
+				writer.SetCodec(frames.Codec)
+				writer.SetCompression(frames.Compression)
+				continue
+			}
+			if _, ok := msg.(protocol.PingMsg); ok {
+				writer.WriteMsg(protocol.PongMsg{})
+				continue
+			}
+			for _, out := range answer(msg) {
+				switch out := out.(type) {
+				case push:
+					writer.WriteMsg(out.msg)
+				case nil:
+					return
+				default:
+					writer.WriteMsgID(requestID, out.(protocol.BattleMsg))
+				}
+			}
+		}
+	}()
+	c := New(conn)
+	c.Timeout = time.Second
+	if _, err := c.Connect("jonfk"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRequests(t *testing.T) {
+	c := fakeServer(t, func(msg protocol.BattleMsg) []interface{} {
+		switch msg := msg.(type) {
+		case protocol.RequestOpenGamesListMsg:
+			return []interface{}{protocol.OpenGamesListMsg{Games: []protocol.Game{{Id: 1, Username: "gery"}}}}
+		case protocol.CreateGameMsg:
+			return []interface{}{protocol.GamePreGameStatusMsg{Id: 2}}
+		case protocol.JoinGameMsg:
+			return []interface{}{protocol.ErrorMsg{Code: protocol.GameNotFound, Message: "no such game"}}
+		case protocol.GameSetPieceMsg:
+			if msg.End != (protocol.Coord{X: 1, Y: 0}) {
+				return []interface{}{protocol.ErrorMsg{Code: protocol.InvalidMessage}}
+			}
+			return []interface{}{protocol.OkMsg{}}
+		case protocol.GameMoveMsg:
+			return []interface{}{protocol.OkMsg{Ok: "sunk"}}
+		}
+		return []interface{}{protocol.OpenGamesListMsg{}}
+	})
+	defer c.Close()
+
+	if games, err := c.ListOpenGames(); err != nil || len(games) != 1 || games[0].Username != "gery" {
+		t.Errorf("ListOpenGames: unexpected %v %v", games, err)
+	}
+	if id, err := c.CreateGame(""); err != nil || id != 2 {
+		t.Errorf("CreateGame: unexpected %v %v", id, err)
+	}
+	var errMsg protocol.ErrorMsg
+	if _, err := c.Join(42); !errors.As(err, &errMsg) || errMsg.Code != protocol.GameNotFound {
+		t.Errorf("Join: expected GameNotFound but got %v", err)
+	}
+	if err := c.PlacePiece(game.PatrolBoat, game.Coord{X: 0, Y: 0}, game.Coord{X: 1, Y: 0}); err != nil {
+		t.Errorf("PlacePiece: %v", err)
+	}
+	if result, err := c.Fire(game.Coord{X: 0, Y: 0}); err != nil || result != game.Sunk {
+		t.Errorf("Fire: unexpected %v %v", result, err)
+	}
+	if err := c.Chat("hello"); err == nil {
+		t.Error("Chat: expected an error for an unexpected reply")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c := fakeServer(t, func(msg protocol.BattleMsg) []interface{} {
+		return []interface{}{
+			push{protocol.ChatMessageMsg{Msg: "good luck"}},
+			push{protocol.GameMoveMsg{Player: 1, X: 2, Y: 3}},
+			protocol.OkMsg{},
+			push{protocol.GameOverMsg{Outcome: protocol.OutcomeWon, Reason: protocol.ReasonResignation}},
+			// The server closes the connection
+			nil,
+		}
+	})
+	defer c.Close()
+	if err := c.Chat("hello"); err != nil {
+		t.Fatal(err)
+	}
+	var events []protocol.BattleMsg
+	for event := range c.Events() {
+		events = append(events, event)
+	}
+	if len(events) != 3 || events[0] != (protocol.ChatMessageMsg{Msg: "good luck"}) ||
+		events[2] != (protocol.GameOverMsg{Outcome: protocol.OutcomeWon, Reason: protocol.ReasonResignation}) {
+		t.Errorf("unexpected events %#v", events)
+	}
+	if c.Err() == nil {
+		t.Error("expected an error once the connection is closed")
+	}
+	if _, err := c.ListOpenGames(); err == nil {
+		t.Error("expected requests to fail once the connection is closed")
+	}
+}
+
+func TestGameUpdates(t *testing.T) {
+	snapshot := protocol.GameSnapshotMsg{Seq: 1, Id: 1, P1: "jonfk", P2: "gery",
+		YourGrid: [][]int{{1, 0}, {0, 0}}, OpponentGrid: [][]int{{0, 0}, {0, 0}}}
+	c := fakeServer(t, func(msg protocol.BattleMsg) []interface{} {
+		switch msg.(type) {
+		case protocol.RequestSnapshotMsg:
+			latest := snapshot
+			latest.Seq = 4
+			latest.OpponentGrid = [][]int{{2, 0}, {0, 3}}
+			return []interface{}{latest}
+		}
+		return []interface{}{
+			protocol.OkMsg{},
+			push{snapshot},
+			// The update with sequence number 2 is missing
+			push{protocol.CellChangedMsg{Seq: 3, Player: 1, X: 1, Y: 1, State: 3}},
+			push{protocol.TurnChangedMsg{Seq: 4, Player: 1}},
+		}
+	})
+	defer c.Close()
+	events := make(chan protocol.BattleMsg, 10)
+	c.OnEvent(func(msg protocol.BattleMsg) {
+		events <- msg
+	})
+	if err := c.PlacePiece(game.PatrolBoat, game.Coord{X: 0, Y: 0}, game.Coord{X: 1, Y: 0}); err != nil {
+		t.Fatal(err)
+	}
+	// The snapshot, the updates and the single snapshot requested on the gap
+	for i := 0; i < 4; i++ {
+		select {
+		case <-events:
+		case <-time.After(time.Second):
+			t.Fatal("expected 4 events")
+		}
+	}
+	select {
+	case msg := <-events:
+		t.Errorf("unexpected event %#v, a snapshot was requested twice", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+	replica := c.Game()
+	if replica == nil || replica.Seq != 4 || replica.OpponentGrid[0][0] != 2 || replica.OpponentGrid[1][1] != 3 {
+		t.Errorf("unexpected replica %#v", replica)
+	}
+}
+
+func TestSnapshotRequestFails(t *testing.T) {
+	snapshot := protocol.GameSnapshotMsg{Seq: 1, Id: 1, P1: "jonfk", P2: "gery",
+		YourGrid: [][]int{{1, 0}, {0, 0}}, OpponentGrid: [][]int{{0, 0}, {0, 0}}}
+	requests, failed := 0, make(chan struct{})
+	c := fakeServer(t, func(msg protocol.BattleMsg) []interface{} {
+		switch msg.(type) {
+		case protocol.RequestSnapshotMsg:
+			requests++
+			if requests == 1 {
+				close(failed)
+				return []interface{}{protocol.ErrorMsg{Code: protocol.NotInGame}}
+			}
+			latest := snapshot
+			latest.Seq = 5
+			return []interface{}{latest}
+		case protocol.GameMoveMsg:
+			// The update with sequence number 4 is missing as well
+			return []interface{}{protocol.OkMsg{Ok: "miss"}, push{protocol.TurnChangedMsg{Seq: 5, Player: 1}}}
+		}
+		return []interface{}{
+			protocol.OkMsg{},
+			push{snapshot},
+			push{protocol.CellChangedMsg{Seq: 3, Player: 1, X: 1, Y: 1, State: 3}},
+		}
+	})
+	defer c.Close()
+	if err := c.PlacePiece(game.PatrolBoat, game.Coord{X: 0, Y: 0}, game.Coord{X: 1, Y: 0}); err != nil {
+		t.Fatal(err)
+	}
+	pending := func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.snapshotPending
+	}
+	// Wait for the first snapshot request to fail
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("expected a snapshot request")
+	}
+	for deadline := time.Now().Add(time.Second); pending(); {
+		if time.Now().After(deadline) {
+			t.Fatal("a failed snapshot request should be asked for again on the next gap")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := c.Fire(game.Coord{X: 1, Y: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		if replica := c.Game(); replica != nil && replica.Seq == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected replica %#v", c.Game())
+		}
+	}
+}
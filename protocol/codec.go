@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"encoding/json"
+)
+
+// Names of the codecs announced in the handshake
+const (
+	CodecMsgPack = "msgpack"
+	CodecCBOR    = "cbor"
+)
+
+// Codec encodes message payloads. Every codec names the fields of a message
+// after their json tags so that the same message types work with all of
+// them.
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON is the default codec and the one used during the handshake
+	JSON Codec = jsonCodec{}
+	// MsgPack encodes payloads in MessagePack, see https://msgpack.org
+	MsgPack Codec = msgpackCodec{}
+	// CBOR encodes payloads in CBOR, see RFC 8949
+	CBOR Codec = cborCodec{}
+)
+
+// Codecs lists the supported codecs, the most compact first
+var Codecs = []Codec{MsgPack, CBOR, JSON}
+
+// CodecNames returns the names of the supported codecs in order of preference
+func CodecNames() []string {
+	names := make([]string, len(Codecs))
+	for i, codec := range Codecs {
+		names[i] = codec.Name()
+	}
+	return names
+}
+
+// CodecByName returns the codec with the given name
+func CodecByName(name string) (Codec, bool) {
+	for _, codec := range Codecs {
+		if codec.Name() == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// NegotiatedCodec returns the codec picked in a handshake, JSON if none was
+func NegotiatedCodec(features Features) Codec {
+	if len(features.Codecs) > 0 {
+		if codec, ok := CodecByName(features.Codecs[0]); ok {
+			return codec
+		}
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return CodecMsgPack
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgPack(nil, tree), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	d := &msgpackDecoder{data: data}
+	tree, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return errTrailingData
+	}
+	return fromTree(tree, v)
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string {
+	return CodecCBOR
+}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendCBOR(nil, tree), nil
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	d := &cborDecoder{data: data}
+	tree, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return errTrailingData
+	}
+	return fromTree(tree, v)
+}
@@ -0,0 +1,144 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range Codecs {
+		for _, msg := range testMessages {
+			msgType, payload, err := EncodeMsg(codec, msg)
+			if err != nil {
+				t.Errorf("%v: %T: %v", codec.Name(), msg, err)
+				continue
+			}
+			parsed, err := DecodeMsg(codec, msgType, payload)
+			if err != nil {
+				t.Errorf("%v: %T: %v", codec.Name(), msg, err)
+				continue
+			}
+			if !BattleMsgEquals(parsed, msg) {
+				t.Errorf("%v: parsed message %#v should be the same as original %#v", codec.Name(), parsed, msg)
+			}
+		}
+	}
+}
+
+func TestCodecGolden(t *testing.T) {
+	testCases := []struct {
+		msg     BattleMsg
+		json    string
+		msgpack string
+		cbor    string
+	}{
+		{
+			msg:     GameMoveMsg{Player: 1, X: 2, Y: 3},
+			json:    `{"player":1,"x":2,"y":3}`,
+			msgpack: "83a6706c6179657201a17802a17903",
+			cbor:    "a366706c6179657201617802617903",
+		},
+		{
+			msg:     GameMoveMsg{Player: 0, X: -5, Y: 200},
+			json:    `{"player":0,"x":-5,"y":200}`,
+			msgpack: "83a6706c6179657200a178fba179ccc8",
+			cbor:    "a366706c6179657200617824617918c8",
+		},
+		{
+			msg:     OpenGamesListMsg{Games: []Game{{Id: 300, Username: "a"}}},
+			json:    `{"games":[{"id":300,"username":"a"}]}`,
+			msgpack: "81a567616d65739182a26964cd012ca8757365726e616d65a161",
+			cbor:    "a16567616d657381a262696419012c68757365726e616d656161",
+		},
+		{
+			msg:     OkMsg{},
+			json:    `{}`,
+			msgpack: "80",
+			cbor:    "a0",
+		},
+	}
+	for _, testCase := range testCases {
+		for _, expected := range []struct {
+			codec   Codec
+			payload []byte
+		}{
+			{JSON, []byte(testCase.json)},
+			{MsgPack, mustDecodeHex(t, testCase.msgpack)},
+			{CBOR, mustDecodeHex(t, testCase.cbor)},
+		} {
+			_, payload, err := EncodeMsg(expected.codec, testCase.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(payload, expected.payload) {
+				t.Errorf("%v: %#v should be encoded as %x but got %x", expected.codec.Name(), testCase.msg, expected.payload, payload)
+			}
+		}
+	}
+}
+
+func TestCodecInvalid(t *testing.T) {
+	for _, codec := range []Codec{MsgPack, CBOR} {
+		_, payload, err := EncodeMsg(codec, OpenGamesListMsg{Games: []Game{{Id: 300, Username: "gery"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every truncated payload must fail without panicking, an empty one
+		// is the zero message
+		for n := 1; n < len(payload); n++ {
+			if _, err := DecodeMsg(codec, uint8(OpenGamesList), payload[:n]); err == nil {
+				t.Errorf("%v: expected an error for a payload cut after %d bytes", codec.Name(), n)
+			}
+		}
+		if _, err := DecodeMsg(codec, uint8(OpenGamesList), append(payload, 0)); err == nil {
+			t.Errorf("%v: expected an error for trailing data", codec.Name())
+		}
+	}
+
+	// Huge announced lengths must fail before anything is allocated
+	for _, invalid := range []struct {
+		codec   Codec
+		payload string
+	}{
+		{MsgPack, "dfffffffff"},
+		{MsgPack, "ddffffffff"},
+		{CBOR, "bbffffffffffffffff"},
+		{CBOR, "9bffffffffffffffff"},
+		{CBOR, "7bffffffffffffffff"},
+	} {
+		var msg GameStateMsg
+		if err := invalid.codec.Unmarshal(mustDecodeHex(t, invalid.payload), &msg); err == nil {
+			t.Errorf("%v: expected an error for %v", invalid.codec.Name(), invalid.payload)
+		}
+	}
+}
+
+func TestCodecSize(t *testing.T) {
+	grid := make([][]int, 10)
+	for i := range grid {
+		grid[i] = make([]int, 10)
+	}
+	msg := GameStateMsg{P1: "jonfk", P2: "gery", YourGrid: grid, OpponentGrid: grid}
+	_, jsonPayload, err := EncodeMsg(JSON, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, codec := range []Codec{MsgPack, CBOR} {
+		_, payload, err := EncodeMsg(codec, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payload) >= len(jsonPayload) {
+			t.Errorf("%v: %d bytes is not smaller than %d bytes of JSON", codec.Name(), len(payload), len(jsonPayload))
+		}
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,326 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+ * Binary codecs convert messages to and from a tree of plain values before
+ * encoding it. A tree is made of nil, bool, int64, uint64 (only above
+ * math.MaxInt64), float64, string, []byte, []interface{} and object values.
+ * Struct fields are named after their json tags like encoding/json does.
+ */
+
+// maxTreeDepth bounds the nesting of decoded values
+const maxTreeDepth = 32
+
+var (
+	errTrailingData = errors.New("protocol: trailing data after payload")
+	errTruncated    = errors.New("protocol: truncated payload")
+	errTooDeep      = errors.New("protocol: payload nested too deeply")
+)
+
+// object is a map with string keys that keeps the order of its members
+type object []member
+
+type member struct {
+	Key   string
+	Value interface{}
+}
+
+func toTree(v interface{}) (interface{}, error) {
+	return valueToTree(reflect.ValueOf(v))
+}
+
+func valueToTree(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return valueToTree(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return v.Uint(), nil
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+		fallthrough
+	case reflect.Array:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			item, err := valueToTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("protocol: cannot encode map with %v keys", v.Type().Key())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		obj := make(object, 0, len(keys))
+		for _, key := range keys {
+			value, err := valueToTree(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key.String(), value})
+		}
+		return obj, nil
+	case reflect.Struct:
+		var obj object
+		for _, field := range structFields(v.Type()) {
+			fv := v.Field(field.index)
+			if field.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			value, err := valueToTree(fv)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{field.name, value})
+		}
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("protocol: cannot encode %v", v.Type())
+	}
+}
+
+type fieldInfo struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// structFields returns the exported fields of a struct named after their
+// json tags
+func structFields(t reflect.Type) []fieldInfo {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		info := fieldInfo{name: field.Name, index: i}
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			info.name = parts[0]
+		}
+		for _, option := range parts[1:] {
+			if option == "omitempty" {
+				info.omitEmpty = true
+			}
+		}
+		fields = append(fields, info)
+	}
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func fromTree(tree interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("protocol: cannot decode into %T", v)
+	}
+	return treeToValue(tree, rv.Elem())
+}
+
+func treeToValue(tree interface{}, v reflect.Value) error {
+	if tree == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("protocol: cannot decode %T into %v", tree, v.Type())
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return treeToValue(tree, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch()
+		}
+		v.Set(reflect.ValueOf(plainTree(tree)))
+	case reflect.Bool:
+		b, ok := tree.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := tree.(int64)
+		if !ok {
+			return mismatch()
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("protocol: %d overflows %v", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch tree := tree.(type) {
+		case int64:
+			if tree < 0 {
+				return fmt.Errorf("protocol: %d overflows %v", tree, v.Type())
+			}
+			n = uint64(tree)
+		case uint64:
+			n = tree
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(n) {
+			return fmt.Errorf("protocol: %d overflows %v", n, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch tree := tree.(type) {
+		case float64:
+			v.SetFloat(tree)
+		case int64:
+			v.SetFloat(float64(tree))
+		case uint64:
+			v.SetFloat(float64(tree))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		s, ok := tree.(string)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		if b, ok := tree.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+		list, ok := tree.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := treeToValue(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Array:
+		list, ok := tree.([]interface{})
+		if !ok || len(list) != v.Len() {
+			return mismatch()
+		}
+		for i, item := range list {
+			if err := treeToValue(item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		obj, ok := tree.(object)
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(obj))
+		for _, member := range obj {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := treeToValue(member.Value, value); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(member.Key).Convert(v.Type().Key()), value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		obj, ok := tree.(object)
+		if !ok {
+			return mismatch()
+		}
+		fields := structFields(v.Type())
+		// Unknown members are ignored like encoding/json does
+		for _, member := range obj {
+			for _, field := range fields {
+				if field.name == member.Key {
+					if err := treeToValue(member.Value, v.Field(field.index)); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// plainTree converts objects to maps for values decoded into an interface{}
+func plainTree(tree interface{}) interface{} {
+	switch tree := tree.(type) {
+	case object:
+		m := make(map[string]interface{}, len(tree))
+		for _, member := range tree {
+			m[member.Key] = plainTree(member.Value)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(tree))
+		for i, item := range tree {
+			list[i] = plainTree(item)
+		}
+		return list
+	default:
+		return tree
+	}
+}
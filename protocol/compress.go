@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Names of the compressions announced in the handshake besides
+// CompressionNone
+const (
+	CompressionFlate = "flate"
+)
+
+// DefaultCompressionThreshold is the payload size below which frames are sent
+// uncompressed, compressing them would hardly save anything
+const DefaultCompressionThreshold = 256
+
+// Compression compresses the payload of frames. Compressed frames have the
+// flagCompressed header flag and the length of the compressed payload.
+type Compression interface {
+	Name() string
+	// Compress appends the compressed payload to dst
+	Compress(dst, payload []byte) ([]byte, error)
+	// Decompress fails with ErrFrameTooLarge rather than returning more than
+	// max bytes, compressed payloads can be made to expand enormously
+	Decompress(payload []byte, max int) ([]byte, error)
+}
+
+var (
+	// Flate compresses payloads with raw DEFLATE, see RFC 1951
+	Flate Compression = flateCompression{}
+)
+
+// Compressions lists the supported compressions in order of preference
+var Compressions = []Compression{Flate}
+
+// CompressionNames returns the names of the supported compressions in order
+// of preference, ending with CompressionNone
+func CompressionNames() []string {
+	var names []string
+	for _, compression := range Compressions {
+		names = append(names, compression.Name())
+	}
+	return append(names, CompressionNone)
+}
+
+// CompressionByName returns the compression with the given name
+func CompressionByName(name string) (Compression, bool) {
+	for _, compression := range Compressions {
+		if compression.Name() == name {
+			return compression, true
+		}
+	}
+	return nil, false
+}
+
+// NegotiatedCompression returns the compression picked in a handshake, nil
+// when frames are not compressed
+func NegotiatedCompression(features Features) Compression {
+	if len(features.Compression) > 0 {
+		if compression, ok := CompressionByName(features.Compression[0]); ok {
+			return compression
+		}
+	}
+	return nil
+}
+
+// compressPayload compresses payloads of at least threshold bytes. It returns
+// the payload to send and whether it is compressed, which it is not when
+// compressing would not make it smaller.
+func compressPayload(compression Compression, threshold int, payload []byte) ([]byte, bool, error) {
+	if compression == nil || len(payload) < threshold {
+		return payload, false, nil
+	}
+	compressed, err := compression.Compress(nil, payload)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(compressed) >= len(payload) {
+		return payload, false, nil
+	}
+	return compressed, true, nil
+}
+
+type flateCompression struct{}
+
+// Flate writers allocate large tables, they are reused
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(ioutil.Discard, flate.DefaultCompression)
+		return w
+	},
+}
+
+func (flateCompression) Name() string {
+	return CompressionFlate
+}
+
+func (flateCompression) Compress(dst, payload []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCompression) Decompress(payload []byte, max int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+	// Reading one byte past the limit tells a payload of exactly max bytes
+	// from a larger one
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, fmt.Errorf("flate: %v", err)
+	}
+	if len(data) > max {
+		return nil, fmt.Errorf("%w: the decompressed payload is larger than %d bytes", ErrFrameTooLarge, max)
+	}
+	return data, nil
+}
@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// bigGameState is a board of a large variant, it compresses well
+func bigGameState() GameStateMsg {
+	msg := GameStateMsg{P1: "jonfk", P2: "gery"}
+	for y := 0; y < 50; y++ {
+		msg.YourGrid = append(msg.YourGrid, make([]int, 50))
+		msg.OpponentGrid = append(msg.OpponentGrid, make([]int, 50))
+	}
+	msg.YourGrid[3][4] = 1
+	return msg
+}
+
+func TestCompressedFrames(t *testing.T) {
+	for _, codec := range Codecs {
+		buf := new(bytes.Buffer)
+		writer := NewMsgWriter(buf)
+		writer.SetCodec(codec)
+		writer.SetCompression(Flate)
+		big, small := bigGameState(), ChatMessageMsg{Msg: "hi"}
+		writer.WriteMsgID(3, big)
+		writer.WriteMsg(small)
+
+		_, payload, _ := EncodeMsg(codec, big)
+		header := buf.Bytes()[:4]
+		if header[0]&0x40 == 0 {
+			t.Errorf("%s: frame of a %d bytes payload is not compressed", codec.Name(), len(payload))
+		}
+		if buf.Len() > len(payload)/4 {
+			t.Errorf("%s: compressed frames take %d bytes for a %d bytes payload", codec.Name(), buf.Len(), len(payload))
+		}
+
+		frames := NewFrameReader(bytes.NewReader(buf.Bytes()))
+		frames.Codec = codec
+		if _, err := NewFrameReader(bytes.NewReader(buf.Bytes())).Read(); !errors.Is(err, ErrUnknownFlags) {
+			t.Errorf("%s: expected compressed frames to be rejected without compression but got %v", codec.Name(), err)
+		}
+		frames.Compression = Flate
+		msg, id, err := frames.ReadMsgID()
+		if err != nil || id != 3 || !BattleMsgEquals(msg, big) {
+			t.Errorf("%s: unexpected message %v %v", codec.Name(), id, err)
+		}
+		// Small frames go uncompressed
+		msg, err = frames.ReadMsg()
+		if err != nil || msg != small {
+			t.Errorf("%s: unexpected message %#v %v", codec.Name(), msg, err)
+		}
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	supported := Features{Variants: []string{VariantStandard}, Codecs: CodecNames(), Compression: CompressionNames()}
+	welcome, err := Negotiate(HelloMsg{Version: 2, Features: Features{Compression: []string{"zstd", CompressionFlate}}}, supported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NegotiatedCompression(welcome.Features) != Flate {
+		t.Errorf("expected flate but got %v", welcome.Features.Compression)
+	}
+	welcome, err = Negotiate(HelloMsg{Version: 2}, supported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NegotiatedCompression(welcome.Features) != nil {
+		t.Errorf("clients not asking for compression should not get any, got %v", welcome.Features.Compression)
+	}
+}
+
+// bomb is a compressed frame expanding to size bytes
+func bomb(t testing.TB, size int) []byte {
+	compressed, err := Flate.Compress(nil, make([]byte, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return appendFrame(nil, Frame{Type: uint8(ChatMessage), Payload: compressed}, true)
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	frame := bomb(t, 64<<20)
+	if len(frame) > 1<<20 {
+		t.Fatalf("the bomb should fit in a frame, it takes %d bytes", len(frame))
+	}
+	frames := NewFrameReader(bytes.NewReader(frame))
+	frames.Compression = Flate
+	if _, err := frames.Read(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge but got %v", err)
+	}
+
+	// A payload of exactly the maximum size is accepted
+	frames = NewFrameReader(bytes.NewReader(bomb(t, 1000)))
+	frames.Compression, frames.MaxPayloadSize = Flate, 1000
+	if frame, err := frames.Read(); err != nil || len(frame.Payload) != 1000 {
+		t.Errorf("expected a 1000 bytes payload but got %d bytes and %v", len(frame.Payload), err)
+	}
+}
+
+func FuzzCompressedFrames(f *testing.F) {
+	f.Add(bomb(f, 64<<10))
+	f.Add(bomb(f, 10))
+	compressed, _ := Flate.Compress(nil, []byte(`{"msg": "hello hello hello hello"}`))
+	f.Add(appendFrame(nil, Frame{Type: uint8(ChatMessage), RequestID: 7, Payload: compressed}, true))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		const max = 4096
+		frames := NewFrameReader(bytes.NewReader(data))
+		frames.Compression, frames.MaxPayloadSize = Flate, max
+		for {
+			frame, err := frames.Read()
+			if err != nil {
+				return
+			}
+			if len(frame.Payload) > max {
+				t.Fatalf("read a %d bytes payload, the limit is %d", len(frame.Payload), max)
+			}
+		}
+	})
+}
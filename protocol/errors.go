@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jonfk/battleship/game"
+)
+
+// ErrorCode tells clients why a request failed. Codes are part of the
+// protocol, new codes are only ever added at the end.
+type ErrorCode int
+
+const (
+	UnknownError ErrorCode = iota
+	InvalidMessage
+	HandshakeFailed
+	NotConnected
+	UsernameTaken
+	GameNotFound
+	NotInGame
+	InvalidPlayer
+	InvalidPiece
+	InvalidCoordinate
+	InvalidPlacement
+	InvalidRules
+	NotYourTurn
+	AlreadyFired
+	GameFinished
+	NoRevealsLeft
+	NoDrawOffer
+	GameNotStarted
+)
+
+// gameErrorCodes maps the errors of the game package to their code
+var gameErrorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{game.ErrInvalidPlayer, InvalidPlayer},
+	{game.ErrInvalidPiece, InvalidPiece},
+	{game.ErrInvalidCoord, InvalidCoordinate},
+	{game.ErrInvalidPlacement, InvalidPlacement},
+	{game.ErrInvalidRules, InvalidRules},
+	{game.ErrNotYourTurn, NotYourTurn},
+	{game.ErrAlreadyFired, AlreadyFired},
+	{game.ErrGameOver, GameFinished},
+	{game.ErrNoRevealsLeft, NoRevealsLeft},
+	{game.ErrNoDrawOffer, NoDrawOffer},
+}
+
+// NewErrorMsg creates the message reporting err. Errors of the game package
+// get their own code, other errors are reported as UnknownError unless they
+// already are an ErrorMsg.
+func NewErrorMsg(err error) ErrorMsg {
+	var msg ErrorMsg
+	if errors.As(err, &msg) {
+		return msg
+	}
+	return ErrorMsg{Code: ErrorCodeOf(err), Message: err.Error()}
+}
+
+// ErrorCodeOf returns the code of an error of the game package
+func ErrorCodeOf(err error) ErrorCode {
+	for _, known := range gameErrorCodes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	return UnknownError
+}
+
+// Error makes an ErrorMsg received in reply to a request usable as an error
+func (m ErrorMsg) Error() string {
+	return fmt.Sprintf("%v: %v", m.Code, m.Message)
+}
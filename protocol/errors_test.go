@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jonfk/battleship/game"
+)
+
+func TestNewErrorMsg(t *testing.T) {
+	g := game.NewGame(10, 10)
+	testCases := []struct {
+		err  error
+		code ErrorCode
+	}{
+		{g.Move(game.Player2, game.Coord{X: 1, Y: 1}), NotYourTurn},
+		{g.Move(game.Player1, game.Coord{X: 10, Y: 1}), InvalidCoordinate},
+		{fmt.Errorf("join: %w", game.ErrGameOver), GameFinished},
+		{ErrorMsg{Code: UsernameTaken, Message: "jonfk is taken"}, UsernameTaken},
+		{errors.New("disk full"), UnknownError},
+	}
+	for i, testCase := range testCases {
+		msg := NewErrorMsg(testCase.err)
+		if msg.Code != testCase.code || msg.Message == "" {
+			t.Errorf("case %d: expected %v for %v but got %#v", i, testCase.code, testCase.err, msg)
+		}
+	}
+}
+
+func TestErrorMsgWire(t *testing.T) {
+	_, payload, err := Msg2Raw(ErrorMsg{Code: AlreadyFired, Message: "B2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"code":13,"error":"B2"}`; string(payload) != expected {
+		t.Errorf("expected %s but got %s", expected, payload)
+	}
+}
@@ -0,0 +1,260 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+/*
+ * Framing
+ *
+ * Every message is sent as a frame made of a 4 byte big endian header word, a
+ * 1 byte message type, an optional 4 byte big endian request ID and the
+ * payload. The low 24 bits of the header word are the payload length and the
+ * high 8 bits are flags. The length of a compressed payload is its length
+ * once compressed.
+ */
+
+const (
+	frameHeaderSize = 5
+	requestIDSize   = 4
+
+	// flagRequestID is set when a request ID follows the message type
+	flagRequestID = 1 << 31
+	// flagCompressed is set when the payload is compressed with the
+	// compression negotiated in the handshake
+	flagCompressed = 1 << 30
+	flagsMask      = 0xff000000
+	lengthMask     = 0x00ffffff
+)
+
+// DefaultMaxPayloadSize is the largest payload accepted unless configured
+// otherwise. It is far larger than any message of a standard game.
+const DefaultMaxPayloadSize = 1 << 20
+
+// MaxPayloadSize is the largest payload the header can describe
+const MaxPayloadSize = lengthMask
+
+var (
+	// ErrFrameTooLarge is returned when a frame's payload is larger than the
+	// maximum payload size
+	ErrFrameTooLarge = errors.New("protocol: frame too large")
+	// ErrUnexpectedEOF is returned when the stream ends in the middle of a
+	// frame
+	ErrUnexpectedEOF = errors.New("protocol: unexpected EOF in frame")
+	// ErrUnknownFlags is returned when a frame header has flags this
+	// package does not know
+	ErrUnknownFlags = errors.New("protocol: unknown frame flags")
+)
+
+// Frame is a message type and its encoded payload
+type Frame struct {
+	Type uint8
+	// RequestID is set by clients that want to match a reply to its
+	// request. It is zero when unset and replies carry the ID of their
+	// request.
+	RequestID uint32
+	Payload   []byte
+}
+
+// FrameReader reads frames from an io.Reader. It only reads the bytes of one
+// frame at a time so the reader can be handed over after any frame.
+type FrameReader struct {
+	r io.Reader
+	// MaxPayloadSize is the largest payload accepted, frames announcing a
+	// larger payload fail with ErrFrameTooLarge before it is read
+	MaxPayloadSize int
+	// Codec decodes the payloads read by ReadMsg, JSON when nil
+	Codec Codec
+	// Compression decompresses compressed frames, which are rejected when
+	// it is nil. The decompressed payloads are limited to MaxPayloadSize.
+	Compression Compression
+	header      [frameHeaderSize + requestIDSize]byte
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: r, MaxPayloadSize: DefaultMaxPayloadSize}
+}
+
+// Read reads the next frame. It returns io.EOF if the stream ends cleanly
+// before the frame and ErrUnexpectedEOF if it ends within it.
+func (fr *FrameReader) Read() (Frame, error) {
+	var frame Frame
+	err := fr.readFull(fr.header[:frameHeaderSize], true)
+	if err != nil {
+		return frame, err
+	}
+	word := binary.BigEndian.Uint32(fr.header[:4])
+	if word&flagsMask&^(flagRequestID|flagCompressed) != 0 {
+		return frame, fmt.Errorf("%w: %#x", ErrUnknownFlags, word&flagsMask)
+	}
+	compressed := word&flagCompressed != 0
+	if compressed && fr.Compression == nil {
+		return frame, fmt.Errorf("%w: compressed frame without a negotiated compression", ErrUnknownFlags)
+	}
+	size := word & lengthMask
+	if uint64(size) > uint64(fr.MaxPayloadSize) {
+		return frame, fmt.Errorf("%w: %d bytes, the limit is %d", ErrFrameTooLarge, size, fr.MaxPayloadSize)
+	}
+	frame.Type = fr.header[4]
+	if word&flagRequestID != 0 {
+		err := fr.readFull(fr.header[frameHeaderSize:], false)
+		if err != nil {
+			return frame, err
+		}
+		frame.RequestID = binary.BigEndian.Uint32(fr.header[frameHeaderSize:])
+	}
+
+	frame.Payload = make([]byte, size)
+	err = fr.readFull(frame.Payload, false)
+	if err != nil || !compressed {
+		return frame, err
+	}
+	frame.Payload, err = fr.Compression.Decompress(frame.Payload, fr.MaxPayloadSize)
+	return frame, err
+}
+
+// readFull reads len(buf) bytes. An EOF is only returned as is at the start
+// of a frame.
+func (fr *FrameReader) readFull(buf []byte, start bool) error {
+	_, err := io.ReadFull(fr.r, buf)
+	if err == io.ErrUnexpectedEOF || err == io.EOF && !start {
+		return ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadFrame reads the next frame's type and payload
+func (fr *FrameReader) ReadFrame() (uint8, []byte, error) {
+	frame, err := fr.Read()
+	return frame.Type, frame.Payload, err
+}
+
+// ReadMsg reads and decodes the next message
+func (fr *FrameReader) ReadMsg() (BattleMsg, error) {
+	msg, _, err := fr.ReadMsgID()
+	return msg, err
+}
+
+// ReadMsgID reads and decodes the next message along with its request ID
+func (fr *FrameReader) ReadMsgID() (BattleMsg, uint32, error) {
+	frame, err := fr.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	msg, err := DecodeMsg(orJSON(fr.Codec), frame.Type, frame.Payload)
+	return msg, frame.RequestID, err
+}
+
+// FrameWriter writes frames to an io.Writer. Every frame is sent with a
+// single call to Write. A FrameWriter is not safe for concurrent use, see
+// MsgWriter.
+type FrameWriter struct {
+	w io.Writer
+	// MaxPayloadSize is the largest payload written, larger frames fail with
+	// ErrFrameTooLarge so that the peer is not sent a frame it rejects
+	MaxPayloadSize int
+	// Codec encodes the messages written by WriteMsg, JSON when nil
+	Codec Codec
+	// Compression compresses the payloads of at least
+	// CompressionThreshold bytes when set
+	Compression          Compression
+	CompressionThreshold int
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w, MaxPayloadSize: DefaultMaxPayloadSize, CompressionThreshold: DefaultCompressionThreshold}
+}
+
+func (fw *FrameWriter) Write(frame Frame) error {
+	err := checkSize(frame, fw.MaxPayloadSize)
+	if err != nil {
+		return err
+	}
+	payload, compressed, err := compressPayload(fw.Compression, fw.CompressionThreshold, frame.Payload)
+	if err != nil {
+		return err
+	}
+	frame.Payload = payload
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = appendFrame(*buf, frame, compressed)
+	_, err = fw.w.Write(*buf)
+	return err
+}
+
+func (fw *FrameWriter) WriteFrame(msgType uint8, payload []byte) error {
+	return fw.Write(Frame{Type: msgType, Payload: payload})
+}
+
+// WriteMsg encodes and writes a message
+func (fw *FrameWriter) WriteMsg(message BattleMsg) error {
+	return fw.WriteMsgID(0, message)
+}
+
+// WriteMsgID encodes and writes a message with a request ID
+func (fw *FrameWriter) WriteMsgID(requestID uint32, message BattleMsg) error {
+	msgType, payload, err := EncodeMsg(orJSON(fw.Codec), message)
+	if err != nil {
+		return err
+	}
+	return fw.Write(Frame{Type: msgType, RequestID: requestID, Payload: payload})
+}
+
+func orJSON(codec Codec) Codec {
+	if codec == nil {
+		return JSON
+	}
+	return codec
+}
+
+func checkSize(frame Frame, max int) error {
+	if len(frame.Payload) > max || len(frame.Payload) > MaxPayloadSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrFrameTooLarge, len(frame.Payload), max)
+	}
+	return nil
+}
+
+func appendFrame(buf []byte, frame Frame, compressed bool) []byte {
+	var header [frameHeaderSize + requestIDSize]byte
+	word := uint32(len(frame.Payload))
+	if compressed {
+		word |= flagCompressed
+	}
+	n := frameHeaderSize
+	if frame.RequestID != 0 {
+		word |= flagRequestID
+		binary.BigEndian.PutUint32(header[frameHeaderSize:], frame.RequestID)
+		n += requestIDSize
+	}
+	binary.BigEndian.PutUint32(header[:4], word)
+	header[4] = frame.Type
+	buf = append(buf, header[:n]...)
+	return append(buf, frame.Payload...)
+}
+
+// maxPooledBuffer is the capacity above which buffers are not kept in the
+// pool so that a single huge message does not pin its memory
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func putBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
+}
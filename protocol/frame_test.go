@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	messages := []BattleMsg{
+		PingMsg{},
+		ConnectMsg{Username: "jonfk"},
+		GameMoveMsg{Player: 1, X: 3, Y: 4},
+		OpenGamesListMsg{Games: []Game{{Id: 1, Username: "gery"}}},
+	}
+	buf := new(bytes.Buffer)
+	for _, msg := range messages {
+		if err := WriteMsg(buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reading one byte at a time checks that short reads keep the framing
+	fr := NewFrameReader(iotest.OneByteReader(buf))
+	for _, msg := range messages {
+		parsed, err := fr.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !BattleMsgEquals(parsed, msg) {
+			t.Errorf("parsed message %#v should be the same as original %#v", parsed, msg)
+		}
+	}
+	if _, err := fr.ReadMsg(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last frame but got %v", err)
+	}
+}
+
+func TestFramePipe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	msg := ChatMessageMsg{Msg: "hello"}
+	go WriteMsg(client, msg)
+	parsed, err := ReadMsg(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !BattleMsgEquals(parsed, msg) {
+		t.Errorf("parsed message %#v should be the same as original %#v", parsed, msg)
+	}
+}
+
+func TestFrameRequestID(t *testing.T) {
+	buf := new(bytes.Buffer)
+	fw := NewFrameWriter(buf)
+	if err := fw.WriteMsgID(42, JoinGameMsg{Id: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WriteMsg(PingMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	// The request ID makes the first frame 4 bytes longer
+	if buf.Len() != 2*frameHeaderSize+requestIDSize+len(`{"id":7}`) {
+		t.Errorf("unexpected frames length %d", buf.Len())
+	}
+
+	fr := NewFrameReader(iotest.OneByteReader(buf))
+	for _, expected := range []struct {
+		msg BattleMsg
+		id  uint32
+	}{{JoinGameMsg{Id: 7}, 42}, {PingMsg{}, 0}} {
+		msg, id, err := fr.ReadMsgID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != expected.id || !BattleMsgEquals(msg, expected.msg) {
+			t.Errorf("expected %#v with request ID %d but got %#v with %d", expected.msg, expected.id, msg, id)
+		}
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := NewFrameWriter(buf).WriteFrame(uint8(ChatMessage), []byte(`{"msg":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	for _, n := range []int{1, 4, 5, len(frame) - 1} {
+		_, _, err := NewFrameReader(bytes.NewReader(frame[:n])).ReadFrame()
+		if err != ErrUnexpectedEOF {
+			t.Errorf("expected ErrUnexpectedEOF for a frame cut after %d bytes but got %v", n, err)
+		}
+	}
+
+	fr := NewFrameReader(bytes.NewReader(frame))
+	fr.MaxPayloadSize = 4
+	if _, _, err := fr.ReadFrame(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge but got %v", err)
+	}
+
+	// A huge announced length must fail before anything is allocated
+	huge := []byte{0x00, 0xff, 0xff, 0xff, uint8(ChatMessage)}
+	if _, _, err := NewFrameReader(bytes.NewReader(huge)).ReadFrame(); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge but got %v", err)
+	}
+	flags := []byte{0x01, 0x00, 0x00, 0x00, uint8(Ping)}
+	if _, _, err := NewFrameReader(bytes.NewReader(flags)).ReadFrame(); !errors.Is(err, ErrUnknownFlags) {
+		t.Errorf("expected ErrUnknownFlags but got %v", err)
+	}
+
+	fw := NewFrameWriter(new(bytes.Buffer))
+	fw.MaxPayloadSize = 4
+	if err := fw.WriteMsg(ChatMessageMsg{Msg: "hello"}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge when writing but got %v", err)
+	}
+}
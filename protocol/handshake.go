@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+// ProtocolVersion is the newest version of the protocol spoken by this
+// package. Version 1 is the original protocol where clients start with a
+// ConnectMsg and every payload is JSON. Version 3 clients receive game
+// updates instead of full game states. Version 4 peers ping each other and
+// answer pings with a PongMsg.
+const (
+	ProtocolVersion    = 4
+	MinProtocolVersion = 1
+	// UpdatesVersion is the first version receiving game updates
+	UpdatesVersion = 3
+	// KeepaliveVersion is the first version answering pings with a PongMsg
+	KeepaliveVersion = 4
+)
+
+// Names of the features announced in the handshake
+const (
+	CodecJSON       = "json"
+	CompressionNone = "none"
+
+	VariantStandard = "standard"
+	VariantHandicap = "handicap"
+)
+
+// Features lists what a peer supports. A client lists its preferred codec
+// and compression first. Empty lists mean JSON without compression and the
+// standard variant.
+type Features struct {
+	Variants    []string `json:"variants,omitempty"`
+	Codecs      []string `json:"codecs,omitempty"`
+	Compression []string `json:"compression,omitempty"`
+	Weapons     []string `json:"weapons,omitempty"`
+}
+
+// LegacyFeatures are the features of a version 1 connection
+func LegacyFeatures() Features {
+	return Features{
+		Variants:    []string{VariantStandard},
+		Codecs:      []string{CodecJSON},
+		Compression: []string{CompressionNone},
+	}
+}
+
+func (features Features) Equal(other Features) bool {
+	return equalStrings(features.Variants, other.Variants) &&
+		equalStrings(features.Codecs, other.Codecs) &&
+		equalStrings(features.Compression, other.Compression) &&
+		equalStrings(features.Weapons, other.Weapons)
+}
+
+// Negotiate picks the version and features of a connection from the client's
+// hello and the features supported by the server. The codec and compression
+// are the first of the client's choices the server supports while variants
+// and weapons are those supported by both.
+func Negotiate(hello HelloMsg, supported Features) (WelcomeMsg, error) {
+	var welcome WelcomeMsg
+	if hello.Version < MinProtocolVersion {
+		return welcome, fmt.Errorf("Negotiate: protocol version %d is not supported, the server speaks versions %d to %d",
+			hello.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	welcome.Version = hello.Version
+	if welcome.Version > ProtocolVersion {
+		welcome.Version = ProtocolVersion
+	}
+
+	codec, ok := pickFirst(orDefault(hello.Features.Codecs, CodecJSON), supported.Codecs)
+	if !ok {
+		return welcome, fmt.Errorf("Negotiate: none of the codecs %v is supported, the server supports %v",
+			hello.Features.Codecs, supported.Codecs)
+	}
+	compression, ok := pickFirst(orDefault(hello.Features.Compression, CompressionNone), supported.Compression)
+	if !ok {
+		return welcome, fmt.Errorf("Negotiate: none of the compressions %v is supported, the server supports %v",
+			hello.Features.Compression, supported.Compression)
+	}
+	variants := intersect(orDefault(hello.Features.Variants, VariantStandard), supported.Variants)
+	if len(variants) == 0 {
+		return welcome, fmt.Errorf("Negotiate: none of the variants %v is supported, the server supports %v",
+			hello.Features.Variants, supported.Variants)
+	}
+	welcome.Features = Features{
+		Variants:    variants,
+		Codecs:      []string{codec},
+		Compression: []string{compression},
+		Weapons:     intersect(hello.Features.Weapons, supported.Weapons),
+	}
+	return welcome, nil
+}
+
+func orDefault(values []string, value string) []string {
+	if len(values) == 0 {
+		return []string{value}
+	}
+	return values
+}
+
+// pickFirst returns the first of the wanted values that is supported
+func pickFirst(wanted, supported []string) (string, bool) {
+	for _, value := range wanted {
+		if contains(supported, value) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func intersect(wanted, supported []string) []string {
+	var values []string
+	for _, value := range wanted {
+		if contains(supported, value) && !contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, other := range values {
+		if other == value {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	server := Features{
+		Variants:    []string{VariantStandard, VariantHandicap},
+		Codecs:      []string{CodecJSON},
+		Compression: []string{CompressionNone},
+	}
+	testCases := []struct {
+		hello    HelloMsg
+		expected WelcomeMsg
+		ok       bool
+	}{
+		{
+			hello: HelloMsg{Version: ProtocolVersion},
+			expected: WelcomeMsg{Version: ProtocolVersion, Features: Features{
+				Variants: []string{VariantStandard}, Codecs: []string{CodecJSON}, Compression: []string{CompressionNone},
+			}},
+			ok: true,
+		},
+		{
+			// Newer clients fall back to the server's version and the
+			// features both sides know
+			hello: HelloMsg{Version: ProtocolVersion + 3, Features: Features{
+				Variants:    []string{"salvo", VariantHandicap, VariantStandard},
+				Codecs:      []string{"msgpack", CodecJSON},
+				Compression: []string{"flate", CompressionNone},
+				Weapons:     []string{"torpedo"},
+			}},
+			expected: WelcomeMsg{Version: ProtocolVersion, Features: Features{
+				Variants: []string{VariantHandicap, VariantStandard}, Codecs: []string{CodecJSON}, Compression: []string{CompressionNone},
+			}},
+			ok: true,
+		},
+		{hello: HelloMsg{Version: 0}},
+		{hello: HelloMsg{Version: ProtocolVersion, Features: Features{Codecs: []string{"msgpack"}}}},
+		{hello: HelloMsg{Version: ProtocolVersion, Features: Features{Compression: []string{"zstd"}}}},
+		{hello: HelloMsg{Version: ProtocolVersion, Features: Features{Variants: []string{"salvo"}}}},
+	}
+	for i, testCase := range testCases {
+		welcome, err := Negotiate(testCase.hello, server)
+		if (err == nil) != testCase.ok {
+			t.Errorf("case %d: expected ok to be %v but got error %v", i, testCase.ok, err)
+			continue
+		}
+		if testCase.ok && !BattleMsgEquals(welcome, testCase.expected) {
+			t.Errorf("case %d: expected %#v but got %#v", i, testCase.expected, welcome)
+		}
+	}
+}
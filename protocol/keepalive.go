@@ -0,0 +1,135 @@
+package protocol
+
+import (
+	"sync"
+	"time"
+)
+
+// Default keepalive settings
+const (
+	DefaultPingInterval = 15 * time.Second
+	DefaultPingTimeout  = 45 * time.Second
+)
+
+// DeadlineSetter is implemented by connections supporting read deadlines,
+// such as net.Conn
+type DeadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// Keepalive detects dead peers. Once started it sends a PingMsg every
+// interval and keeps a read deadline on the connection so that reading a
+// connection silent for longer than timeout fails. The goroutine reading the
+// connection must pass every message it reads to Received, and Stop must be
+// called once the connection is closed.
+type Keepalive struct {
+	conn     DeadlineSetter
+	writer   *MsgWriter
+	interval time.Duration
+	timeout  time.Duration
+	// pong asks for a PongMsg to be sent, the reader never waits on writes
+	pong chan struct{}
+
+	mu      sync.Mutex
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func NewKeepalive(conn DeadlineSetter, writer *MsgWriter, interval, timeout time.Duration) *Keepalive {
+	k := &Keepalive{
+		conn:     conn,
+		writer:   writer,
+		interval: interval,
+		timeout:  timeout,
+		pong:     make(chan struct{}, 1),
+		started:  make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go k.run()
+	return k
+}
+
+// Start sets the first read deadline and starts sending pings. Pings are
+// answered before Start is called, which lets a client answer them while
+// waiting for the handshake to complete.
+func (k *Keepalive) Start() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if isClosed(k.started) || isClosed(k.stopped) {
+		return
+	}
+	k.conn.SetReadDeadline(time.Now().Add(k.timeout))
+	close(k.started)
+}
+
+func (k *Keepalive) run() {
+	var (
+		started = k.started
+		pings   <-chan time.Time
+	)
+	for {
+		var err error
+		select {
+		case <-started:
+			ticker := time.NewTicker(k.interval)
+			defer ticker.Stop()
+			started, pings = nil, ticker.C
+		case <-pings:
+			err = k.writer.WriteMsg(PingMsg{})
+		case <-k.pong:
+			err = k.writer.WriteMsg(PongMsg{})
+		case <-k.stopped:
+			return
+		}
+		// A failed write means the connection is gone, the reader finds
+		// out on its own
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Received extends the read deadline and answers pings with a PongMsg. It
+// returns true when msg was a ping or a pong, which are not meant for the
+// rest of the application.
+func (k *Keepalive) Received(msg BattleMsg) bool {
+	k.mu.Lock()
+	if isClosed(k.started) && !isClosed(k.stopped) {
+		k.conn.SetReadDeadline(time.Now().Add(k.timeout))
+	}
+	k.mu.Unlock()
+	switch msg.(type) {
+	case PingMsg:
+		select {
+		case k.pong <- struct{}{}:
+		default:
+			// A pong is already on its way
+		}
+		return true
+	case PongMsg:
+		return true
+	}
+	return false
+}
+
+// Stop stops sending pings and removes the read deadline
+func (k *Keepalive) Stop() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if isClosed(k.stopped) {
+		return
+	}
+	close(k.stopped)
+	if isClosed(k.started) {
+		k.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// readWithKeepalive reads the connection until an error, passing every
+// message to the keepalive and the others to msgs
+func readWithKeepalive(conn net.Conn, k *Keepalive, msgs chan<- BattleMsg) error {
+	frames := NewFrameReader(conn)
+	for {
+		msg, err := frames.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if !k.Received(msg) {
+			msgs <- msg
+		}
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	const interval, timeout = 10 * time.Millisecond, 50 * time.Millisecond
+
+	ka := NewKeepalive(a, NewMsgWriter(a), interval, timeout)
+	kb := NewKeepalive(b, NewMsgWriter(b), interval, timeout)
+	msgs := make(chan BattleMsg, 10)
+	errA, errB := make(chan error, 1), make(chan error, 1)
+	silent := make(chan struct{})
+	go func() { errA <- readWithKeepalive(a, ka, msgs) }()
+	go func() {
+		frames := NewFrameReader(b)
+		for {
+			msg, err := frames.ReadMsg()
+			if err != nil {
+				errB <- err
+				return
+			}
+			select {
+			case <-silent:
+				// Stop reading and answering like a hung peer
+				return
+			default:
+			}
+			if !kb.Received(msg) {
+				msgs <- msg
+			}
+		}
+	}()
+	ka.Start()
+	kb.Start()
+
+	// Both peers are alive, pings keep the connection open past the timeout
+	select {
+	case err := <-errA:
+		t.Fatalf("connection closed while both peers were alive: %v", err)
+	case err := <-errB:
+		t.Fatalf("connection closed while both peers were alive: %v", err)
+	case msg := <-msgs:
+		t.Fatalf("keepalive message %#v was not filtered out", msg)
+	case <-time.After(5 * timeout):
+	}
+
+	// A peer going silent is detected
+	close(silent)
+	kb.Stop()
+	select {
+	case err := <-errA:
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+	case <-time.After(10 * timeout):
+		t.Fatal("silent peer was not detected")
+	}
+	// Stopping twice is harmless
+	kb.Stop()
+	ka.Stop()
+}
+
+func TestKeepaliveReceived(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	k := NewKeepalive(a, NewMsgWriter(a), time.Hour, time.Hour)
+	defer k.Stop()
+
+	replies := make(chan BattleMsg, 1)
+	go func() {
+		msg, err := NewFrameReader(b).ReadMsg()
+		if err == nil {
+			replies <- msg
+		}
+	}()
+	// Pings are answered before the keepalive is started
+	if !k.Received(PingMsg{}) {
+		t.Error("Received(PingMsg) should return true")
+	}
+	select {
+	case msg := <-replies:
+		if _, ok := msg.(PongMsg); !ok {
+			t.Errorf("expected a PongMsg, got %#v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ping was not answered")
+	}
+	if !k.Received(PongMsg{}) {
+		t.Error("Received(PongMsg) should return true")
+	}
+	if k.Received(ChatMessageMsg{Msg: "hi"}) {
+		t.Error("Received(ChatMessageMsg) should return false")
+	}
+}
@@ -0,0 +1,284 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+/*
+ * MessagePack encoding of value trees, see
+ * https://github.com/msgpack/msgpack/blob/master/spec.md
+ */
+
+func appendMsgPack(buf []byte, tree interface{}) []byte {
+	switch tree := tree.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if tree {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case int64:
+		return appendMsgPackInt(buf, tree)
+	case uint64:
+		return appendUint64(append(buf, 0xcf), tree)
+	case float64:
+		return appendUint64(append(buf, 0xcb), math.Float64bits(tree))
+	case string:
+		n := len(tree)
+		switch {
+		case n < 32:
+			buf = append(buf, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			buf = appendUint16(append(buf, 0xda), uint16(n))
+		default:
+			buf = appendUint32(append(buf, 0xdb), uint32(n))
+		}
+		return append(buf, tree...)
+	case []byte:
+		n := len(tree)
+		switch {
+		case n <= math.MaxUint8:
+			buf = append(buf, 0xc4, byte(n))
+		case n <= math.MaxUint16:
+			buf = appendUint16(append(buf, 0xc5), uint16(n))
+		default:
+			buf = appendUint32(append(buf, 0xc6), uint32(n))
+		}
+		return append(buf, tree...)
+	case []interface{}:
+		buf = appendMsgPackLength(buf, len(tree), 0x90, 0xdc)
+		for _, item := range tree {
+			buf = appendMsgPack(buf, item)
+		}
+		return buf
+	case object:
+		buf = appendMsgPackLength(buf, len(tree), 0x80, 0xde)
+		for _, member := range tree {
+			buf = appendMsgPack(buf, member.Key)
+			buf = appendMsgPack(buf, member.Value)
+		}
+		return buf
+	default:
+		panic(fmt.Sprintf("protocol: unexpected %T in value tree", tree))
+	}
+}
+
+func appendMsgPackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= math.MaxInt8:
+		return append(buf, byte(n))
+	case n < 0 && n >= -32:
+		return append(buf, byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		return append(buf, 0xcc, byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return appendUint16(append(buf, 0xcd), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return appendUint32(append(buf, 0xce), uint32(n))
+	case n >= 0:
+		return appendUint64(append(buf, 0xcf), uint64(n))
+	case n >= math.MinInt8:
+		return append(buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return appendUint16(append(buf, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return appendUint32(append(buf, 0xd2), uint32(n))
+	default:
+		return appendUint64(append(buf, 0xd3), uint64(n))
+	}
+}
+
+// appendMsgPackLength writes the header of an array or a map, fix is the
+// header of the short form and long the header of the 16 bit form
+func appendMsgPackLength(buf []byte, n int, fix, long byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(buf, long), uint16(n))
+	default:
+		return appendUint32(append(buf, long+1), uint32(n))
+	}
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxTreeDepth {
+		return nil, errTooDeep
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.object(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.list(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil || n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), nil
+	case 0xd0:
+		n, err := d.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.list(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(int(n), depth)
+	default:
+		return nil, fmt.Errorf("protocol: unsupported MessagePack type %#x", c)
+	}
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) list(n int, depth int) (interface{}, error) {
+	// Every item takes at least a byte, which bounds the allocation
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	list := make([]interface{}, n)
+	for i := range list {
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = item
+	}
+	return list, nil
+}
+
+func (d *msgpackDecoder) object(n int, depth int) (interface{}, error) {
+	if n > (len(d.data)-d.pos)/2 {
+		return nil, errTruncated
+	}
+	obj := make(object, n)
+	for i := range obj {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("protocol: MessagePack map key %v is not a string", key)
+		}
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj[i] = member{s, value}
+	}
+	return obj, nil
+}
+
+func appendUint16(buf []byte, n uint16) []byte {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], n)
+	return append(buf, b[:]...)
+}
+
+func appendUint32(buf []byte, n uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	return append(buf, b[:]...)
+}
+
+func appendUint64(buf []byte, n uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	return append(buf, b[:]...)
+}
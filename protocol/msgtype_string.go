@@ -4,13 +4,24 @@ package protocol
 
 import "fmt"
 
-const _MsgType_name = "PingConnectConnectionReplyRequestOpenGamesListSendOpenGamesListCreateGameJoinGameGamePreGameStatusAcceptGameRejectGameGameStateGameSetPieceGameMoveAbandonGameChatMessageGenericResultGameWonGameLost"
+const (
+	_MsgType_name_0 = "PingOkErrorGameMoveChatMessageConnectRequestOpenGamesListCreateGameJoinGameAcceptGameRejectGameGameSetPieceRequestGameStateAbandonGameOpenGamesListGamePreGameStatusGameState"
+	_MsgType_name_1 = "GameOverOfferDrawAcceptDrawHelloWelcomePongPlayerJoinedCellChangedShipSunkTurnChangedGameSnapshotRequestSnapshot"
+)
 
-var _MsgType_index = [...]uint8{0, 4, 11, 26, 46, 63, 73, 81, 98, 108, 118, 127, 139, 147, 158, 169, 182, 189, 197}
+var (
+	_MsgType_index_0 = [...]uint8{0, 4, 6, 11, 19, 30, 37, 57, 67, 75, 85, 95, 107, 123, 134, 147, 164, 173}
+	_MsgType_index_1 = [...]uint8{0, 8, 17, 27, 32, 39, 43, 55, 66, 74, 85, 97, 112}
+)
 
 func (i MsgType) String() string {
-	if i >= MsgType(len(_MsgType_index)-1) {
+	switch {
+	case i <= 16:
+		return _MsgType_name_0[_MsgType_index_0[i]:_MsgType_index_0[i+1]]
+	case 19 <= i && i <= 30:
+		i -= 19
+		return _MsgType_name_1[_MsgType_index_1[i]:_MsgType_index_1[i+1]]
+	default:
 		return fmt.Sprintf("MsgType(%d)", i)
 	}
-	return _MsgType_name[_MsgType_index[i]:_MsgType_index[i+1]]
 }
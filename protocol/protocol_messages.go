@@ -1,4 +1,5 @@
 //go:generate stringer -type=MsgType
+//go:generate stringer -type=ErrorCode
 package protocol
 
 import ()
@@ -26,14 +27,37 @@ const (
 	OpenGamesList
 	GamePreGameStatus
 	GameState
-	GameWon
-	GameLost
+	_ // formerly GameWon
+	_ // formerly GameLost
+	GameOver
+	//Client Messages
+	OfferDraw
+	AcceptDraw
+	//Handshake Messages
+	Hello
+	Welcome
+	//Keepalive Messages
+	Pong
+	//Game Update Messages
+	PlayerJoined
+	CellChanged
+	ShipSunk
+	TurnChanged
+	GameSnapshot
+	RequestSnapshot
 )
 
+// retiredMsgTypes are no longer sent, they stay reserved so that older peers
+// never mistake a newer message for them
+var retiredMsgTypes = map[MsgType]bool{
+	GameState + 1: true, // GameWon
+	GameState + 2: true, // GameLost
+}
+
 func AllMsgTypes() <-chan MsgType {
 	// You can define constraints for the iterator in one place
 	var first MsgType = Ping
-	var last MsgType = GameLost
+	var last MsgType = RequestSnapshot
 
 	// Sequential values of the iterator are communicated via channel
 	ch := make(chan MsgType)
@@ -41,6 +65,9 @@ func AllMsgTypes() <-chan MsgType {
 	// Spawn a goroutine to iterate over the values of the iota constant
 	go func() {
 		for msg := first; msg <= last; msg++ {
+			if retiredMsgTypes[msg] {
+				continue
+			}
 			ch <- msg
 		}
 
@@ -51,8 +78,10 @@ func AllMsgTypes() <-chan MsgType {
 	return ch
 }
 
+// BattleMsg is a message of the protocol. Messages are registered by their
+// MsgType, see Register.
 type BattleMsg interface {
-	BattleMsg()
+	MsgType() MsgType
 }
 
 type Coord struct {
@@ -69,7 +98,10 @@ type OkMsg struct {
 	Ok string `json:"ok,omitempty"`
 }
 type ErrorMsg struct {
-	Error string `json:"error:omitempty"`
+	Code ErrorCode `json:"code"`
+	// Message is meant for people, clients should look at the code
+	Message string            `json:"error"`
+	Details map[string]string `json:"details,omitempty"`
 }
 type GameMoveMsg struct {
 	Player int `json:"player"`
@@ -88,7 +120,11 @@ type ConnectMsg struct {
 	Username string `json:"username"`
 }
 type RequestOpenGamesListMsg struct{}
-type CreateGameMsg struct{}
+type CreateGameMsg struct {
+	// Rules in the form written by game.Rules.String, the standard rules
+	// are used when empty
+	Rules string `json:"rules,omitempty"`
+}
 type JoinGameMsg struct {
 	Id int `json:"id"`
 }
@@ -112,6 +148,7 @@ type AbandonGameMsg struct{}
 type Game struct {
 	Id       int    `json:"id"`
 	Username string `json:"username"`
+	Rules    string `json:"rules,omitempty"`
 }
 type OpenGamesListMsg struct {
 	Games []Game `json:"games"`
@@ -126,154 +163,161 @@ type GameStateMsg struct {
 	YourGrid     [][]int `json:"you"`
 	OpponentGrid [][]int `json:"opponnent"`
 }
-type GameWonMsg struct{}
-type GameLostMsg struct{}
+
+// Values of GameOverMsg.Outcome from the point of view of the receiving player
+const (
+	OutcomeWon  = "won"
+	OutcomeLost = "lost"
+	OutcomeDraw = "draw"
+)
+
+// Values of GameOverMsg.Reason
+const (
+	ReasonFleetSunk     = "fleet_sunk"
+	ReasonResignation   = "resignation"
+	ReasonDrawAgreement = "draw_agreement"
+	ReasonTimeout       = "timeout"
+	ReasonDisconnect    = "disconnect"
+)
+
+type GameOverMsg struct {
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason"`
+}
+
+/*
+ * Client Messages added after the server messages
+ */
+
+type OfferDrawMsg struct{}
+type AcceptDrawMsg struct{}
+
+/*
+ * Handshake Messages
+ */
+
+// HelloMsg is the first message sent by a client. It replaces ConnectMsg,
+// which is still accepted from clients speaking version 1.
+type HelloMsg struct {
+	Version  int      `json:"version"`
+	Username string   `json:"username"`
+	Features Features `json:"features"`
+}
+
+// WelcomeMsg answers a HelloMsg with the version and features the server
+// picked for the connection. The server answers with an ErrorMsg and closes
+// the connection when nothing compatible could be found.
+type WelcomeMsg struct {
+	Version  int      `json:"version"`
+	Features Features `json:"features"`
+}
 
 /*
- * Methods to satisfy BattleShipMsg interface
+ * Keepalive Messages
+ */
+
+// PongMsg answers a PingMsg
+type PongMsg struct{}
+
+/*
+ * Game Update Messages
+ *
+ * Clients speaking version 3 keep a replica of their game up to date with
+ * these messages instead of receiving full GameStateMsg. Every update of a
+ * game has the next sequence number, see GameReplica.
+ */
+
+// PlayerJoinedMsg tells that a player took a seat in the game
+type PlayerJoinedMsg struct {
+	Seq      int    `json:"seq"`
+	Player   int    `json:"player"`
+	Username string `json:"username"`
+}
+
+// CellChangedMsg tells that a shot changed a cell of the grid of Player
+type CellChangedMsg struct {
+	Seq    int `json:"seq"`
+	Player int `json:"player"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	State  int `json:"state"`
+}
+
+// ShipSunkMsg tells that a ship of Player was sunk
+type ShipSunkMsg struct {
+	Seq    int   `json:"seq"`
+	Player int   `json:"player"`
+	Piece  int   `json:"piece"`
+	Start  Coord `json:"start"`
+	End    Coord `json:"end"`
+}
+
+// TurnChangedMsg tells whose turn it is
+type TurnChangedMsg struct {
+	Seq    int `json:"seq"`
+	Player int `json:"player"`
+}
+
+// GameSnapshotMsg is the whole game seen by the receiving player, You. It is
+// sent once both fleets are placed and in reply to a RequestSnapshotMsg.
+type GameSnapshotMsg struct {
+	Seq          int     `json:"seq"`
+	Id           int     `json:"id"`
+	You          int     `json:"you"`
+	P1           string  `json:"p1"`
+	P2           string  `json:"p2"`
+	Turn         int     `json:"turn"`
+	YourGrid     [][]int `json:"your_grid"`
+	OpponentGrid [][]int `json:"opponent_grid"`
+}
+
+// RequestSnapshotMsg asks for a GameSnapshotMsg, typically after a client
+// noticed it missed updates
+type RequestSnapshotMsg struct{}
+
+/*
+ * Methods to satisfy BattleMsg interface
  */
 
 // Common
-func (m PingMsg) BattleMsg()        {}
-func (m OkMsg) BattleMsg()          {}
-func (m ErrorMsg) BattleMsg()       {}
-func (m GameMoveMsg) BattleMsg()    {}
-func (m ChatMessageMsg) BattleMsg() {}
+func (m PingMsg) MsgType() MsgType        { return Ping }
+func (m OkMsg) MsgType() MsgType          { return Ok }
+func (m ErrorMsg) MsgType() MsgType       { return Error }
+func (m GameMoveMsg) MsgType() MsgType    { return GameMove }
+func (m ChatMessageMsg) MsgType() MsgType { return ChatMessage }
 
 // Client
-func (m ConnectMsg) BattleMsg()              {}
-func (m RequestOpenGamesListMsg) BattleMsg() {}
-func (m CreateGameMsg) BattleMsg()           {}
-func (m JoinGameMsg) BattleMsg()             {}
-func (m AcceptGameMsg) BattleMsg()           {}
-func (m RejectGameMsg) BattleMsg()           {}
-func (m GameSetPieceMsg) BattleMsg()         {}
-func (m RequestGameStateMsg) BattleMsg()     {}
-func (m AbandonGameMsg) BattleMsg()          {}
+func (m ConnectMsg) MsgType() MsgType              { return Connect }
+func (m RequestOpenGamesListMsg) MsgType() MsgType { return RequestOpenGamesList }
+func (m CreateGameMsg) MsgType() MsgType           { return CreateGame }
+func (m JoinGameMsg) MsgType() MsgType             { return JoinGame }
+func (m AcceptGameMsg) MsgType() MsgType           { return AcceptGame }
+func (m RejectGameMsg) MsgType() MsgType           { return RejectGame }
+func (m GameSetPieceMsg) MsgType() MsgType         { return GameSetPiece }
+func (m RequestGameStateMsg) MsgType() MsgType     { return RequestGameState }
+func (m AbandonGameMsg) MsgType() MsgType          { return AbandonGame }
 
 // Server
-func (m OpenGamesListMsg) BattleMsg()     {}
-func (m GamePreGameStatusMsg) BattleMsg() {}
-func (m GameStateMsg) BattleMsg()         {}
-func (m GameWonMsg) BattleMsg()           {}
-func (m GameLostMsg) BattleMsg()          {}
-
-// Deep comparison of BattleMsg
-func BattleMsgEquals(a, b BattleMsg) bool {
-	switch a := a.(type) {
-	case PingMsg:
-		if _, ok := b.(PingMsg); ok {
-			return true
-		}
-	case OkMsg:
-		if b, ok := b.(OkMsg); ok && b.Ok == a.Ok {
-			return true
-		}
-	case ErrorMsg:
-		if b, ok := b.(ErrorMsg); ok && b.Error == a.Error {
-			return true
-		}
-	case GameMoveMsg:
-		if b, ok := b.(GameMoveMsg); ok &&
-			b.Player == a.Player &&
-			b.X == a.X &&
-			b.Y == a.Y {
-			return true
-		}
-	case ChatMessageMsg:
-		if b, ok := b.(ChatMessageMsg); ok && b.Msg == a.Msg {
-			return true
-		}
-	case ConnectMsg:
-		if b, ok := b.(ConnectMsg); ok && b.Username == a.Username {
-			return true
-		}
-	case RequestOpenGamesListMsg:
-		if _, ok := b.(RequestOpenGamesListMsg); ok {
-			return true
-		}
-	case CreateGameMsg:
-		if _, ok := b.(CreateGameMsg); ok {
-			return true
-		}
-	case JoinGameMsg:
-		if b, ok := b.(JoinGameMsg); ok && b.Id == a.Id {
-			return true
-		}
-	case AcceptGameMsg:
-		if b, ok := b.(AcceptGameMsg); ok && b.Id == a.Id {
-			return true
-		}
-	case RejectGameMsg:
-		if b, ok := b.(RejectGameMsg); ok && b.Id == a.Id {
-			return true
-		}
-	case GameSetPieceMsg:
-		if b, ok := b.(GameSetPieceMsg); ok && b.Piece == a.Piece &&
-			b.Start.X == a.Start.X && b.Start.Y == a.Start.Y &&
-			b.End.X == a.End.X && b.End.Y == a.End.Y {
-			return true
-		}
-	case RequestGameStateMsg:
-		if _, ok := b.(RequestGameStateMsg); ok {
-			return true
-		}
-	case AbandonGameMsg:
-		if _, ok := b.(AbandonGameMsg); ok {
-			return true
-		}
-	case OpenGamesListMsg:
-		if b, ok := b.(OpenGamesListMsg); ok && len(b.Games) == len(a.Games) {
-			for i := range b.Games {
-				if b.Games[i].Id != a.Games[i].Id || b.Games[i].Username != a.Games[i].Username {
-					return false
-				}
-			}
-			return true
-		}
-	case GamePreGameStatusMsg:
-		if b, ok := b.(GamePreGameStatusMsg); ok && b.Id == a.Id && b.Opponent == a.Opponent {
-			return true
-		}
-	case GameStateMsg:
-		if b, ok := b.(GameStateMsg); ok && b.P1 == a.P1 && b.P2 == a.P2 &&
-			len(b.OpponentGrid) == len(a.OpponentGrid) &&
-			len(b.YourGrid) == len(a.YourGrid) {
-
-			for i := range b.YourGrid {
-				if len(b.YourGrid[i]) != len(a.YourGrid[i]) {
-					return false
-				}
-				for j := range b.YourGrid[i] {
-					if b.YourGrid[i][j] != a.YourGrid[i][j] {
-						return false
-					}
-				}
-			}
+func (m OpenGamesListMsg) MsgType() MsgType     { return OpenGamesList }
+func (m GamePreGameStatusMsg) MsgType() MsgType { return GamePreGameStatus }
+func (m GameStateMsg) MsgType() MsgType         { return GameState }
+func (m GameOverMsg) MsgType() MsgType          { return GameOver }
 
-			for i := range b.OpponentGrid {
-				if len(b.OpponentGrid[i]) != len(a.OpponentGrid[i]) {
-					return false
-				}
-				for j := range b.OpponentGrid[i] {
-					if b.OpponentGrid[i][j] != a.OpponentGrid[i][j] {
-						return false
-					}
-				}
-			}
-			return true
-		}
-	case GameWonMsg:
-		if _, ok := b.(GameWonMsg); ok {
-			return true
-		}
-	case GameLostMsg:
-		if _, ok := b.(GameLostMsg); ok {
-			return true
-		}
+// Client
+func (m OfferDrawMsg) MsgType() MsgType  { return OfferDraw }
+func (m AcceptDrawMsg) MsgType() MsgType { return AcceptDraw }
 
-	default:
-		return false
-	}
-	return false
-}
+// Handshake
+func (m HelloMsg) MsgType() MsgType   { return Hello }
+func (m WelcomeMsg) MsgType() MsgType { return Welcome }
+
+// Keepalive
+func (m PongMsg) MsgType() MsgType { return Pong }
+
+// Game Update
+func (m PlayerJoinedMsg) MsgType() MsgType    { return PlayerJoined }
+func (m CellChangedMsg) MsgType() MsgType     { return CellChanged }
+func (m ShipSunkMsg) MsgType() MsgType        { return ShipSunk }
+func (m TurnChangedMsg) MsgType() MsgType     { return TurnChanged }
+func (m GameSnapshotMsg) MsgType() MsgType    { return GameSnapshot }
+func (m RequestSnapshotMsg) MsgType() MsgType { return RequestSnapshot }
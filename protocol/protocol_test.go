@@ -1,36 +1,56 @@
 package protocol
 
 import (
+	"reflect"
 	"testing"
 )
 
+// testMessages holds at least one message of every type
+var testMessages = []BattleMsg{
+	// Common Messages
+	PingMsg{},
+	OkMsg{Ok: "hello world"},
+	ErrorMsg{Message: "This is not an error"},
+	ErrorMsg{Code: NotYourTurn, Message: "Move: Currently Player2's turn", Details: map[string]string{"turn": "Player2"}},
+	GameMoveMsg{Player: 0, X: 1, Y: 2},
+	ChatMessageMsg{Msg: "This is not a message"},
+	// Client Messages
+	ConnectMsg{Username: "jonfk"},
+	RequestOpenGamesListMsg{},
+	CreateGameMsg{},
+	CreateGameMsg{Rules: "10x10 p2.shots=1"},
+	JoinGameMsg{Id: 99},
+	AcceptGameMsg{Id: 99},
+	RejectGameMsg{Id: 99},
+	GameSetPieceMsg{Piece: 2, Start: Coord{X: 0, Y: 0}, End: Coord{X: 99, Y: 100}},
+	RequestGameStateMsg{},
+	AbandonGameMsg{},
+	// Server Messages
+	OpenGamesListMsg{Games: []Game{Game{Id: 9919, Username: "gery"}, Game{Id: 91823, Username: "dad", Rules: "8x8 p1.area=6x6"}}},
+	GamePreGameStatusMsg{Id: 2838, Opponent: ""},
+	GameStateMsg{P1: "jonfk!", P2: "-Gery",
+		YourGrid:     [][]int{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		OpponentGrid: [][]int{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}},
+	GameOverMsg{Outcome: OutcomeLost, Reason: ReasonTimeout},
+	OfferDrawMsg{},
+	AcceptDrawMsg{},
+	// Handshake Messages
+	HelloMsg{Version: 2, Username: "jonfk", Features: Features{Codecs: []string{CodecJSON}, Weapons: []string{"torpedo"}}},
+	WelcomeMsg{Version: 2, Features: LegacyFeatures()},
+	// Keepalive Messages
+	PongMsg{},
+	// Game Update Messages
+	PlayerJoinedMsg{Seq: 1, Player: 1, Username: "gery"},
+	CellChangedMsg{Seq: 2, Player: 1, X: 3, Y: 4, State: 2},
+	ShipSunkMsg{Seq: 3, Player: 1, Piece: 0, Start: Coord{X: 3, Y: 4}, End: Coord{X: 3, Y: 5}},
+	TurnChangedMsg{Seq: 4, Player: 1},
+	GameSnapshotMsg{Seq: 4, Id: 7, You: 0, P1: "jonfk", P2: "gery", Turn: 1,
+		YourGrid: [][]int{{0, 1}, {0, 0}}, OpponentGrid: [][]int{{0, 2}, {3, 0}}},
+	RequestSnapshotMsg{},
+}
+
 func TestProtocolMessages(t *testing.T) {
-	messages := []BattleMsg{
-		// Common Messages
-		PingMsg{},
-		OkMsg{Ok: "hello world"},
-		ErrorMsg{Error: "This is not an error"},
-		GameMoveMsg{Player: 0, X: 1, Y: 2},
-		ChatMessageMsg{Msg: "This is not a message"},
-		// Client Messages
-		ConnectMsg{Username: "jonfk"},
-		RequestOpenGamesListMsg{},
-		CreateGameMsg{},
-		JoinGameMsg{Id: 99},
-		AcceptGameMsg{Id: 99},
-		RejectGameMsg{Id: 99},
-		GameSetPieceMsg{Piece: 2, Start: Coord{X: 0, Y: 0}, End: Coord{X: 99, Y: 100}},
-		RequestGameStateMsg{},
-		AbandonGameMsg{},
-		// Server Messages
-		OpenGamesListMsg{Games: []Game{Game{Id: 9919, Username: "gery"}, Game{Id: 91823, Username: "dad"}}},
-		GamePreGameStatusMsg{Id: 2838, Opponent: ""},
-		GameStateMsg{P1: "jonfk!", P2: "-Gery",
-			YourGrid:     [][]int{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
-			OpponentGrid: [][]int{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}},
-		GameWonMsg{},
-		GameLostMsg{},
-	}
+	messages := testMessages
 
 	for _, msg := range messages {
 		msgTypeB, msgB, err := Msg2Raw(msg)
@@ -47,3 +67,17 @@ func TestProtocolMessages(t *testing.T) {
 		}
 	}
 }
+
+func TestEmptyPayload(t *testing.T) {
+	for _, msg := range testMessages {
+		zero := reflect.Zero(reflect.TypeOf(msg)).Interface().(BattleMsg)
+		for _, codec := range Codecs {
+			parsed, err := DecodeMsg(codec, uint8(msg.MsgType()), nil)
+			if err != nil {
+				t.Errorf("%v: %v", codec.Name(), err)
+			} else if !BattleMsgEquals(parsed, zero) {
+				t.Errorf("%v: an empty payload should be the zero %v instead of %#v", codec.Name(), msg.MsgType(), parsed)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package protocol
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Message types from FirstExtensionMsgType up are reserved for messages
+// registered by other packages with Register
+const FirstExtensionMsgType MsgType = 128
+
+var (
+	registryMut sync.RWMutex
+	registry    = make(map[MsgType]reflect.Type)
+)
+
+func init() {
+	for _, msg := range []BattleMsg{
+		// Common Messages
+		PingMsg{}, OkMsg{}, ErrorMsg{}, GameMoveMsg{}, ChatMessageMsg{},
+		// Client Messages
+		ConnectMsg{}, RequestOpenGamesListMsg{}, CreateGameMsg{}, JoinGameMsg{}, AcceptGameMsg{},
+		RejectGameMsg{}, GameSetPieceMsg{}, RequestGameStateMsg{}, AbandonGameMsg{},
+		// Server Messages
+		OpenGamesListMsg{}, GamePreGameStatusMsg{}, GameStateMsg{}, GameOverMsg{},
+		// Client Messages
+		OfferDrawMsg{}, AcceptDrawMsg{},
+		// Handshake Messages
+		HelloMsg{}, WelcomeMsg{},
+		// Keepalive Messages
+		PongMsg{},
+		// Game Update Messages
+		PlayerJoinedMsg{}, CellChangedMsg{}, ShipSunkMsg{}, TurnChangedMsg{},
+		GameSnapshotMsg{}, RequestSnapshotMsg{},
+	} {
+		registry[msg.MsgType()] = reflect.TypeOf(msg)
+	}
+}
+
+// Register adds an extension message. Its type must be in the extension
+// range and not registered yet. The message must be a struct whose fields
+// can be encoded by every codec.
+func Register(msg BattleMsg) error {
+	msgType := msg.MsgType()
+	if msgType < FirstExtensionMsgType {
+		return fmt.Errorf("Register: msg type %d is below the extension range starting at %d", msgType, FirstExtensionMsgType)
+	}
+	typ := reflect.TypeOf(msg)
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("Register: msg %v is not a struct", typ)
+	}
+	registryMut.Lock()
+	defer registryMut.Unlock()
+	if other, ok := registry[msgType]; ok {
+		return fmt.Errorf("Register: msg type %d is already used by %v", msgType, other)
+	}
+	registry[msgType] = typ
+	return nil
+}
+
+func lookupMsgType(msgType MsgType) (reflect.Type, bool) {
+	registryMut.RLock()
+	defer registryMut.RUnlock()
+	typ, ok := registry[msgType]
+	return typ, ok
+}
+
+// BattleMsgEquals is a deep comparison of messages where nil and empty
+// slices are equal and unexported fields are ignored, as they are after a
+// round trip through a codec
+func BattleMsgEquals(a, b BattleMsg) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Type() == vb.Type() && deepEqual(va, vb)
+}
+
+func deepEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !deepEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, key := range a.MapKeys() {
+			value := b.MapIndex(key)
+			if !value.IsValid() || !deepEqual(a.MapIndex(key), value) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+			if !deepEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return deepEqual(a.Elem(), b.Elem())
+	// Values read through unexported embedded fields cannot be turned back
+	// into interfaces
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.String:
+		return a.String() == b.String()
+	default:
+		if !a.CanInterface() || !b.CanInterface() {
+			return false
+		}
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
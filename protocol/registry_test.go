@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"testing"
+)
+
+type torpedoMsg struct {
+	Target Coord `json:"target"`
+	Depth  int   `json:"depth"`
+}
+
+func (m torpedoMsg) MsgType() MsgType { return FirstExtensionMsgType + 1 }
+
+type lowMsg struct{}
+
+func (m lowMsg) MsgType() MsgType { return RequestSnapshot + 1 }
+
+func TestRegistry(t *testing.T) {
+	for msgType := range AllMsgTypes() {
+		if _, ok := lookupMsgType(msgType); !ok {
+			t.Errorf("%v is not registered", msgType)
+		}
+	}
+
+	for msgType := range retiredMsgTypes {
+		if _, ok := lookupMsgType(msgType); ok {
+			t.Errorf("retired %v is registered", msgType)
+		}
+	}
+	if GameOver != 19 || GameOver.String() != "GameOver" || MsgType(17).String() != "MsgType(17)" {
+		t.Errorf("unexpected wire type %d for %v", GameOver, GameOver)
+	}
+
+	if err := Register(torpedoMsg{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(torpedoMsg{}); err == nil {
+		t.Errorf("expected an error when registering a msg type twice")
+	}
+	if err := Register(lowMsg{}); err == nil {
+		t.Errorf("expected an error when registering a msg type outside of the extension range")
+	}
+
+	msg := torpedoMsg{Target: Coord{X: 3, Y: 4}, Depth: 2}
+	for _, codec := range Codecs {
+		msgType, payload, err := EncodeMsg(codec, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := DecodeMsg(codec, msgType, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !BattleMsgEquals(parsed, msg) {
+			t.Errorf("%v: parsed message %#v should be the same as original %#v", codec.Name(), parsed, msg)
+		}
+	}
+
+	if _, _, err := Msg2Raw(lowMsg{}); err == nil {
+		t.Errorf("expected an error when encoding an unregistered msg")
+	}
+	if _, err := Raw2Msg(uint8(FirstExtensionMsgType+2), nil); err == nil {
+		t.Errorf("expected an error when decoding an unregistered msg type")
+	}
+}
+
+// privateMsg is a message with unexported fields
+type privateMsg struct {
+	Id int
+	embedded
+	note []string
+}
+
+type embedded struct {
+	Name string
+}
+
+func (m privateMsg) MsgType() MsgType { return Ping }
+
+func TestBattleMsgEquals(t *testing.T) {
+	testCases := []struct {
+		a, b  BattleMsg
+		equal bool
+	}{
+		{OpenGamesListMsg{}, OpenGamesListMsg{Games: []Game{}}, true},
+		{OpenGamesListMsg{Games: []Game{{Id: 1}}}, OpenGamesListMsg{Games: []Game{{Id: 2}}}, false},
+		{JoinGameMsg{Id: 1}, AcceptGameMsg{Id: 1}, false},
+		{PingMsg{}, PingMsg{}, true},
+		{nil, PingMsg{}, false},
+		{HelloMsg{Features: Features{Codecs: []string{CodecJSON}}}, HelloMsg{Features: Features{Codecs: []string{CodecCBOR}}}, false},
+		{privateMsg{Id: 1, note: []string{"a"}}, privateMsg{Id: 1}, true},
+		{privateMsg{embedded: embedded{"a"}}, privateMsg{embedded: embedded{"b"}}, false},
+	}
+	for i, testCase := range testCases {
+		if BattleMsgEquals(testCase.a, testCase.b) != testCase.equal {
+			t.Errorf("case %d: expected %#v and %#v to be equal: %v", i, testCase.a, testCase.b, testCase.equal)
+		}
+	}
+}
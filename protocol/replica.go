@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSequenceGap is returned when updates were missed, the client should
+// send a RequestSnapshotMsg and wait for the snapshot. It is wrapped with the
+// sequence numbers so it must be checked with errors.Is.
+var ErrSequenceGap = errors.New("protocol: game updates were missed")
+
+// GameReplica is a client's copy of its game, created from a snapshot and
+// kept up to date by the following updates
+type GameReplica struct {
+	// Seq is the sequence number of the last update applied
+	Seq          int
+	Id           int
+	You          int
+	Players      [2]string
+	Turn         int
+	YourGrid     [][]int
+	OpponentGrid [][]int
+	// Sunk lists the ships sunk of each player
+	Sunk [2][]ShipSunkMsg
+}
+
+func NewGameReplica(snapshot GameSnapshotMsg) *GameReplica {
+	r := &GameReplica{}
+	r.reset(snapshot)
+	return r
+}
+
+func (r *GameReplica) reset(snapshot GameSnapshotMsg) {
+	*r = GameReplica{
+		Seq:          snapshot.Seq,
+		Id:           snapshot.Id,
+		You:          snapshot.You,
+		Players:      [2]string{snapshot.P1, snapshot.P2},
+		Turn:         snapshot.Turn,
+		YourGrid:     cloneCells(snapshot.YourGrid),
+		OpponentGrid: cloneCells(snapshot.OpponentGrid),
+	}
+}
+
+// IsUpdate reports whether msg is an update applied by Apply
+func IsUpdate(msg BattleMsg) bool {
+	switch msg.(type) {
+	case PlayerJoinedMsg, CellChangedMsg, ShipSunkMsg, TurnChangedMsg, GameSnapshotMsg:
+		return true
+	}
+	return false
+}
+
+// Apply applies an update. A snapshot replaces the whole replica. Updates
+// already applied are ignored and ErrSequenceGap is returned, leaving the
+// replica unchanged, when the update is not the next one.
+func (r *GameReplica) Apply(msg BattleMsg) error {
+	var seq int
+	switch msg := msg.(type) {
+	case GameSnapshotMsg:
+		r.reset(msg)
+		return nil
+	case PlayerJoinedMsg:
+		seq = msg.Seq
+	case CellChangedMsg:
+		seq = msg.Seq
+	case ShipSunkMsg:
+		seq = msg.Seq
+	case TurnChangedMsg:
+		seq = msg.Seq
+	default:
+		return fmt.Errorf("Apply: %T is not a game update", msg)
+	}
+	if seq <= r.Seq {
+		return nil
+	}
+	if seq != r.Seq+1 {
+		return fmt.Errorf("%w: expected update %d but got %d", ErrSequenceGap, r.Seq+1, seq)
+	}
+
+	switch msg := msg.(type) {
+	case PlayerJoinedMsg:
+		if msg.Player != 0 && msg.Player != 1 {
+			return fmt.Errorf("Apply: invalid player %d", msg.Player)
+		}
+		r.Players[msg.Player] = msg.Username
+	case CellChangedMsg:
+		grid := r.OpponentGrid
+		if msg.Player == r.You {
+			grid = r.YourGrid
+		}
+		if msg.Y < 0 || msg.Y >= len(grid) || msg.X < 0 || msg.X >= len(grid[msg.Y]) {
+			return fmt.Errorf("Apply: cell {%d %d} is outside of the grid", msg.X, msg.Y)
+		}
+		grid[msg.Y][msg.X] = msg.State
+	case ShipSunkMsg:
+		if msg.Player != 0 && msg.Player != 1 {
+			return fmt.Errorf("Apply: invalid player %d", msg.Player)
+		}
+		r.Sunk[msg.Player] = append(r.Sunk[msg.Player], msg)
+	case TurnChangedMsg:
+		r.Turn = msg.Player
+	}
+	r.Seq = seq
+	return nil
+}
+
+func cloneCells(cells [][]int) [][]int {
+	clone := make([][]int, len(cells))
+	for y := range cells {
+		clone[y] = append([]int(nil), cells[y]...)
+	}
+	return clone
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGameReplica(t *testing.T) {
+	snapshot := GameSnapshotMsg{Seq: 5, Id: 1, You: 1, P1: "jonfk", P2: "gery",
+		YourGrid: [][]int{{1, 1}, {0, 0}}, OpponentGrid: [][]int{{0, 0}, {0, 0}}}
+	r := NewGameReplica(snapshot)
+
+	updates := []BattleMsg{
+		CellChangedMsg{Seq: 6, Player: 0, X: 1, Y: 1, State: 3},
+		TurnChangedMsg{Seq: 7, Player: 0},
+		CellChangedMsg{Seq: 8, Player: 1, X: 0, Y: 0, State: 2},
+		// Updates already applied are ignored
+		CellChangedMsg{Seq: 8, Player: 1, X: 1, Y: 0, State: 2},
+	}
+	for _, update := range updates {
+		if err := r.Apply(update); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.Seq != 8 || r.Turn != 0 {
+		t.Errorf("unexpected sequence number %d or turn %d", r.Seq, r.Turn)
+	}
+	if expected := [][]int{{2, 1}, {0, 0}}; !reflect.DeepEqual(r.YourGrid, expected) {
+		t.Errorf("expected your grid %v but got %v", expected, r.YourGrid)
+	}
+	if expected := [][]int{{0, 0}, {0, 3}}; !reflect.DeepEqual(r.OpponentGrid, expected) {
+		t.Errorf("expected the opponent's grid %v but got %v", expected, r.OpponentGrid)
+	}
+	// The snapshot is not modified by updates
+	if snapshot.YourGrid[0][0] != 1 {
+		t.Error("the replica shares its grids with the snapshot")
+	}
+
+	// A gap is detected and leaves the replica as it was
+	err := r.Apply(ShipSunkMsg{Seq: 10, Player: 1})
+	if !errors.Is(err, ErrSequenceGap) {
+		t.Errorf("expected ErrSequenceGap but got %v", err)
+	}
+	if r.Seq != 8 || len(r.Sunk[1]) != 0 {
+		t.Error("an update after a gap was applied")
+	}
+	// A new snapshot resynchronizes the replica
+	snapshot.Seq = 10
+	if err := r.Apply(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	sunk := ShipSunkMsg{Seq: 11, Player: 1, Start: Coord{X: 0, Y: 0}, End: Coord{X: 1, Y: 0}}
+	if err := r.Apply(sunk); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Sunk[1]) != 1 || r.Sunk[1][0] != sunk {
+		t.Errorf("unexpected sunk ships %v", r.Sunk)
+	}
+
+	for _, invalid := range []BattleMsg{
+		CellChangedMsg{Seq: 12, Player: 0, X: 2, Y: 0},
+		PlayerJoinedMsg{Seq: 12, Player: 2},
+		ChatMessageMsg{},
+	} {
+		if err := r.Apply(invalid); err == nil || errors.Is(err, ErrSequenceGap) {
+			t.Errorf("expected an error applying %#v but got %v", invalid, err)
+		}
+	}
+	if !IsUpdate(sunk) || IsUpdate(RequestSnapshotMsg{}) {
+		t.Error("IsUpdate is wrong")
+	}
+}
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRequestTimeout is returned when no reply arrives before the timeout
+var ErrRequestTimeout = errors.New("protocol: request timed out")
+
+// Requester sends requests with a request ID and hands every reply to the
+// goroutine waiting for it. The goroutine reading the connection must pass
+// the replies it reads to Deliver. Several requests can be in flight at
+// once, for example the placements of a whole fleet.
+type Requester struct {
+	writer *MsgWriter
+
+	mu      sync.Mutex
+	lastID  uint32
+	waiting map[uint32]chan BattleMsg
+	err     error
+}
+
+func NewRequester(writer *MsgWriter) *Requester {
+	return &Requester{writer: writer, waiting: make(map[uint32]chan BattleMsg)}
+}
+
+// Request sends the message and waits up to timeout for its reply. The reply
+// is returned as is, including when it is an ErrorMsg.
+func (r *Requester) Request(message BattleMsg, timeout time.Duration) (BattleMsg, error) {
+	reply := make(chan BattleMsg, 1)
+	r.mu.Lock()
+	if r.err != nil {
+		r.mu.Unlock()
+		return nil, r.err
+	}
+	r.lastID++
+	// Zero means no request ID
+	if r.lastID == 0 {
+		r.lastID++
+	}
+	id := r.lastID
+	r.waiting[id] = reply
+	r.mu.Unlock()
+
+	err := r.writer.WriteMsgID(id, message)
+	if err != nil {
+		r.forget(id)
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return nil, r.closeErr()
+		}
+		return msg, nil
+	case <-timer.C:
+		r.forget(id)
+		return nil, fmt.Errorf("%w: no reply to %T after %v", ErrRequestTimeout, message, timeout)
+	}
+}
+
+// Deliver hands a reply to the request waiting for it. It returns false when
+// no request is waiting for the ID, in which case the message is for the
+// caller to handle.
+func (r *Requester) Deliver(requestID uint32, msg BattleMsg) bool {
+	if requestID == 0 {
+		return false
+	}
+	r.mu.Lock()
+	reply, ok := r.waiting[requestID]
+	delete(r.waiting, requestID)
+	r.mu.Unlock()
+	if ok {
+		reply <- msg
+	}
+	return ok
+}
+
+// Close fails the pending and future requests with err, usually the error
+// that ended the connection
+func (r *Requester) Close(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = err
+	for id, reply := range r.waiting {
+		close(reply)
+		delete(r.waiting, id)
+	}
+}
+
+func (r *Requester) forget(id uint32) {
+	r.mu.Lock()
+	delete(r.waiting, id)
+	r.mu.Unlock()
+}
+
+func (r *Requester) closeErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoServer answers every JoinGameMsg with an OkMsg holding the game ID,
+// answering the requests in reverse order of arrival
+func echoServer(conn net.Conn, requests int) {
+	frames := NewFrameReader(conn)
+	writer := NewMsgWriter(conn)
+	type request struct {
+		id  uint32
+		msg JoinGameMsg
+	}
+	var received []request
+	for len(received) < requests {
+		msg, id, err := frames.ReadMsgID()
+		if err != nil {
+			return
+		}
+		received = append(received, request{id, msg.(JoinGameMsg)})
+	}
+	// An unsolicited message is not taken for a reply
+	writer.WriteMsg(ChatMessageMsg{Msg: "hello"})
+	for i := len(received) - 1; i >= 0; i-- {
+		writer.WriteMsgID(received[i].id, OkMsg{Ok: string(rune('0' + received[i].msg.Id))})
+	}
+}
+
+func TestRequester(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	const requests = 5
+	go echoServer(server, requests)
+
+	requester := NewRequester(NewMsgWriter(client))
+	unsolicited := make(chan BattleMsg, 1)
+	go func() {
+		frames := NewFrameReader(client)
+		for {
+			msg, id, err := frames.ReadMsgID()
+			if err != nil {
+				requester.Close(err)
+				return
+			}
+			if !requester.Deliver(id, msg) {
+				unsolicited <- msg
+			}
+		}
+	}()
+
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func(i int) {
+			reply, err := requester.Request(JoinGameMsg{Id: i}, time.Second)
+			if err == nil && !BattleMsgEquals(reply, OkMsg{Ok: string(rune('0' + i))}) {
+				err = errors.New("request " + string(rune('0'+i)) + " got the wrong reply")
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < requests; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if msg := <-unsolicited; !BattleMsgEquals(msg, ChatMessageMsg{Msg: "hello"}) {
+		t.Errorf("unexpected unsolicited message %#v", msg)
+	}
+
+	server.Close()
+	if _, err := requester.Request(PingMsg{}, time.Second); err == nil {
+		t.Errorf("expected an error once the connection is closed")
+	}
+}
+
+func TestRequesterTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	requester := NewRequester(NewMsgWriter(client))
+	_, err := requester.Request(PingMsg{}, 10*time.Millisecond)
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("expected ErrRequestTimeout but got %v", err)
+	}
+	if len(requester.waiting) != 0 {
+		t.Errorf("the timed out request should be forgotten")
+	}
+}
@@ -0,0 +1,117 @@
+// Package tlsutil builds the TLS configurations of the battleship server and
+// client and generates self-signed certificates for development. The protocol
+// runs unchanged over the tls.Conn of a listener or dialer using them.
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"time"
+)
+
+// DefaultValidity is how long generated certificates are valid
+const DefaultValidity = 365 * 24 * time.Hour
+
+// SelfSigned generates a self-signed certificate and its private key, both
+// PEM encoded, for the given host names and IP addresses. It is meant for
+// development, clients have to be given the certificate as their CA or run
+// insecurely.
+func SelfSigned(hosts []string, validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+	if len(hosts) == 0 {
+		return nil, nil, fmt.Errorf("SelfSigned: no host given")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SelfSigned: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("SelfSigned: %v", err)
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"battleship development"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		// The certificate signs itself so it is its own CA
+		IsCA: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SelfSigned: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SelfSigned: %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// WriteSelfSigned generates a self-signed certificate valid for a year and
+// writes it and its key to the given files
+func WriteSelfSigned(certFile, keyFile string, hosts []string) error {
+	certPEM, keyPEM, err := SelfSigned(hosts, DefaultValidity)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(certFile, certPEM, 0644)
+	if err != nil {
+		return fmt.Errorf("WriteSelfSigned: %v", err)
+	}
+	err = ioutil.WriteFile(keyFile, keyPEM, 0600)
+	if err != nil {
+		return fmt.Errorf("WriteSelfSigned: %v", err)
+	}
+	return nil
+}
+
+// ServerConfig loads the server's certificate and key
+func ServerConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("ServerConfig: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// ClientConfig verifies the server's certificate against the CA certificates
+// of caFile, or against the system's when caFile is empty. An insecure
+// configuration does not verify the server at all and must only be used in
+// development.
+func ClientConfig(caFile, serverName string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	if caFile == "" {
+		return config, nil
+	}
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("ClientConfig: %v", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("ClientConfig: no certificate found in %s", caFile)
+	}
+	return config, nil
+}
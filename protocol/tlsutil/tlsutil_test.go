@@ -0,0 +1,105 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonfk/battleship/protocol"
+)
+
+// exchange sends a message from a client to a server over TLS
+func exchange(t *testing.T, serverConfig, clientConfig *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan protocol.BattleMsg, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		msg, err := protocol.NewFrameReader(conn).ReadMsg()
+		if err == nil {
+			received <- msg
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	sent := protocol.ChatMessageMsg{Msg: "the secret plans"}
+	if err := protocol.NewMsgWriter(conn).WriteMsg(sent); err != nil {
+		return err
+	}
+	if msg := <-received; msg != sent {
+		t.Errorf("expected %#v but got %#v", sent, msg)
+	}
+	return nil
+}
+
+func TestSelfSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := WriteSelfSigned(certFile, keyFile, []string{"localhost", "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := ServerConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate is its own CA
+	clientConfig, err := ClientConfig(certFile, "localhost", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exchange(t, serverConfig, clientConfig); err != nil {
+		t.Errorf("verified connection failed: %v", err)
+	}
+
+	// A certificate from another CA is rejected unless insecure
+	otherCert, _, err := SelfSigned([]string{"localhost"}, DefaultValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFile := filepath.Join(dir, "other.pem")
+	ioutil.WriteFile(otherFile, otherCert, 0644)
+	clientConfig, err = ClientConfig(otherFile, "localhost", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exchange(t, serverConfig, clientConfig); err == nil {
+		t.Error("expected a certificate from another CA to be rejected")
+	}
+	clientConfig, err = ClientConfig("", "localhost", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exchange(t, serverConfig, clientConfig); err != nil {
+		t.Errorf("insecure connection failed: %v", err)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	if _, _, err := SelfSigned(nil, DefaultValidity); err == nil {
+		t.Error("expected an error without hosts")
+	}
+	if _, err := ServerConfig("missing.pem", "missing-key.pem"); err == nil {
+		t.Error("expected an error for missing files")
+	}
+	if _, err := ClientConfig("tlsutil.go", "localhost", false); err == nil {
+		t.Error("expected an error for a file without certificates")
+	}
+}
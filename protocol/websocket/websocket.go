@@ -0,0 +1,475 @@
+// Package websocket implements the parts of the WebSocket protocol, RFC 6455,
+// needed to carry battleship frames to browsers: the opening handshake on both
+// sides, text and binary messages, fragmentation and the ping, pong and close
+// control frames. Extensions such as permessage-deflate are not supported.
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types, the opcodes of RFC 6455
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close status codes
+const (
+	CloseNormal          = 1000
+	CloseProtocolError   = 1002
+	CloseMessageTooLarge = 1009
+)
+
+// DefaultMaxMessageSize is the largest message accepted unless configured
+// otherwise
+const DefaultMaxMessageSize = 1 << 20
+
+// acceptGUID is appended to the client's key to compute the accept header
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrBadHandshake is returned when the opening handshake is invalid
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrProtocol is returned when the peer breaks the framing rules
+	ErrProtocol = errors.New("websocket: protocol error")
+	// ErrMessageTooLarge is returned when a message is larger than the
+	// maximum message size
+	ErrMessageTooLarge = errors.New("websocket: message too large")
+)
+
+// Conn is a WebSocket connection. ReadMessage must only be called from one
+// goroutine at a time, WriteMessage is safe for concurrent use.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+	// Subprotocol is the subprotocol agreed on in the handshake, empty when
+	// none was
+	Subprotocol string
+	// MaxMessageSize is the largest message accepted by ReadMessage
+	MaxMessageSize int
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool, subprotocol string) *Conn {
+	return &Conn{conn: conn, br: br, client: client, Subprotocol: subprotocol, MaxMessageSize: DefaultMaxMessageSize}
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept header answering a
+// Sec-WebSocket-Key header
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Upgrade answers a WebSocket opening handshake and takes over the HTTP
+// connection. The subprotocol is the first one requested by the client that
+// is in protocols, or the first of protocols when the client did not ask for
+// any. A client asking only for unknown subprotocols is rejected.
+func Upgrade(w http.ResponseWriter, r *http.Request, protocols []string) (*Conn, error) {
+	fail := func(status int, reason string) (*Conn, error) {
+		http.Error(w, reason, status)
+		return nil, fmt.Errorf("%w: %s", ErrBadHandshake, reason)
+	}
+	if r.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "the method must be GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	requested := headerValues(r.Header, "Sec-WebSocket-Protocol")
+	subprotocol := ""
+	if len(requested) == 0 && len(protocols) > 0 {
+		subprotocol = protocols[0]
+	}
+	for _, name := range requested {
+		if contains(protocols, name) {
+			subprotocol = name
+			break
+		}
+	}
+	if len(requested) > 0 && subprotocol == "" {
+		return fail(http.StatusBadRequest, "unsupported subprotocols "+strings.Join(requested, ", "))
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return fail(http.StatusInternalServerError, "the connection cannot be taken over")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n"
+	if len(requested) > 0 {
+		response += "Sec-WebSocket-Protocol: " + subprotocol + "\r\n"
+	}
+	_, err = conn.Write([]byte(response + "\r\n"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newConn(conn, brw.Reader, false, subprotocol), nil
+}
+
+// Dial opens a WebSocket connection to a ws:// or wss:// URL asking for the
+// given subprotocols
+func Dial(rawurl string, protocols []string) (*Conn, error) {
+	return DialTLS(rawurl, protocols, nil)
+}
+
+// DialTLS is like Dial but uses config for wss:// URLs, the default
+// configuration is used when it is nil
+func DialTLS(rawurl string, protocols []string, config *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	var defaultPort string
+	switch u.Scheme {
+	case "ws":
+		defaultPort = "80"
+	case "wss":
+		defaultPort = "443"
+	default:
+		return nil, fmt.Errorf("Dial: unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = u.Hostname()
+		}
+		conn, err = tls.Dial("tcp", host, config)
+	} else {
+		conn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ws, err := NewClient(conn, u, protocols)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// NewClient performs the client side of the opening handshake over conn
+func NewClient(conn net.Conn, u *url.URL, protocols []string) (*Conn, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(protocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("%w: server answered %s", ErrBadHandshake, resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey(key) {
+		return nil, fmt.Errorf("%w: invalid Sec-WebSocket-Accept", ErrBadHandshake)
+	}
+	subprotocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	if subprotocol != "" && !contains(protocols, subprotocol) {
+		return nil, fmt.Errorf("%w: server picked subprotocol %q", ErrBadHandshake, subprotocol)
+	}
+	return newConn(conn, br, true, subprotocol), nil
+}
+
+/*
+ * Messages
+ */
+
+type frameHeader struct {
+	fin    bool
+	opcode int
+	masked bool
+	mask   [4]byte
+	length uint64
+}
+
+// ReadMessage reads the next text or binary message. Pings are answered and
+// pongs skipped. It returns io.EOF once the peer closed the connection.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+	for {
+		header, err := c.readHeader()
+		if err != nil {
+			return 0, nil, err
+		}
+		// The message is never longer than the limit so this cannot overflow
+		if header.opcode < CloseMessage && header.length > uint64(c.MaxMessageSize-len(message)) {
+			c.closeWith(CloseMessageTooLarge)
+			return 0, nil, fmt.Errorf("%w: the limit is %d bytes", ErrMessageTooLarge, c.MaxMessageSize)
+		}
+		payload := make([]byte, header.length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, err
+		}
+		if header.masked {
+			maskBytes(header.mask, payload)
+		}
+
+		switch header.opcode {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.closeWith(code)
+			return 0, nil, io.EOF
+		case continuationFrame:
+			if opcode == 0 {
+				return 0, nil, c.protocolError("continuation frame without a message")
+			}
+		case TextMessage, BinaryMessage:
+			if opcode != 0 {
+				return 0, nil, c.protocolError("new message within a fragmented message")
+			}
+			opcode = header.opcode
+		default:
+			return 0, nil, c.protocolError(fmt.Sprintf("unknown opcode %d", header.opcode))
+		}
+		message = append(message, payload...)
+		if header.fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *Conn) readHeader() (frameHeader, error) {
+	var (
+		header frameHeader
+		buf    [8]byte
+	)
+	if _, err := io.ReadFull(c.br, buf[:2]); err != nil {
+		return header, err
+	}
+	header.fin = buf[0]&0x80 != 0
+	header.opcode = int(buf[0] & 0x0f)
+	header.masked = buf[1]&0x80 != 0
+	header.length = uint64(buf[1] & 0x7f)
+	if buf[0]&0x70 != 0 {
+		return header, c.protocolError("reserved bits set without an extension")
+	}
+	switch header.length {
+	case 126:
+		if _, err := io.ReadFull(c.br, buf[:2]); err != nil {
+			return header, err
+		}
+		header.length = uint64(binary.BigEndian.Uint16(buf[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, buf[:8]); err != nil {
+			return header, err
+		}
+		header.length = binary.BigEndian.Uint64(buf[:8])
+		// The most significant bit of 64 bit lengths must be 0
+		if header.length>>63 != 0 {
+			return header, c.protocolError("invalid payload length")
+		}
+	}
+	if header.opcode >= CloseMessage && (!header.fin || header.length > 125) {
+		return header, c.protocolError("invalid control frame")
+	}
+	// Clients must mask their frames and servers must not
+	if header.masked == c.client {
+		return header, c.protocolError("invalid masking")
+	}
+	if header.masked {
+		if _, err := io.ReadFull(c.br, header.mask[:]); err != nil {
+			return header, err
+		}
+	}
+	return header, nil
+}
+
+// WriteMessage sends data as a single frame
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	var header [14]byte
+	header[0] = 0x80 | byte(opcode)
+	n := 2
+	switch {
+	case len(data) < 126:
+		header[1] = byte(len(data))
+	case len(data) <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(len(data)))
+		n += 2
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(len(data)))
+		n += 8
+	}
+	frame := bytes.NewBuffer(make([]byte, 0, n+4+len(data)))
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		header[1] |= 0x80
+		frame.Write(header[:n])
+		frame.Write(mask[:])
+		start := frame.Len()
+		frame.Write(data)
+		maskBytes(mask, frame.Bytes()[start:])
+	} else {
+		frame.Write(header[:n])
+		frame.Write(data)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(frame.Bytes())
+	return err
+}
+
+func maskBytes(mask [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+}
+
+func (c *Conn) protocolError(reason string) error {
+	c.closeWith(CloseProtocolError)
+	return fmt.Errorf("%w: %s", ErrProtocol, reason)
+}
+
+// closeWith sends a close frame with the status code once
+func (c *Conn) closeWith(code int) {
+	c.closeOnce.Do(func() {
+		var payload [2]byte
+		binary.BigEndian.PutUint16(payload[:], uint16(code))
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.WriteMessage(CloseMessage, payload[:])
+	})
+}
+
+// Close sends a close frame and closes the connection
+func (c *Conn) Close() error {
+	c.closeWith(CloseNormal)
+	return c.conn.Close()
+}
+
+func (c *Conn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+/*
+ * Headers
+ */
+
+// headerValues splits the comma separated values of a header
+func headerValues(header http.Header, name string) []string {
+	var values []string
+	for _, line := range header[http.CanonicalHeaderKey(name)] {
+		for _, value := range strings.Split(line, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func headerContains(header http.Header, name, value string) bool {
+	for _, v := range headerValues(header, name) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example of RFC 6455 section 1.3
+	if key := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %q", key)
+	}
+}
+
+// echoServer echoes every message it receives on its connections
+func echoServer(t *testing.T, protocols []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, protocols)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.MaxMessageSize = 1 << 16
+		for {
+			opcode, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(opcode, append([]byte(conn.Subprotocol+":"), data...)); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func TestEcho(t *testing.T) {
+	server := echoServer(t, []string{"battleship", "battleship.json"})
+	defer server.Close()
+	conn, err := Dial(wsURL(server), []string{"battleship.json", "battleship"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol != "battleship.json" {
+		t.Errorf("expected the client's preferred subprotocol but got %q", conn.Subprotocol)
+	}
+
+	for _, msg := range []struct {
+		opcode int
+		data   []byte
+	}{
+		{TextMessage, []byte(`{"type":0}`)},
+		{BinaryMessage, []byte{0, 1, 2, 3}},
+		{BinaryMessage, nil},
+		// Lengths written on 2 and 8 bytes
+		{BinaryMessage, bytes.Repeat([]byte{7}, 300)},
+		{BinaryMessage, bytes.Repeat([]byte{8}, 1<<16-100)},
+	} {
+		if err := conn.WriteMessage(msg.opcode, msg.data); err != nil {
+			t.Fatal(err)
+		}
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := append([]byte("battleship.json:"), msg.data...)
+		if opcode != msg.opcode || !bytes.Equal(data, expected) {
+			t.Errorf("sent %d bytes with opcode %d, got back %d bytes with opcode %d", len(msg.data), msg.opcode, len(data), opcode)
+		}
+	}
+}
+
+// TestFragments writes raw frames: a ping in the middle of a fragmented
+// message is answered and the fragments are put back together
+func TestFragments(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := newConn(server, bufio.NewReader(server), false, "")
+	go func() {
+		client.Write(maskedFrame(TextMessage, false, "hel"))
+		client.Write(maskedFrame(PingMessage, true, "ping"))
+		client.Write(maskedFrame(continuationFrame, true, "lo"))
+	}()
+	// The pong has to be read for the pipe not to block
+	pong := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 6)
+		io.ReadFull(client, buf)
+		pong <- buf
+	}()
+	opcode, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != TextMessage || string(data) != "hello" {
+		t.Errorf("unexpected message %d %q", opcode, data)
+	}
+	if buf := <-pong; buf[0] != 0x80|PongMessage || string(buf[2:]) != "ping" {
+		t.Errorf("unexpected pong %v", buf)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		frame []byte
+		err   error
+	}{
+		{"unmasked", []byte{0x80 | BinaryMessage, 0}, ErrProtocol},
+		{"too large", []byte{0x80 | BinaryMessage, 0x80 | 127, 0, 0, 0, 1, 0, 0, 0, 0, 1, 2, 3, 4}, ErrMessageTooLarge},
+		{"too large fragment", append(maskedFrame(TextMessage, false, "x"),
+			0x80|continuationFrame, 0x80|127, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4), ErrMessageTooLarge},
+		{"length top bit", []byte{0x80 | BinaryMessage, 0x80 | 127, 0x80, 0, 0, 0, 0, 0, 0, 1, 1, 2, 3, 4}, ErrProtocol},
+		{"continuation", maskedFrame(continuationFrame, true, "x"), ErrProtocol},
+		{"reserved bits", append([]byte{0xc0 | BinaryMessage}, maskedFrame(BinaryMessage, true, "")[1:]...), ErrProtocol},
+		{"unknown opcode", maskedFrame(3, true, ""), ErrProtocol},
+	} {
+		client, server := net.Pipe()
+		c := newConn(server, bufio.NewReader(server), false, "")
+		go client.Write(test.frame)
+		// Swallow the close frame
+		go io.Copy(ioutil.Discard, client)
+		_, _, err := c.ReadMessage()
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.err, err)
+		}
+		client.Close()
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	server := echoServer(t, []string{"battleship"})
+	defer server.Close()
+	if _, err := Dial(wsURL(server), []string{"chat"}); !errors.Is(err, ErrBadHandshake) {
+		t.Errorf("expected ErrBadHandshake for an unknown subprotocol but got %v", err)
+	}
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a plain GET to be rejected but got %v", resp.Status)
+	}
+}
+
+func TestClose(t *testing.T) {
+	server := echoServer(t, nil)
+	defer server.Close()
+	conn, err := Dial(wsURL(server), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.closeWith(CloseNormal)
+	// The server answers the close frame and closes the connection
+	if _, _, err := conn.ReadMessage(); err != io.EOF {
+		t.Errorf("expected io.EOF once closed but got %v", err)
+	}
+	conn.Close()
+}
+
+func maskedFrame(opcode int, fin bool, payload string) []byte {
+	mask := []byte{1, 2, 3, 4}
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
@@ -0,0 +1,147 @@
+package protocol
+
+import (
+	"io"
+	"sync"
+)
+
+// MsgWriter writes messages to a connection shared by several goroutines,
+// for example a player's own replies and the broadcasts of the games they
+// watch. Every message is framed into a pooled buffer and sent with a single
+// call to Write so that messages of concurrent writers never interleave.
+//
+// When Batch is set, messages queued while a write is in progress are sent
+// together in the next write, saving a system call per message under load.
+// WriteMsg still only returns once its message has been written.
+type MsgWriter struct {
+	w io.Writer
+	// MaxPayloadSize is the largest payload written
+	MaxPayloadSize int
+	Batch          bool
+	// CompressionThreshold is the payload size from which frames are
+	// compressed, see SetCompression
+	CompressionThreshold int
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	codec       Codec
+	compression Compression
+	// Fields below are only used in batch mode. queued and flushed count the
+	// messages added to pending and written so far.
+	writing bool
+	pending []byte
+	spare   []byte
+	queued  uint64
+	flushed uint64
+	// err is the first write error, the connection is broken after it
+	err error
+}
+
+func NewMsgWriter(w io.Writer) *MsgWriter {
+	mw := &MsgWriter{w: w, MaxPayloadSize: DefaultMaxPayloadSize, CompressionThreshold: DefaultCompressionThreshold}
+	mw.cond = sync.NewCond(&mw.mu)
+	return mw
+}
+
+// SetCodec changes the codec used by the following messages, JSON by default
+func (mw *MsgWriter) SetCodec(codec Codec) {
+	mw.mu.Lock()
+	mw.codec = codec
+	mw.mu.Unlock()
+}
+
+// SetCompression changes the compression of the following frames, nil for
+// none which is the default
+func (mw *MsgWriter) SetCompression(compression Compression) {
+	mw.mu.Lock()
+	mw.compression = compression
+	mw.mu.Unlock()
+}
+
+// WriteMsg encodes and writes a message. It is safe for concurrent use.
+func (mw *MsgWriter) WriteMsg(message BattleMsg) error {
+	return mw.WriteMsgID(0, message)
+}
+
+// WriteMsgID encodes and writes a message with a request ID. It is safe for
+// concurrent use.
+func (mw *MsgWriter) WriteMsgID(requestID uint32, message BattleMsg) error {
+	mw.mu.Lock()
+	codec := orJSON(mw.codec)
+	mw.mu.Unlock()
+	msgType, payload, err := EncodeMsg(codec, message)
+	if err != nil {
+		return err
+	}
+	return mw.Write(Frame{Type: msgType, RequestID: requestID, Payload: payload})
+}
+
+// Write writes a frame. It is safe for concurrent use.
+func (mw *MsgWriter) Write(frame Frame) error {
+	err := checkSize(frame, mw.MaxPayloadSize)
+	if err != nil {
+		return err
+	}
+	mw.mu.Lock()
+	compression := mw.compression
+	mw.mu.Unlock()
+	payload, compressed, err := compressPayload(compression, mw.CompressionThreshold, frame.Payload)
+	if err != nil {
+		return err
+	}
+	frame.Payload = payload
+	if mw.Batch {
+		return mw.writeBatched(frame, compressed)
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = appendFrame(*buf, frame, compressed)
+
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	if mw.err != nil {
+		return mw.err
+	}
+	_, mw.err = mw.w.Write(*buf)
+	return mw.err
+}
+
+// writeBatched queues the frame and either waits for the goroutine writing to
+// send it or becomes the writer and sends every queued frame at once
+func (mw *MsgWriter) writeBatched(frame Frame, compressed bool) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	if mw.err != nil {
+		return mw.err
+	}
+	mw.pending = appendFrame(mw.pending, frame, compressed)
+	mw.queued++
+	seq := mw.queued
+
+	for mw.writing && mw.flushed < seq {
+		mw.cond.Wait()
+	}
+	if mw.flushed >= seq {
+		return mw.err
+	}
+
+	mw.writing = true
+	batch, last := mw.pending, mw.queued
+	mw.pending = mw.spare[:0]
+	mw.mu.Unlock()
+	_, err := mw.w.Write(batch)
+	mw.mu.Lock()
+	if cap(batch) <= maxPooledBuffer {
+		mw.spare = batch
+	} else {
+		mw.spare = nil
+	}
+	if err != nil && mw.err == nil {
+		mw.err = err
+	}
+	mw.flushed = last
+	mw.writing = false
+	mw.cond.Broadcast()
+	return mw.err
+}
@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer records the size of every write
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes++
+	return b.buf.Write(p)
+}
+
+func TestMsgWriterConcurrent(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		out := new(lockedBuffer)
+		mw := NewMsgWriter(out)
+		mw.Batch = batch
+
+		const writers, messages = 8, 100
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < messages; j++ {
+					if err := mw.WriteMsg(GameMoveMsg{Player: i, X: j}); err != nil {
+						t.Error(err)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// Every message must be read back whole and in order per writer
+		next := make([]int, writers)
+		fr := NewFrameReader(&out.buf)
+		for n := 0; n < writers*messages; n++ {
+			msg, err := fr.ReadMsg()
+			if err != nil {
+				t.Fatalf("batch %v: message %d: %v", batch, n, err)
+			}
+			move := msg.(GameMoveMsg)
+			if move.X != next[move.Player] {
+				t.Errorf("batch %v: writer %d sent %d before %d", batch, move.Player, move.X, next[move.Player])
+			}
+			next[move.Player] = move.X + 1
+		}
+		if _, err := fr.ReadMsg(); err != io.EOF {
+			t.Errorf("batch %v: expected io.EOF after the last message but got %v", batch, err)
+		}
+		if !batch && out.writes != writers*messages {
+			t.Errorf("expected a single write per message but got %d writes", out.writes)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestMsgWriterError(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		mw := NewMsgWriter(failingWriter{})
+		mw.Batch = batch
+		if err := mw.WriteMsg(PingMsg{}); err == nil {
+			t.Errorf("batch %v: expected the write error", batch)
+		}
+		if err := mw.WriteMsg(PingMsg{}); err == nil {
+			t.Errorf("batch %v: expected the error to stick", batch)
+		}
+	}
+}
+
+// loopback returns a TCP connection whose peer discards everything
+func loopback(b *testing.B) net.Conn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Skip(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, conn)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return conn
+}
+
+var benchMsg = GameMoveMsg{Player: 1, X: 4, Y: 7}
+
+// writeSeparately is how frames were written before MsgWriter: a write for
+// the length, one for the type and one for the payload
+func writeSeparately(w io.Writer, message BattleMsg) error {
+	msgType, payload, err := Msg2Raw(message)
+	if err != nil {
+		return err
+	}
+	length, _ := toBytes32(uint32(len(payload)))
+	if _, err := w.Write(length); err != nil {
+		return err
+	}
+	bType, _ := toBytes8(msgType)
+	if _, err := w.Write(bType); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+func BenchmarkWriteSeparately(b *testing.B) {
+	conn := loopback(b)
+	defer conn.Close()
+	var mu sync.Mutex
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			err := writeSeparately(conn, benchMsg)
+			mu.Unlock()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMsgWriter(b *testing.B) {
+	conn := loopback(b)
+	defer conn.Close()
+	mw := NewMsgWriter(conn)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := mw.WriteMsg(benchMsg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMsgWriterBatch(b *testing.B) {
+	conn := loopback(b)
+	defer conn.Close()
+	mw := NewMsgWriter(conn)
+	mw.Batch = true
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := mw.WriteMsg(benchMsg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
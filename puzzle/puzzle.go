@@ -0,0 +1,300 @@
+// Package puzzle implements solitaire battleship, also known as Bimaru. A
+// fleet is hidden on the board so that no two ships touch, not even
+// diagonally. The player is given the number of ship cells in every row and
+// column along with a few revealed cells and has to deduce where every ship
+// is.
+//
+//go:generate stringer -type=Difficulty
+package puzzle
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/jonfk/battleship/game"
+)
+
+type Cell int
+
+const (
+	Unknown Cell = iota
+	Water
+	Ship
+)
+
+type Puzzle struct {
+	Size      game.Coord
+	Fleet     []game.PieceType
+	RowCounts []int
+	ColCounts []int
+	// Given holds the revealed cells indexed by row then column
+	Given [][]Cell
+}
+
+// New creates a puzzle without any revealed cells from the solution's row and
+// column counts
+func New(size game.Coord, solution []game.Piece) *Puzzle {
+	puzzle := &Puzzle{
+		Size:      size,
+		RowCounts: make([]int, size.Y),
+		ColCounts: make([]int, size.X),
+		Given:     make([][]Cell, size.Y),
+	}
+	for i := range puzzle.Given {
+		puzzle.Given[i] = make([]Cell, size.X)
+	}
+	for _, piece := range solution {
+		puzzle.Fleet = append(puzzle.Fleet, piece.Type)
+		for _, coord := range piece.Coords() {
+			puzzle.RowCounts[coord.Y]++
+			puzzle.ColCounts[coord.X]++
+		}
+	}
+	return puzzle
+}
+
+// Reveal gives away the content of a cell of the solution
+func (puzzle *Puzzle) Reveal(coord game.Coord, solution []game.Piece) {
+	puzzle.Given[coord.Y][coord.X] = Water
+	for _, piece := range solution {
+		if piece.Covers(coord) {
+			puzzle.Given[coord.Y][coord.X] = Ship
+		}
+	}
+}
+
+// Clues returns the number of revealed cells
+func (puzzle *Puzzle) Clues() int {
+	n := 0
+	for _, row := range puzzle.Given {
+		for _, cell := range row {
+			if cell != Unknown {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Check returns an error if the pieces are not a solution of the puzzle
+func (puzzle *Puzzle) Check(pieces []game.Piece) error {
+	var fleet, expected []int
+	for _, piece := range pieces {
+		fleet = append(fleet, int(piece.Type))
+	}
+	for _, piece := range puzzle.Fleet {
+		expected = append(expected, int(piece))
+	}
+	sort.Ints(fleet)
+	sort.Ints(expected)
+	if fmt.Sprint(fleet) != fmt.Sprint(expected) {
+		return fmt.Errorf("Check: the fleet should be %v", puzzle.Fleet)
+	}
+
+	s := newSolver(puzzle)
+	for _, piece := range pieces {
+		if piece.Start.X != piece.End.X && piece.Start.Y != piece.End.Y ||
+			len(piece.Coords()) != piece.Length() {
+			return fmt.Errorf("Check: %v %v has an invalid position", piece.Type, piece.Notation())
+		}
+		for _, coord := range piece.Coords() {
+			if coord.X < 0 || coord.X >= puzzle.Size.X || coord.Y < 0 || coord.Y >= puzzle.Size.Y {
+				return fmt.Errorf("Check: %v %v is outside of the board", piece.Type, piece.Notation())
+			}
+		}
+		if !s.fits(piece) {
+			return fmt.Errorf("Check: %v %v touches another ship", piece.Type, piece.Notation())
+		}
+		s.place(piece, 1)
+	}
+	if !s.isSolved() {
+		return fmt.Errorf("Check: the ships do not match the counts and revealed cells")
+	}
+	return nil
+}
+
+// Solve returns up to limit solutions of the puzzle
+func (puzzle *Puzzle) Solve(limit int) [][]game.Piece {
+	s := newSolver(puzzle)
+	s.limit = limit
+	s.search(0, 0)
+	return s.solutions
+}
+
+// IsUnique reports whether the puzzle has exactly one solution. Ships of the
+// same length are interchangeable so swapping them is not another solution.
+func (puzzle *Puzzle) IsUnique() bool {
+	return len(puzzle.Solve(2)) == 1
+}
+
+func (puzzle *Puzzle) String() string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("  ")
+	for x := 0; x < puzzle.Size.X; x++ {
+		buf.WriteString(fmt.Sprintf("%2s", game.ColumnName(x)))
+	}
+	buf.WriteString("\n")
+	for y, row := range puzzle.Given {
+		buf.WriteString(fmt.Sprintf("%2d", y+1))
+		for _, cell := range row {
+			switch cell {
+			case Water:
+				buf.WriteString(" ~")
+			case Ship:
+				buf.WriteString(" #")
+			default:
+				buf.WriteString(" .")
+			}
+		}
+		buf.WriteString(fmt.Sprintf(" %d\n", puzzle.RowCounts[y]))
+	}
+	buf.WriteString("  ")
+	for _, count := range puzzle.ColCounts {
+		buf.WriteString(fmt.Sprintf("%2d", count))
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+/*
+ * Generator
+ */
+
+type Difficulty int
+
+const (
+	Easy Difficulty = iota
+	Medium
+	Hard
+)
+
+// gradeNodes is the most ships the solver places to solve a puzzle of each
+// difficulty, harder puzzles need more guessing
+var gradeNodes = [...]int{Easy: 15, Medium: 40}
+
+// generateAttempts is how many fleets are tried to find a puzzle of the
+// difficulty asked for
+const generateAttempts = 100
+
+// Grade returns the difficulty of the puzzle from how many ships the solver
+// has to try before finding the solution and proving it is unique
+func (puzzle *Puzzle) Grade() Difficulty {
+	s := newSolver(puzzle)
+	s.limit = 2
+	s.search(0, 0)
+	for difficulty, nodes := range gradeNodes {
+		if s.nodes <= nodes {
+			return Difficulty(difficulty)
+		}
+	}
+	return Hard
+}
+
+// Generate hides the fleet at random on a board of the given size and reveals
+// just enough cells for the puzzle to have a unique solution. Puzzles graded
+// easier than the difficulty asked for are thrown away, harder ones get more
+// cells revealed until their grade matches.
+func Generate(rng *rand.Rand, size game.Coord, fleet []game.PieceType, difficulty Difficulty) (*Puzzle, []game.Piece, error) {
+	if difficulty < Easy || difficulty > Hard {
+		return nil, nil, fmt.Errorf("Generate: invalid difficulty %v", difficulty)
+	}
+	for attempt := 0; attempt < generateAttempts; attempt++ {
+		puzzle, solution, cells, err := generateMinimal(rng, size, fleet)
+		if err != nil {
+			return nil, nil, err
+		}
+		grade := puzzle.Grade()
+		if grade < difficulty {
+			continue
+		}
+		// Make the puzzle easier by revealing cells that are not needed
+		for _, coord := range cells {
+			if grade <= difficulty {
+				break
+			}
+			if puzzle.Given[coord.Y][coord.X] == Unknown {
+				puzzle.Reveal(coord, solution)
+				grade = puzzle.Grade()
+			}
+		}
+		if grade == difficulty {
+			return puzzle, solution, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("Generate: no %v puzzle found in %d attempts", difficulty, generateAttempts)
+}
+
+// generateMinimal hides the fleet at random and reveals a minimal set of
+// cells giving a unique solution. It also returns every cell of the board in
+// a random order.
+func generateMinimal(rng *rand.Rand, size game.Coord, fleet []game.PieceType) (*Puzzle, []game.Piece, []game.Coord, error) {
+	solution, err := game.RandomFleetFunc(rng, size, fleet, func(placed []game.Piece, piece game.Piece) bool {
+		for _, other := range placed {
+			if touches(other, piece) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	puzzle := New(size, solution)
+
+	var cells []game.Coord
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			cells = append(cells, game.Coord{X: x, Y: y})
+		}
+	}
+	rng.Shuffle(len(cells), func(i, j int) { cells[i], cells[j] = cells[j], cells[i] })
+
+	// Reveal cells until there is a single solution
+	next := 0
+	for next < len(cells) && !puzzle.IsUnique() {
+		puzzle.Reveal(cells[next], solution)
+		next++
+	}
+	// Hide the clues that are not needed
+	revealed := append([]game.Coord(nil), cells[:next]...)
+	rng.Shuffle(len(revealed), func(i, j int) { revealed[i], revealed[j] = revealed[j], revealed[i] })
+	for _, coord := range revealed {
+		cell := puzzle.Given[coord.Y][coord.X]
+		puzzle.Given[coord.Y][coord.X] = Unknown
+		if !puzzle.IsUnique() {
+			puzzle.Given[coord.Y][coord.X] = cell
+		}
+	}
+	return puzzle, solution, cells, nil
+}
+
+// Daily returns the puzzle of the day on a standard board. Everyone gets the
+// same puzzle for a given date and difficulty.
+func Daily(date time.Time, difficulty Difficulty) (*Puzzle, []game.Piece, error) {
+	seed := int64(date.Year()*10000+int(date.Month())*100+date.Day())*10 + int64(difficulty)
+	rules := game.StandardRules()
+	return Generate(rand.New(rand.NewSource(seed)), rules.Size, rules.Fleet, difficulty)
+}
+
+// touches reports whether two pieces overlap or are next to each other,
+// including diagonally
+func touches(a, b game.Piece) bool {
+	for _, ca := range a.Coords() {
+		for _, cb := range b.Coords() {
+			if abs(ca.X-cb.X) <= 1 && abs(ca.Y-cb.Y) <= 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
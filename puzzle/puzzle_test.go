@@ -0,0 +1,141 @@
+package puzzle
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jonfk/battleship/game"
+)
+
+func TestSolve(t *testing.T) {
+	solution := []game.Piece{
+		{Type: game.AircraftCarrier, Start: game.Coord{X: 0, Y: 0}, End: game.Coord{X: 4, Y: 0}},
+		{Type: game.Destroyer, Start: game.Coord{X: 0, Y: 2}, End: game.Coord{X: 0, Y: 4}},
+		{Type: game.PatrolBoat, Start: game.Coord{X: 4, Y: 4}, End: game.Coord{X: 4, Y: 5}},
+	}
+	size := game.Coord{X: 6, Y: 6}
+	puzzle := New(size, solution)
+	if err := puzzle.Check(solution); err != nil {
+		t.Fatal(err)
+	}
+
+	solutions := puzzle.Solve(100)
+	if len(solutions) == 0 {
+		t.Fatal("Puzzle should be solvable")
+	}
+	for _, s := range solutions {
+		if err := puzzle.Check(s); err != nil {
+			t.Errorf("Solver returned an invalid solution %v: %v", s, err)
+		}
+	}
+
+	for _, coord := range []game.Coord{{X: 0, Y: 0}, {X: 0, Y: 2}, {X: 4, Y: 4}, {X: 3, Y: 5}} {
+		puzzle.Reveal(coord, solution)
+	}
+	if !puzzle.IsUnique() {
+		t.Fatalf("Puzzle should have a unique solution:\n%v%v", puzzle, puzzle.Solve(10))
+	}
+	if err := puzzle.Check(puzzle.Solve(1)[0]); err != nil {
+		t.Error(err)
+	}
+	if puzzle.Clues() != 4 {
+		t.Errorf("Puzzle should have 4 clues instead of %d", puzzle.Clues())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	solution := []game.Piece{
+		{Type: game.Destroyer, Start: game.Coord{X: 0, Y: 0}, End: game.Coord{X: 2, Y: 0}},
+		{Type: game.PatrolBoat, Start: game.Coord{X: 4, Y: 0}, End: game.Coord{X: 4, Y: 1}},
+	}
+	puzzle := New(game.Coord{X: 5, Y: 5}, solution)
+	puzzle.Reveal(game.Coord{X: 4, Y: 1}, solution)
+	puzzle.Reveal(game.Coord{X: 4, Y: 4}, solution)
+
+	invalid := [][]game.Piece{
+		// Missing piece
+		solution[:1],
+		// Touching diagonally
+		{solution[0], {Type: game.PatrolBoat, Start: game.Coord{X: 3, Y: 1}, End: game.Coord{X: 3, Y: 2}}},
+		// Wrong counts
+		{solution[0], {Type: game.PatrolBoat, Start: game.Coord{X: 4, Y: 2}, End: game.Coord{X: 4, Y: 3}}},
+		// Diagonal piece
+		{solution[0], {Type: game.PatrolBoat, Start: game.Coord{X: 4, Y: 0}, End: game.Coord{X: 3, Y: 1}}},
+		// Outside of the board
+		{solution[0], {Type: game.PatrolBoat, Start: game.Coord{X: 4, Y: 5}, End: game.Coord{X: 4, Y: 6}}},
+	}
+	for _, pieces := range invalid {
+		if err := puzzle.Check(pieces); err == nil {
+			t.Errorf("%v should not be a solution", pieces)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	rules := game.StandardRules()
+	var clues [3]int
+	for _, difficulty := range []Difficulty{Easy, Medium, Hard} {
+		puzzle, solution, err := Generate(rng, rules.Size, rules.Fleet, difficulty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := puzzle.Check(solution); err != nil {
+			t.Fatalf("%v: %v\n%v", difficulty, err, puzzle)
+		}
+		solutions := puzzle.Solve(2)
+		if len(solutions) != 1 {
+			t.Fatalf("%v puzzle should have a unique solution:\n%v", difficulty, puzzle)
+		}
+		if grade := puzzle.Grade(); grade != difficulty {
+			t.Errorf("%v puzzle is graded %v:\n%v", difficulty, grade, puzzle)
+		}
+		clues[difficulty] = puzzle.Clues()
+	}
+	t.Logf("Clues by difficulty: %v", clues)
+
+	// A hard puzzle only has the clues it needs
+	puzzle, _, err := Generate(rng, rules.Size, rules.Fleet, Hard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y, row := range puzzle.Given {
+		for x, cell := range row {
+			if cell == Unknown {
+				continue
+			}
+			puzzle.Given[y][x] = Unknown
+			if puzzle.IsUnique() {
+				t.Errorf("Clue at %v is not needed:\n%v", game.Coord{X: x, Y: y}.Notation(), puzzle)
+			}
+			puzzle.Given[y][x] = cell
+		}
+	}
+
+	if _, _, err := Generate(rng, rules.Size, rules.Fleet, Difficulty(7)); err == nil {
+		t.Error("Expected error on invalid difficulty")
+	}
+}
+
+func TestDaily(t *testing.T) {
+	date := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	a, _, err := Daily(date, Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := Daily(date, Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != b.String() {
+		t.Errorf("Daily puzzles should be the same for the same date:\n%v\n%v", a, b)
+	}
+	c, _, err := Daily(date.AddDate(0, 0, 1), Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() == c.String() {
+		t.Errorf("Daily puzzles should change every day:\n%v", a)
+	}
+}
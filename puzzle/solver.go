@@ -0,0 +1,187 @@
+package puzzle
+
+import (
+	"sort"
+
+	"github.com/jonfk/battleship/game"
+)
+
+// solver is a backtracking search placing the fleet from the longest ship to
+// the shortest. Every position of a ship is checked against the row and
+// column counts, the revealed water and the ships already placed so that no
+// two ships touch.
+type solver struct {
+	puzzle *Puzzle
+	// fleet is sorted by decreasing length. Ships of the same length cannot
+	// be told apart in a puzzle so they are only placed in increasing
+	// position order.
+	fleet      []game.PieceType
+	candidates [][]game.Piece
+	occupied   [][]int
+	// blocked counts the ships occupying or touching each cell
+	blocked   [][]int
+	rows      []int
+	cols      []int
+	placed    []game.Piece
+	limit     int
+	solutions [][]game.Piece
+	// nodes counts the ships placed during the search, it measures how hard
+	// the puzzle is to solve
+	nodes int
+}
+
+func newSolver(puzzle *Puzzle) *solver {
+	s := &solver{
+		puzzle:   puzzle,
+		occupied: newGrid(puzzle.Size),
+		blocked:  newGrid(puzzle.Size),
+		rows:     make([]int, puzzle.Size.Y),
+		cols:     make([]int, puzzle.Size.X),
+	}
+	s.fleet = append(s.fleet, puzzle.Fleet...)
+	sort.SliceStable(s.fleet, func(i, j int) bool {
+		if s.fleet[i].Length() != s.fleet[j].Length() {
+			return s.fleet[i].Length() > s.fleet[j].Length()
+		}
+		return s.fleet[i] < s.fleet[j]
+	})
+	for _, pieceType := range s.fleet {
+		var candidates []game.Piece
+		for _, piece := range game.Placements(puzzle.Size, pieceType) {
+			if s.fits(piece) {
+				candidates = append(candidates, piece)
+			}
+		}
+		s.candidates = append(s.candidates, candidates)
+	}
+	return s
+}
+
+func newGrid(size game.Coord) [][]int {
+	grid := make([][]int, size.Y)
+	for i := range grid {
+		grid[i] = make([]int, size.X)
+	}
+	return grid
+}
+
+func (s *solver) search(i, minIndex int) {
+	if len(s.solutions) >= s.limit {
+		return
+	}
+	if i == len(s.fleet) {
+		if s.isSolved() {
+			solution := make([]game.Piece, len(s.placed))
+			copy(solution, s.placed)
+			s.solutions = append(s.solutions, solution)
+		}
+		return
+	}
+	start := 0
+	if i > 0 && s.fleet[i].Length() == s.fleet[i-1].Length() {
+		start = minIndex
+	}
+	for j := start; j < len(s.candidates[i]); j++ {
+		piece := s.candidates[i][j]
+		if !s.fits(piece) {
+			continue
+		}
+		s.place(piece, 1)
+		s.nodes++
+		if s.canCoverShips() {
+			s.placed = append(s.placed, piece)
+			s.search(i+1, j+1)
+			s.placed = s.placed[:len(s.placed)-1]
+		}
+		s.place(piece, -1)
+	}
+}
+
+// fits reports whether the piece can be placed without touching another ship,
+// covering revealed water or going over a row or column count
+func (s *solver) fits(piece game.Piece) bool {
+	coords := piece.Coords()
+	for _, coord := range coords {
+		if s.blocked[coord.Y][coord.X] > 0 || s.puzzle.Given[coord.Y][coord.X] == Water {
+			return false
+		}
+	}
+	if piece.Start.Y == piece.End.Y {
+		if s.rows[piece.Start.Y]+len(coords) > s.puzzle.RowCounts[piece.Start.Y] {
+			return false
+		}
+		for _, coord := range coords {
+			if s.cols[coord.X]+1 > s.puzzle.ColCounts[coord.X] {
+				return false
+			}
+		}
+	} else {
+		if s.cols[piece.Start.X]+len(coords) > s.puzzle.ColCounts[piece.Start.X] {
+			return false
+		}
+		for _, coord := range coords {
+			if s.rows[coord.Y]+1 > s.puzzle.RowCounts[coord.Y] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// place adds the piece when delta is 1 and removes it when delta is -1
+func (s *solver) place(piece game.Piece, delta int) {
+	for _, coord := range piece.Coords() {
+		s.occupied[coord.Y][coord.X] += delta
+		s.rows[coord.Y] += delta
+		s.cols[coord.X] += delta
+	}
+	minX, maxX := piece.Start.X, piece.End.X
+	if minX > maxX {
+		minX, maxX = maxX, minX
+	}
+	minY, maxY := piece.Start.Y, piece.End.Y
+	if minY > maxY {
+		minY, maxY = maxY, minY
+	}
+	for y := minY - 1; y <= maxY+1; y++ {
+		for x := minX - 1; x <= maxX+1; x++ {
+			if y >= 0 && y < s.puzzle.Size.Y && x >= 0 && x < s.puzzle.Size.X {
+				s.blocked[y][x] += delta
+			}
+		}
+	}
+}
+
+// canCoverShips reports whether every revealed ship cell is either covered or
+// can still be covered by a ship placed later
+func (s *solver) canCoverShips() bool {
+	for y, row := range s.puzzle.Given {
+		for x, cell := range row {
+			if cell == Ship && s.occupied[y][x] == 0 && s.blocked[y][x] > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *solver) isSolved() bool {
+	for y, count := range s.puzzle.RowCounts {
+		if s.rows[y] != count {
+			return false
+		}
+	}
+	for x, count := range s.puzzle.ColCounts {
+		if s.cols[x] != count {
+			return false
+		}
+	}
+	for y, row := range s.puzzle.Given {
+		for x, cell := range row {
+			if cell == Ship && s.occupied[y][x] == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}